@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 	_ "time/tzdata"
 
@@ -13,9 +18,16 @@ import (
 
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/db"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/goals"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/idempotency"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/logs"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/metrics"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/oidc"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/webhooks"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/weight"
 )
 
 func main() {
@@ -39,7 +51,11 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	// Cancelled on SIGINT/SIGTERM; background workers stop with it.
+	rootCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(rootCtx, 20*time.Second)
 	defer cancel()
 
 	pgPool, err := db.Connect(ctx, pgURL)
@@ -48,6 +64,7 @@ func main() {
 		os.Exit(1)
 	}
 	defer pgPool.Close()
+	db.ExportPoolStats(pgPool)
 
 	// Apply schema on startup (simple dev-friendly behavior)
 	schemaSQLBytes, err := os.ReadFile("cmd/api/schema.sql")
@@ -60,7 +77,7 @@ func main() {
 		slog.Warn("could not read schema.sql, skipping auto-migrate", "err", err)
 	}
 
-	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI).SetPoolMonitor(db.MongoPoolMonitor()))
 	if err != nil {
 		slog.Error("mongo connect failed", "err", err)
 		os.Exit(1)
@@ -69,17 +86,63 @@ func main() {
 
 	offRepo := foods.NewRepoMongoOFF(mongoClient, offDB, offCollection, offSearchMode)
 	customRepo := foods.NewRepoPostgresCustom(pgPool)
+	recipeRepo := foods.NewRepoPostgresRecipes(pgPool)
 
-	foodsSvc := foods.NewService(offRepo, customRepo)
+	foodsSvc := foods.NewService(offRepo, customRepo, recipeRepo)
 	foodsHandler := foods.NewHandler(foodsSvc)
 
 	authSvc := auth.NewService(pgPool, []byte(jwtSecret))
 	authHandler := auth.NewHandler(authSvc)
 
+	// Optional OIDC single sign-on (authorization code + PKCE).
+	// OIDC_PROVISIONING=link only admits identities users linked from /me/sso/link.
+	if issuer := envOr("OIDC_ISSUER", ""); issuer != "" {
+		authSvc.EnableSSO(auth.SSOConfig{
+			Provider: oidc.NewProvider(oidc.Config{
+				Issuer:       issuer,
+				ClientID:     mustEnv("OIDC_CLIENT_ID"),
+				ClientSecret: envOr("OIDC_CLIENT_SECRET", ""),
+				RedirectURL:  mustEnv("OIDC_REDIRECT_URL"),
+				Scopes:       strings.Fields(envOr("OIDC_SCOPES", "openid email profile")),
+			}),
+			Provisioning:   envOr("OIDC_PROVISIONING", auth.ProvisionAuto),
+			AllowedDomains: splitList(envOr("OIDC_ALLOWED_DOMAINS", "")),
+		})
+	}
+
+	goalsRepo := goals.NewRepoPostgres(pgPool)
+	goalsSvc := goals.NewService(goalsRepo, authSvc)
+	goalsHandler := goals.NewHandler(goalsSvc)
+
 	logsRepo := logs.NewRepoPostgres(pgPool)
-	logsSvc := logs.NewService(logsRepo, foodsSvc, authSvc)
+	// Live updates; set EVENTS_FANOUT=postgres when running more than one replica.
+	bus := events.NewBus()
+	if envOr("EVENTS_FANOUT", "") == "postgres" {
+		bus.UsePostgres(pgPool)
+		go bus.Listen(rootCtx)
+	}
+
+	// Outgoing webhooks: bus events are queued in the outbox and delivered in the background.
+	webhooksRepo := webhooks.NewRepoPostgres(pgPool)
+	webhooksSvc := webhooks.NewService(webhooksRepo)
+	webhooksHandler := webhooks.NewHandler(webhooksSvc)
+	bus.AddHook(webhooksSvc.HandleEvent, webhooksSvc.WantsEvent)
+	go webhooks.NewDispatcher(webhooksRepo).Run(rootCtx, 5*time.Second)
+
+	logsSvc := logs.NewService(logsRepo, foodsSvc, authSvc, goalsSvc, bus)
 	logsHandler := logs.NewHandler(logsSvc)
 
+	// Search ranks the user's own logged foods first when a token is present.
+	foodsSvc.SetHistoryProvider(logsSvc)
+
+	weightRepo := weight.NewRepoPostgres(pgPool)
+	weightSvc := weight.NewService(weightRepo, logsSvc, authSvc, bus)
+	weightHandler := weight.NewHandler(weightSvc)
+
+	// Retried mutating requests with the same Idempotency-Key replay the stored response.
+	idemStore := idempotency.NewStore(idempotency.NewRepoPostgres(pgPool), 24*time.Hour)
+	go idemStore.RunExpiry(rootCtx, time.Hour)
+
 	// Optional: OFF index (safe no-op if not needed)
 	{
 		idxCtx, idxCancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -90,36 +153,105 @@ func main() {
 	}
 
 	r := gin.New()
+	// Only these peers (the nginx/ingress CIDRs) may set X-Forwarded-For.
+	// Unset means the server is exposed directly and ClientIP is the socket
+	// peer, so clients can't pick their own rate-limit bucket or audit IP.
+	if err := r.SetTrustedProxies(splitList(envOr("TRUSTED_PROXIES", ""))); err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "err", err)
+		os.Exit(1)
+	}
 	r.Use(httpapi.RequestIDMiddleware())
 	r.Use(httpapi.LoggerMiddleware(slog.Default()))
-	r.Use(gin.Recovery())
+	r.Use(httpapi.MetricsMiddleware())
+	r.Use(httpapi.Recovery())
+	r.NoRoute(func(c *gin.Context) { httpapi.NotFound(c, "no such endpoint", nil) })
+
+	// Prometheus metrics are only served on the admin listener at METRICS_ADDR
+	// (e.g. 127.0.0.1:9090), never on the public router. Unset means no endpoint.
+	metricsAddr := envOr("METRICS_ADDR", "")
+	var metricsSrv *http.Server
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		metricsSrv = &http.Server{Addr: metricsAddr, Handler: mux}
+	}
+
+	// Rate limits share one store; RATE_LIMIT_STORE=postgres shares buckets across replicas.
+	var limitStore httpapi.LimiterStore
+	if envOr("RATE_LIMIT_STORE", "memory") == "postgres" {
+		limitStore = httpapi.NewPostgresStore(pgPool, 30*time.Minute)
+	} else {
+		limitStore = httpapi.NewMemoryStore(30 * time.Minute)
+	}
 
-	api := r.Group("/api")
+	spec, err := apiSpec().JSON()
+	if err != nil {
+		slog.Error("build openapi spec failed", "err", err)
+		os.Exit(1)
+	}
 
-	api.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"ok": true}) })
+	registerRoutes(r.Group("/api"), app{
+		authSvc:         authSvc,
+		authHandler:     authHandler,
+		foodsHandler:    foodsHandler,
+		goalsHandler:    goalsHandler,
+		logsHandler:     logsHandler,
+		webhooksHandler: webhooksHandler,
+		weightHandler:   weightHandler,
+		idemStore:       idemStore,
+		limitStore:      limitStore,
+		spec:            spec,
+	})
+	// openapi_test.go fails CI on drift; this only flags a build that slipped through.
+	if err := apiSpec().CheckRoutes(r.Routes()); err != nil {
+		slog.Warn("openapi spec out of date", "err", err)
+	}
 
-	api.POST("/auth/register", authHandler.Register)
-	api.POST("/auth/login", authHandler.Login)
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	// Open event streams never finish on their own; end them so Shutdown can drain.
+	srv.RegisterOnShutdown(bus.Close)
 
-	authRequired := authSvc.Middleware()
+	if metricsSrv != nil {
+		go func() {
+			slog.Info("metrics listening", "addr", metricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("metrics server failed", "err", err)
+				os.Exit(1)
+			}
+		}()
+	}
 
-	api.GET("/me", authRequired, authHandler.Me)
-	api.GET("/me/settings", authRequired, authHandler.MeSettings)
-	api.PATCH("/me/settings", authRequired, authHandler.UpdateSettings)
+	go func() {
+		slog.Info("api listening", "port", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", "err", err)
+			os.Exit(1)
+		}
+	}()
 
-	api.GET("/foods/search", foodsHandler.Search)
-	api.GET("/foods/barcode/:code", foodsHandler.ByBarcode)
-	api.POST("/foods", authRequired, foodsHandler.CreateCustom)
-	api.POST("/foods/custom", authRequired, foodsHandler.CreateCustom)
+	<-rootCtx.Done()
+	slog.Info("shutting down")
 
-	api.GET("/logs/today", authRequired, logsHandler.Today)
-	api.POST("/logs/entries", authRequired, logsHandler.CreateEntry)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("graceful shutdown failed", "err", err)
+	}
+	if metricsSrv != nil {
+		_ = metricsSrv.Shutdown(shutdownCtx)
+	}
+	limitStore.Close()
+}
 
-	slog.Info("api listening", "port", port)
-	if err := r.Run(":" + port); err != nil {
-		slog.Error("server failed", "err", err)
+// rateLimiter builds a limiter from RATE_LIMIT_<NAME>, falling back to def.
+func rateLimiter(name, def string, key httpapi.KeyFunc, store httpapi.LimiterStore) *httpapi.RateLimiter {
+	spec := envOr("RATE_LIMIT_"+strings.ToUpper(name), def)
+	r, burst, err := httpapi.ParseRate(spec)
+	if err != nil {
+		slog.Error("invalid rate limit", "name", name, "spec", spec, "err", err)
 		os.Exit(1)
 	}
+	return httpapi.NewRateLimiter(httpapi.Policy{Name: name, Rate: r, Burst: burst, Key: key}, store)
 }
 
 func envOr(k, def string) string {
@@ -129,6 +261,17 @@ func envOr(k, def string) string {
 	return def
 }
 
+// splitList reads a comma-separated env value, dropping empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func mustEnv(k string) string {
 	v := os.Getenv(k)
 	if v == "" {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/goals"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/logs"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/openapi"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/webhooks"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/weight"
+)
+
+// apiSpec documents every route in registerRoutes. Schemas come from the
+// handlers' Go types; openapi_test.go fails when routes or schemas drift.
+func apiSpec() *openapi.Document {
+	const (
+		none     = openapi.AuthNone
+		optional = openapi.AuthOptional
+		session  = openapi.AuthSession
+		scoped   = openapi.AuthScoped
+	)
+	var (
+		logsRead      = []string{auth.ScopeLogsRead}
+		logsWrite     = []string{auth.ScopeLogsWrite}
+		foodsRead     = []string{auth.ScopeFoodsRead}
+		foodsWrite    = []string{auth.ScopeFoodsWrite}
+		weightRead    = []string{auth.ScopeWeightRead}
+		weightWrite   = []string{auth.ScopeWeightWrite}
+		settingsRead  = []string{auth.ScopeSettingsRead}
+		settingsWrite = []string{auth.ScopeSettingsWrite}
+		syncRead      = []string{auth.ScopeLogsRead, auth.ScopeFoodsRead, auth.ScopeSettingsRead}
+		syncWrite     = []string{auth.ScopeLogsWrite, auth.ScopeFoodsWrite, auth.ScopeSettingsWrite}
+	)
+	type status struct {
+		Status string `json:"status"`
+	}
+	type health struct {
+		OK bool `json:"ok"`
+	}
+	limit := openapi.Param{Name: "limit", Type: "integer"}
+	cursor := openapi.Param{Name: "cursor", Description: "next_cursor from the previous page"}
+	days := openapi.Param{Name: "days", Type: "integer"}
+
+	d := openapi.New("MacroFacts API", "1.0.0", "/api")
+	d.Add(
+		openapi.Op{Method: http.MethodGet, Path: "/health", Summary: "Liveness check", Auth: none, Response: health{}},
+		openapi.Op{Method: http.MethodGet, Path: "/openapi.json", Summary: "This document", Auth: none, Response: map[string]any{}},
+
+		openapi.Op{Method: http.MethodPost, Path: "/auth/register", Summary: "Create an account", Auth: none,
+			Body: auth.RegisterRequest{}, Response: status{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodPost, Path: "/auth/login", Summary: "Log in; may return a two-factor challenge", Auth: none,
+			Body: auth.LoginRequest{}, Response: auth.LoginResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/auth/login/2fa", Summary: "Complete a two-factor challenge", Auth: none,
+			Body: auth.TwoFactorLoginRequest{}, Response: auth.LoginResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/auth/oidc/start", Summary: "Start single sign-on", Auth: none,
+			Response: auth.SSOStartResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/auth/oidc/callback", Summary: "Finish single sign-on; a link needs the linking session", Auth: optional,
+			Body: auth.SSOCallbackRequest{}, Response: auth.LoginResponse{}},
+
+		openapi.Op{Method: http.MethodGet, Path: "/me", Summary: "Current user", Auth: scoped, Scopes: settingsRead,
+			Response: auth.MeResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/2fa/totp", Summary: "Start TOTP enrollment", Auth: session,
+			Response: auth.TOTPEnrollResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/2fa/totp/confirm", Summary: "Confirm TOTP enrollment", Auth: session,
+			Body: auth.TwoFactorCodeRequest{}, Response: auth.RecoveryCodesResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/2fa/totp/disable", Summary: "Turn off two-factor auth", Auth: session,
+			Body: auth.TwoFactorCodeRequest{}, Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodPost, Path: "/me/2fa/recovery-codes", Summary: "Replace recovery codes", Auth: session,
+			Body: auth.TwoFactorCodeRequest{}, Response: auth.RecoveryCodesResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/sso/link", Summary: "Link a single sign-on identity", Auth: session,
+			Response: auth.SSOStartResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/me/tokens", Summary: "List personal access tokens", Auth: session,
+			Response: auth.TokenListResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/tokens", Summary: "Create a personal access token", Auth: session,
+			Body: auth.CreateTokenRequest{}, Response: auth.CreateTokenResponse{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodDelete, Path: "/me/tokens/:id", Summary: "Revoke a personal access token", Auth: session,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodGet, Path: "/me/settings", Summary: "Goals and preferences", Auth: scoped, Scopes: settingsRead,
+			Response: auth.MeSettingsResponse{}},
+		openapi.Op{Method: http.MethodPatch, Path: "/me/settings", Summary: "Update goals and preferences", Auth: scoped, Scopes: settingsWrite,
+			Body: auth.UpdateSettingsRequest{}, Response: auth.MeSettingsResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/me/goals/history", Summary: "Goal changes over time", Auth: scoped, Scopes: settingsRead,
+			Response: auth.GoalHistoryResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/me/settings/meals", Summary: "Meal slots", Auth: scoped, Scopes: settingsRead,
+			Response: logs.MealSlotsResponse{}},
+		openapi.Op{Method: http.MethodPut, Path: "/me/settings/meals", Summary: "Replace meal slots", Auth: scoped, Scopes: settingsWrite,
+			Body: logs.UpdateMealSlotsRequest{}, Response: logs.MealSlotsResponse{}},
+
+		openapi.Op{Method: http.MethodPost, Path: "/me/goals/wizard", Summary: "Propose goals", Auth: scoped, Scopes: settingsRead,
+			Body: goals.WizardRequest{}, Response: goals.WizardResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/goals/wizard/apply", Summary: "Apply proposed goals", Auth: scoped, Scopes: settingsWrite,
+			Body: goals.WizardRequest{}, Response: auth.MeSettingsResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/me/goals/profiles", Summary: "List goal profiles", Auth: scoped, Scopes: settingsRead,
+			Response: goals.ProfileListResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/goals/profiles", Summary: "Create a goal profile", Auth: scoped, Scopes: settingsWrite,
+			Body: goals.CreateProfileRequest{}, Response: goals.Profile{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodPatch, Path: "/me/goals/profiles/:id", Summary: "Update a goal profile", Auth: scoped, Scopes: settingsWrite,
+			Body: goals.UpdateProfileRequest{}, Response: goals.Profile{}},
+		openapi.Op{Method: http.MethodDelete, Path: "/me/goals/profiles/:id", Summary: "Delete a goal profile", Auth: scoped, Scopes: settingsWrite,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodGet, Path: "/me/goals/schedule", Summary: "Weekly goal schedule", Auth: scoped, Scopes: settingsRead,
+			Response: goals.Schedule{}},
+		openapi.Op{Method: http.MethodPut, Path: "/me/goals/schedule", Summary: "Replace the weekly goal schedule", Auth: scoped, Scopes: settingsWrite,
+			Body: goals.Schedule{}, Response: goals.Schedule{}},
+		openapi.Op{Method: http.MethodPut, Path: "/me/goals/overrides/:date", Summary: "Use a profile on one date", Auth: scoped, Scopes: settingsWrite,
+			Body: goals.SetOverrideRequest{}, Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodDelete, Path: "/me/goals/overrides/:date", Summary: "Clear a date override", Auth: scoped, Scopes: settingsWrite,
+			Status: http.StatusNoContent},
+
+		openapi.Op{Method: http.MethodGet, Path: "/me/webhooks", Summary: "List webhooks", Auth: session,
+			Response: webhooks.WebhookListResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/webhooks", Summary: "Create a webhook", Auth: session,
+			Body: webhooks.CreateWebhookRequest{}, Response: webhooks.CreatedWebhook{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodPatch, Path: "/me/webhooks/:id", Summary: "Update a webhook", Auth: session,
+			Body: webhooks.UpdateWebhookRequest{}, Response: webhooks.Webhook{}},
+		openapi.Op{Method: http.MethodDelete, Path: "/me/webhooks/:id", Summary: "Delete a webhook", Auth: session,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodGet, Path: "/me/webhooks/:id/deliveries", Summary: "Recent delivery attempts", Auth: session,
+			Query: []openapi.Param{limit}, Response: webhooks.DeliveryListResponse{}},
+
+		openapi.Op{Method: http.MethodGet, Path: "/me/weight", Summary: "Weight history", Auth: scoped, Scopes: weightRead,
+			Query: []openapi.Param{days}, Response: weight.WeightListResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/weight", Summary: "Log a weigh-in", Auth: scoped, Scopes: weightWrite,
+			Body: weight.LogWeightRequest{}, Response: weight.WeightEntry{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodDelete, Path: "/me/weight/:date", Summary: "Delete a weigh-in", Auth: scoped, Scopes: weightWrite,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodGet, Path: "/me/energy-expenditure", Summary: "Estimated TDEE and goal suggestion", Auth: scoped, Scopes: weightRead,
+			Query:    []openapi.Param{days, {Name: "rateKgPerWeek", Type: "number"}},
+			Response: weight.EnergyExpenditureResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/me/energy-expenditure/apply", Summary: "Apply the suggested goals", Auth: scoped, Scopes: weightWrite,
+			Body: weight.ApplySuggestionRequest{}, Response: auth.MeSettingsResponse{}},
+
+		openapi.Op{Method: http.MethodGet, Path: "/foods/search", Summary: "Search foods", Auth: optional, Scopes: foodsRead,
+			Query:    []openapi.Param{{Name: "q", Required: true}, limit, cursor},
+			Response: foods.SearchResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/foods/barcode/:code", Summary: "Look up a barcode", Auth: none,
+			Response: foods.ItemResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/foods", Summary: "Create a custom food", Auth: scoped, Scopes: foodsWrite,
+			Body: foods.CreateFoodRequest{}, Response: foods.ItemResponse{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodPost, Path: "/foods/custom", Summary: "Create a custom food (alias of POST /foods)", Auth: scoped, Scopes: foodsWrite,
+			Body: foods.CreateFoodRequest{}, Response: foods.ItemResponse{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodGet, Path: "/foods/favorites", Summary: "List favorite foods", Auth: scoped, Scopes: foodsRead,
+			Response: logs.FavoritesResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/foods/favorites", Summary: "Add a favorite food", Auth: scoped, Scopes: foodsWrite,
+			Body: logs.FavoriteRequest{}, Response: foods.ItemResponse{}},
+		openapi.Op{Method: http.MethodDelete, Path: "/foods/favorites/:source/:ref", Summary: "Remove a favorite food", Auth: scoped, Scopes: foodsWrite,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodGet, Path: "/foods/frequent", Summary: "Frequently logged foods", Auth: scoped, Scopes: foodsRead,
+			Query: []openapi.Param{cursor, limit,
+				{Name: "meal", Description: "rank for this meal slot"},
+				{Name: "hour", Type: "integer", Description: "rank for this local hour"}},
+			Response: logs.FrequentFoodsResponse{}},
+
+		openapi.Op{Method: http.MethodGet, Path: "/recipes", Summary: "List recipes", Auth: scoped, Scopes: foodsRead,
+			Response: foods.RecipeListResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/recipes", Summary: "Create a recipe", Auth: scoped, Scopes: foodsWrite,
+			Body: foods.RecipeRequest{}, Response: foods.Recipe{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodGet, Path: "/recipes/:id", Summary: "Get a recipe", Auth: scoped, Scopes: foodsRead,
+			Response: foods.Recipe{}},
+		openapi.Op{Method: http.MethodPut, Path: "/recipes/:id", Summary: "Replace a recipe", Auth: scoped, Scopes: foodsWrite,
+			Body: foods.RecipeRequest{}, Response: foods.Recipe{}},
+		openapi.Op{Method: http.MethodDelete, Path: "/recipes/:id", Summary: "Delete a recipe", Auth: scoped, Scopes: foodsWrite,
+			Status: http.StatusNoContent},
+
+		openapi.Op{Method: http.MethodGet, Path: "/logs/today", Summary: "Today's diary", Auth: scoped, Scopes: logsRead,
+			Response: logs.TodayResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/logs/days/:date", Summary: "Diary for a date", Auth: scoped, Scopes: logsRead,
+			Response: logs.TodayResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/logs/summary", Summary: "Daily totals over a range", Auth: scoped, Scopes: logsRead,
+			Query:    []openapi.Param{{Name: "from", Required: true}, {Name: "to", Required: true}},
+			Response: logs.RangeSummaryResponse{}},
+		openapi.Op{Method: http.MethodGet, Path: "/logs/stream", Summary: "Live diary events (Server-Sent Events)", Auth: scoped, Scopes: logsRead,
+			Query:       []openapi.Param{{Name: "token", Description: "stream token from POST /logs/stream/token, for clients that can't send headers"}},
+			ContentType: "text/event-stream"},
+		openapi.Op{Method: http.MethodPost, Path: "/logs/stream/token", Summary: "Short-lived token for opening the event stream", Auth: scoped, Scopes: logsRead,
+			Response: auth.StreamTokenResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/logs/entries", Summary: "Log a food", Auth: scoped, Scopes: logsWrite,
+			Body: logs.CreateEntryRequest{}, Response: logs.CreateEntryResponse{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodDelete, Path: "/logs/entries/:id", Summary: "Delete an entry", Auth: scoped, Scopes: logsWrite,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodPost, Path: "/logs/copy", Summary: "Copy entries between days", Auth: scoped, Scopes: logsWrite,
+			Body: logs.CopyEntriesRequest{}, Response: logs.CreateEntriesResponse{}, Status: http.StatusCreated},
+
+		openapi.Op{Method: http.MethodGet, Path: "/logs/saved-meals", Summary: "List saved meals", Auth: scoped, Scopes: logsRead,
+			Response: logs.SavedMealListResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/logs/saved-meals", Summary: "Create a saved meal", Auth: scoped, Scopes: logsWrite,
+			Body: logs.CreateSavedMealRequest{}, Response: logs.SavedMeal{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodPost, Path: "/logs/saved-meals/from-day", Summary: "Save a logged meal", Auth: scoped, Scopes: logsWrite,
+			Body: logs.SaveMealFromDayRequest{}, Response: logs.SavedMeal{}, Status: http.StatusCreated},
+		openapi.Op{Method: http.MethodGet, Path: "/logs/saved-meals/:id", Summary: "Get a saved meal", Auth: scoped, Scopes: logsRead,
+			Response: logs.SavedMeal{}},
+		openapi.Op{Method: http.MethodDelete, Path: "/logs/saved-meals/:id", Summary: "Delete a saved meal", Auth: scoped, Scopes: logsWrite,
+			Status: http.StatusNoContent},
+		openapi.Op{Method: http.MethodPost, Path: "/logs/saved-meals/:id/log", Summary: "Log a saved meal", Auth: scoped, Scopes: logsWrite,
+			Body: logs.LogSavedMealRequest{}, Response: logs.CreateEntriesResponse{}, Status: http.StatusCreated},
+
+		openapi.Op{Method: http.MethodGet, Path: "/sync", Summary: "Changes since a cursor", Auth: scoped, Scopes: syncRead,
+			Query: []openapi.Param{{Name: "since"}}, Response: logs.SyncResponse{}},
+		openapi.Op{Method: http.MethodPost, Path: "/sync", Summary: "Push offline changes", Auth: scoped, Scopes: syncWrite,
+			Body: logs.SyncPushRequest{}, Response: logs.SyncPushResponse{}},
+	)
+	return d
+}
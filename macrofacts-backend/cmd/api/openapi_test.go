@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/goals"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/idempotency"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/logs"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/webhooks"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/weight"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/openapi.golden.json")
+
+// testRouter registers the real routes against services with no backing
+// stores; nothing is called, only the route table is inspected.
+func testRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	authSvc := auth.NewService(nil, []byte("test"))
+	foodsSvc := foods.NewService(nil, nil, nil)
+	goalsSvc := goals.NewService(nil, authSvc)
+	logsSvc := logs.NewService(nil, foodsSvc, authSvc, goalsSvc, nil)
+	limits := httpapi.NewMemoryStore(0)
+	t.Cleanup(limits.Close)
+
+	r := gin.New()
+	registerRoutes(r.Group("/api"), app{
+		authSvc:         authSvc,
+		authHandler:     auth.NewHandler(authSvc),
+		foodsHandler:    foods.NewHandler(foodsSvc),
+		goalsHandler:    goals.NewHandler(goalsSvc),
+		logsHandler:     logs.NewHandler(logsSvc),
+		webhooksHandler: webhooks.NewHandler(webhooks.NewService(nil)),
+		weightHandler:   weight.NewHandler(weight.NewService(nil, logsSvc, authSvc, nil)),
+		idemStore:       idempotency.NewStore(nil, 0),
+		limitStore:      limits,
+	})
+	return r
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	if err := apiSpec().CheckRoutes(testRouter(t).Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A struct change shows up as a golden diff; review it and run
+// go test ./cmd/api -run TestSpecGolden -update.
+func TestSpecGolden(t *testing.T) {
+	got, err := apiSpec().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "openapi.golden.json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("generated spec differs from %s; if the change is intended, rerun with -update", path)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/goals"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/idempotency"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/logs"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/webhooks"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/weight"
+)
+
+// app is everything the routes are wired to.
+type app struct {
+	authSvc         *auth.Service
+	authHandler     *auth.Handler
+	foodsHandler    *foods.Handler
+	goalsHandler    *goals.Handler
+	logsHandler     *logs.Handler
+	webhooksHandler *webhooks.Handler
+	weightHandler   *weight.Handler
+	idemStore       *idempotency.Store
+	limitStore      httpapi.LimiterStore
+	// Pre-rendered apiSpec, served at /api/openapi.json.
+	spec []byte
+}
+
+// registerRoutes mounts the API under api. Every route here must also be in
+// apiSpec; openapi_test.go checks that.
+func registerRoutes(api *gin.RouterGroup, a app) {
+	api.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"ok": true}) })
+	api.GET("/openapi.json", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", a.spec) })
+
+	// Rate limits; override with RATE_LIMIT_<NAME>=N/unit[:burst], e.g. RATE_LIMIT_AUTH=10/m.
+	authIPLimit := rateLimiter("auth_ip", "30/m:10", httpapi.KeyByIP, a.limitStore)
+	authLimit := rateLimiter("auth", "5/m", httpapi.KeyByIPAndUsername, a.limitStore)
+	twoFactorLimit := rateLimiter("auth_2fa", "5/m", a.authSvc.ChallengeRateKey, a.limitStore)
+	searchLimit := rateLimiter("search", "120/m:30", httpapi.KeyByUserOrIP, a.limitStore)
+	userLimit := rateLimiter("user", "300/m:60", httpapi.KeyByUserOrIP, a.limitStore)
+
+	api.POST("/auth/register", authIPLimit.Middleware(), authLimit.Middleware(), a.authHandler.Register)
+	api.POST("/auth/login", authIPLimit.Middleware(), authLimit.Middleware(), a.authHandler.Login)
+	api.POST("/auth/login/2fa", authIPLimit.Middleware(), twoFactorLimit.Middleware(), a.authHandler.LoginTwoFactor)
+	api.GET("/auth/oidc/start", authIPLimit.Middleware(), a.authHandler.StartSSO)
+	api.POST("/auth/oidc/callback", authIPLimit.Middleware(), a.authHandler.FinishSSO)
+
+	// authRequired is session-only. The scoped variants also accept personal
+	// access tokens holding those scopes.
+	authRequired := a.authSvc.Middleware()
+	logsRead := a.authSvc.Middleware(auth.ScopeLogsRead)
+	logsWrite := a.authSvc.Middleware(auth.ScopeLogsWrite)
+	foodsRead := a.authSvc.Middleware(auth.ScopeFoodsRead)
+	foodsWrite := a.authSvc.Middleware(auth.ScopeFoodsWrite)
+	weightRead := a.authSvc.Middleware(auth.ScopeWeightRead)
+	weightWrite := a.authSvc.Middleware(auth.ScopeWeightWrite)
+	settingsRead := a.authSvc.Middleware(auth.ScopeSettingsRead)
+	settingsWrite := a.authSvc.Middleware(auth.ScopeSettingsWrite)
+	// Sync covers entries, custom foods and settings together.
+	syncRead := a.authSvc.Middleware(auth.ScopeLogsRead, auth.ScopeFoodsRead, auth.ScopeSettingsRead)
+	syncWrite := a.authSvc.Middleware(auth.ScopeLogsWrite, auth.ScopeFoodsWrite, auth.ScopeSettingsWrite)
+	userLimited := userLimit.Middleware()
+	authOptional := a.authSvc.OptionalMiddleware()
+	idempotent := a.idemStore.Middleware()
+
+	api.GET("/me", settingsRead, userLimited, a.authHandler.Me)
+	api.POST("/me/2fa/totp", authRequired, userLimited, a.authHandler.EnrollTOTP)
+	api.POST("/me/2fa/totp/confirm", authRequired, userLimited, a.authHandler.ConfirmTOTP)
+	api.POST("/me/2fa/totp/disable", authRequired, userLimited, a.authHandler.DisableTOTP)
+	api.POST("/me/2fa/recovery-codes", authRequired, userLimited, a.authHandler.RegenerateRecoveryCodes)
+	api.POST("/me/sso/link", authRequired, userLimited, a.authHandler.LinkSSO)
+	api.GET("/me/tokens", authRequired, userLimited, a.authHandler.ListTokens)
+	api.POST("/me/tokens", authRequired, userLimited, a.authHandler.CreateToken)
+	api.DELETE("/me/tokens/:id", authRequired, userLimited, a.authHandler.RevokeToken)
+	api.GET("/me/settings", settingsRead, userLimited, a.authHandler.MeSettings)
+	api.PATCH("/me/settings", settingsWrite, userLimited, a.authHandler.UpdateSettings)
+	api.GET("/me/goals/history", settingsRead, userLimited, a.authHandler.GoalHistory)
+	api.GET("/me/settings/meals", settingsRead, userLimited, a.logsHandler.MealSlots)
+	api.PUT("/me/settings/meals", settingsWrite, userLimited, a.logsHandler.UpdateMealSlots)
+
+	api.POST("/me/goals/wizard", settingsRead, userLimited, a.goalsHandler.Wizard)
+	api.POST("/me/goals/wizard/apply", settingsWrite, userLimited, a.goalsHandler.Accept)
+	api.GET("/me/goals/profiles", settingsRead, userLimited, a.goalsHandler.ListProfiles)
+	api.POST("/me/goals/profiles", settingsWrite, userLimited, a.goalsHandler.CreateProfile)
+	api.PATCH("/me/goals/profiles/:id", settingsWrite, userLimited, a.goalsHandler.UpdateProfile)
+	api.DELETE("/me/goals/profiles/:id", settingsWrite, userLimited, a.goalsHandler.DeleteProfile)
+	api.GET("/me/goals/schedule", settingsRead, userLimited, a.goalsHandler.GetSchedule)
+	api.PUT("/me/goals/schedule", settingsWrite, userLimited, a.goalsHandler.SetSchedule)
+	api.PUT("/me/goals/overrides/:date", settingsWrite, userLimited, a.goalsHandler.SetOverride)
+	api.DELETE("/me/goals/overrides/:date", settingsWrite, userLimited, a.goalsHandler.DeleteOverride)
+
+	api.GET("/me/webhooks", authRequired, userLimited, a.webhooksHandler.List)
+	api.POST("/me/webhooks", authRequired, userLimited, a.webhooksHandler.Create)
+	api.PATCH("/me/webhooks/:id", authRequired, userLimited, a.webhooksHandler.Update)
+	api.DELETE("/me/webhooks/:id", authRequired, userLimited, a.webhooksHandler.Delete)
+	api.GET("/me/webhooks/:id/deliveries", authRequired, userLimited, a.webhooksHandler.Deliveries)
+
+	api.GET("/me/weight", weightRead, userLimited, a.weightHandler.List)
+	api.POST("/me/weight", weightWrite, userLimited, a.weightHandler.Log)
+	api.DELETE("/me/weight/:date", weightWrite, userLimited, a.weightHandler.Delete)
+	api.GET("/me/energy-expenditure", weightRead, userLimited, a.weightHandler.EnergyExpenditure)
+	api.POST("/me/energy-expenditure/apply", weightWrite, userLimited, a.weightHandler.ApplySuggestion)
+
+	api.GET("/foods/search", authOptional, searchLimit.Middleware(), a.foodsHandler.Search)
+	api.GET("/foods/barcode/:code", a.foodsHandler.ByBarcode)
+	api.POST("/foods", foodsWrite, userLimited, idempotent, a.foodsHandler.CreateCustom)
+	api.POST("/foods/custom", foodsWrite, userLimited, idempotent, a.foodsHandler.CreateCustom)
+	api.GET("/foods/favorites", foodsRead, userLimited, a.logsHandler.ListFavorites)
+	api.POST("/foods/favorites", foodsWrite, userLimited, idempotent, a.logsHandler.AddFavorite)
+	api.DELETE("/foods/favorites/:source/:ref", foodsWrite, userLimited, idempotent, a.logsHandler.RemoveFavorite)
+	api.GET("/foods/frequent", foodsRead, userLimited, a.logsHandler.FrequentFoods)
+
+	api.GET("/recipes", foodsRead, userLimited, a.foodsHandler.ListRecipes)
+	api.POST("/recipes", foodsWrite, userLimited, idempotent, a.foodsHandler.CreateRecipe)
+	api.GET("/recipes/:id", foodsRead, userLimited, a.foodsHandler.GetRecipe)
+	api.PUT("/recipes/:id", foodsWrite, userLimited, idempotent, a.foodsHandler.UpdateRecipe)
+	api.DELETE("/recipes/:id", foodsWrite, userLimited, idempotent, a.foodsHandler.DeleteRecipe)
+
+	api.GET("/logs/today", logsRead, userLimited, a.logsHandler.Today)
+	api.GET("/logs/days/:date", logsRead, userLimited, a.logsHandler.Day)
+	api.GET("/logs/summary", logsRead, userLimited, a.logsHandler.Summary)
+	api.GET("/logs/stream", a.authSvc.StreamMiddleware(auth.ScopeLogsRead), userLimited, a.logsHandler.Stream)
+	api.POST("/logs/stream/token", logsRead, userLimited, a.authHandler.StreamToken)
+	api.POST("/logs/entries", logsWrite, userLimited, idempotent, a.logsHandler.CreateEntry)
+	api.DELETE("/logs/entries/:id", logsWrite, userLimited, idempotent, a.logsHandler.DeleteEntry)
+	api.POST("/logs/copy", logsWrite, userLimited, idempotent, a.logsHandler.CopyEntries)
+
+	api.GET("/logs/saved-meals", logsRead, userLimited, a.logsHandler.ListSavedMeals)
+	api.POST("/logs/saved-meals", logsWrite, userLimited, idempotent, a.logsHandler.CreateSavedMeal)
+	api.POST("/logs/saved-meals/from-day", logsWrite, userLimited, idempotent, a.logsHandler.SaveMealFromDay)
+	api.GET("/logs/saved-meals/:id", logsRead, userLimited, a.logsHandler.GetSavedMeal)
+	api.DELETE("/logs/saved-meals/:id", logsWrite, userLimited, idempotent, a.logsHandler.DeleteSavedMeal)
+	api.POST("/logs/saved-meals/:id/log", logsWrite, userLimited, idempotent, a.logsHandler.LogSavedMeal)
+
+	api.GET("/sync", syncRead, userLimited, a.logsHandler.SyncPull)
+	api.POST("/sync", syncWrite, userLimited, idempotent, a.logsHandler.SyncPush)
+}
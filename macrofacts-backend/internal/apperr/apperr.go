@@ -0,0 +1,106 @@
+// Package apperr defines the domain errors services return. Each carries a
+// Kind, which decides the HTTP status, and a stable Code clients can switch
+// on; the Message is for humans and may change.
+package apperr
+
+import "errors"
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindNotFound
+	KindConflict
+	KindForbidden
+	KindUnauthorized
+	// An upstream dependency (e.g. an identity provider) failed.
+	KindUnavailable
+)
+
+// Default codes per kind; constructors that take a code override them.
+const (
+	CodeInternal     = "INTERNAL"
+	CodeValidation   = "VALIDATION_FAILED"
+	CodeNotFound     = "NOT_FOUND"
+	CodeConflict     = "CONFLICT"
+	CodeForbidden    = "FORBIDDEN"
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeUnavailable  = "UPSTREAM_UNAVAILABLE"
+)
+
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Fields maps request field names (JSON names) to what's wrong with each.
+	Fields map[string]string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Invalid is a validation failure not tied to one field.
+func Invalid(msg string) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidation, Message: msg}
+}
+
+// InvalidField is a validation failure of one request field.
+func InvalidField(field, msg string) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidation, Message: msg, Fields: map[string]string{field: msg}}
+}
+
+// InvalidFields reports several field errors at once. It returns nil when
+// fields is empty, so callers can collect and return unconditionally.
+func InvalidFields(fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &Error{Kind: KindValidation, Code: CodeValidation, Message: "validation failed", Fields: fields}
+}
+
+func NotFound(msg string) *Error {
+	return &Error{Kind: KindNotFound, Code: CodeNotFound, Message: msg}
+}
+
+func Conflict(code, msg string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: msg}
+}
+
+func Forbidden(msg string) *Error {
+	return &Error{Kind: KindForbidden, Code: CodeForbidden, Message: msg}
+}
+
+func Unauthorized(msg string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: CodeUnauthorized, Message: msg}
+}
+
+func Unavailable(msg string) *Error {
+	return &Error{Kind: KindUnavailable, Code: CodeUnavailable, Message: msg}
+}
+
+// Internal is a server-side failure; the message is safe to show but says little.
+func Internal(msg string) *Error {
+	return &Error{Kind: KindInternal, Code: CodeInternal, Message: msg}
+}
+
+// WithCode returns a copy with a more specific code.
+func (e *Error) WithCode(code string) *Error {
+	cp := *e
+	cp.Code = code
+	return &cp
+}
+
+// As returns err as an *Error, if it is (or wraps) one.
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// KindOf reports err's kind; untyped errors are internal.
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
@@ -0,0 +1,35 @@
+package auth
+
+import "sort"
+
+// GoalTimeline resolves which goal version applied on a given date.
+type GoalTimeline struct {
+	versions []Goals // sorted by EffectiveFrom asc
+	fallback *Goals
+}
+
+// NewGoalTimeline builds a timeline from versions sorted by EffectiveFrom asc.
+func NewGoalTimeline(versions []Goals) GoalTimeline {
+	return GoalTimeline{versions: versions}
+}
+
+// At returns the goals in effect on date (YYYY-MM-DD). Dates before the first
+// version use the first version, so days logged before history existed are
+// judged against the oldest goals we know of rather than today's.
+func (t GoalTimeline) At(date string) (Goals, bool) {
+	if len(t.versions) == 0 {
+		if t.fallback != nil {
+			return *t.fallback, true
+		}
+		return Goals{}, false
+	}
+
+	// First version starting after date; the one before it is in effect.
+	i := sort.Search(len(t.versions), func(i int) bool {
+		return t.versions[i].EffectiveFrom > date
+	})
+	if i == 0 {
+		return t.versions[0], true
+	}
+	return t.versions[i-1], true
+}
@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
@@ -22,7 +25,7 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 	if err := h.svc.Register(req.Username, req.Password); err != nil {
-		httpapi.BadRequest(c, err.Error(), nil)
+		httpapi.Error(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"status": "ok"})
@@ -34,12 +37,73 @@ func (h *Handler) Login(c *gin.Context) {
 		httpapi.BadRequest(c, "invalid json", nil)
 		return
 	}
-	token, err := h.svc.Login(req.Username, req.Password)
+	resp, err := h.svc.Login(req.Username, req.Password, c.ClientIP())
 	if err != nil {
-		httpapi.BadRequest(c, err.Error(), nil)
+		loginError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, LoginResponse{Token: token})
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+	resp, err := h.svc.CompleteLogin(req.ChallengeToken, req.Code, c.ClientIP())
+	if err != nil {
+		loginError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) StartSSO(c *gin.Context) {
+	resp, err := h.svc.StartSSO(c.Request.Context(), "")
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// LinkSSO starts the same flow for a signed-in user; the callback links the identity to them.
+func (h *Handler) LinkSSO(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.StartSSO(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) FinishSSO(c *gin.Context) {
+	var req SSOCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+	// Public route, but a link flow needs the session that started it.
+	resp, err := h.svc.FinishSSO(c.Request.Context(), req.Code, req.State, h.svc.sessionUserID(c), c.ClientIP())
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func loginError(c *gin.Context, err error) {
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		retry := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retry))
+		httpapi.WriteError(c, http.StatusTooManyRequests, "LOGIN_THROTTLED", err.Error(),
+			map[string]any{"retry_after_seconds": retry})
+		return
+	}
+	httpapi.Error(c, err)
 }
 
 func (h *Handler) Me(c *gin.Context) {
@@ -52,7 +116,7 @@ func (h *Handler) MeSettings(c *gin.Context) {
 	uid := c.GetString("userId")
 	s, err := h.svc.GetSettings(uid)
 	if err != nil {
-		httpapi.BadRequest(c, err.Error(), nil)
+		httpapi.Error(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, s)
@@ -69,8 +133,122 @@ func (h *Handler) UpdateSettings(c *gin.Context) {
 
 	s, err := h.svc.UpdateSettings(uid, req)
 	if err != nil {
-		httpapi.BadRequest(c, err.Error(), nil)
+		httpapi.Error(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, s)
 }
+
+func (h *Handler) GoalHistory(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.GoalHistory(uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.EnrollTOTP(uid, c.GetString("username"))
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+	resp, err := h.svc.ConfirmTOTP(uid, req.Code)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+	if err := h.svc.DisableTOTP(uid, c.GetString("username"), req.Code, c.ClientIP()); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+	resp, err := h.svc.RegenerateRecoveryCodes(uid, c.GetString("username"), req.Code, c.ClientIP())
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// StreamToken hands out a token for opening /logs/stream from a browser.
+func (h *Handler) StreamToken(c *gin.Context) {
+	resp, err := h.svc.IssueStreamToken(c.GetString("userId"), c.GetString("username"))
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) ListTokens(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.ListTokens(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) CreateToken(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+	resp, err := h.svc.CreateToken(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (h *Handler) RevokeToken(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	if err := h.svc.RevokeToken(c.Request.Context(), uid, id); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
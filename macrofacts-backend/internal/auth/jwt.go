@@ -9,12 +9,24 @@ import (
 
 type Claims struct {
 	Username string `json:"username"`
+	// Purpose marks restricted tokens (e.g. a 2FA challenge). Session tokens leave it empty.
+	Purpose string `json:"pur,omitempty"`
 	jwt.RegisteredClaims
 }
 
+const (
+	purposeTwoFactor = "2fa"
+	purposeStream    = "stream"
+)
+
 func IssueToken(secret []byte, userID string, username string, exp time.Time) (string, error) {
+	return issueToken(secret, userID, username, "", exp)
+}
+
+func issueToken(secret []byte, userID, username, purpose string, exp time.Time) (string, error) {
 	claims := Claims{
 		Username: username,
+		Purpose:  purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID,
 			ExpiresAt: jwt.NewNumericDate(exp),
@@ -25,7 +37,12 @@ func IssueToken(secret []byte, userID string, username string, exp time.Time) (s
 	return t.SignedString(secret)
 }
 
+// ParseToken accepts session tokens only.
 func ParseToken(secret []byte, raw string) (userID string, username string, err error) {
+	return parseToken(secret, raw, "")
+}
+
+func parseToken(secret []byte, raw, purpose string) (userID string, username string, err error) {
 	tok, err := jwt.ParseWithClaims(raw, &Claims{}, func(token *jwt.Token) (any, error) {
 		if token.Method != jwt.SigningMethodHS256 {
 			return nil, errors.New("unexpected signing method")
@@ -37,7 +54,7 @@ func ParseToken(secret []byte, raw string) (userID string, username string, err
 	}
 
 	claims, ok := tok.Claims.(*Claims)
-	if !ok || !tok.Valid {
+	if !ok || !tok.Valid || claims.Purpose != purpose {
 		return "", "", errors.New("invalid token")
 	}
 
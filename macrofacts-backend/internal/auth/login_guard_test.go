@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name        string
+		ip, account loginFailureStats
+		wantOutcome string
+		wantWait    time.Duration
+	}{
+		{"clean", loginFailureStats{}, loginFailureStats{}, "", 0},
+		{"below delay threshold", loginFailureStats{}, loginFailureStats{2, ago(0)}, "", 0},
+		{"first delay", loginFailureStats{}, loginFailureStats{3, ago(0)}, loginThrottled, time.Second},
+		{"delay doubles", loginFailureStats{}, loginFailureStats{5, ago(time.Second)}, loginThrottled, 3 * time.Second},
+		{"delay elapsed", loginFailureStats{}, loginFailureStats{5, ago(5 * time.Second)}, "", 0},
+		{"delay capped", loginFailureStats{}, loginFailureStats{9, ago(0)}, loginThrottled, maxLoginDelay},
+		{"account locked", loginFailureStats{}, loginFailureStats{accountLockAfter, ago(5 * time.Minute)}, loginLocked, 10 * time.Minute},
+		{"account lock expired", loginFailureStats{}, loginFailureStats{accountLockAfter, ago(lockoutFor)}, "", 0},
+		{"busy ip, clean account", loginFailureStats{ipSuspectAfter * 10, ago(0)}, loginFailureStats{}, "", 0},
+		{"busy ip, first failure", loginFailureStats{ipSuspectAfter, ago(0)}, loginFailureStats{1, ago(0)}, loginThrottled, time.Second},
+		{"busy ip, delay doubles", loginFailureStats{ipSuspectAfter, ago(0)}, loginFailureStats{3, ago(time.Second)}, loginThrottled, 3 * time.Second},
+		{"busy ip, account locked", loginFailureStats{ipSuspectAfter, ago(0)}, loginFailureStats{accountLockAfter, ago(0)}, loginLocked, lockoutFor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, outcome := throttle(now, tt.ip, tt.account)
+			if outcome != tt.wantOutcome {
+				t.Fatalf("outcome = %q, want %q", outcome, tt.wantOutcome)
+			}
+			if tt.wantOutcome == "" {
+				if blocked != nil {
+					t.Fatalf("blocked = %+v, want nil", blocked)
+				}
+				return
+			}
+			if blocked.RetryAfter != tt.wantWait {
+				t.Errorf("RetryAfter = %v, want %v", blocked.RetryAfter, tt.wantWait)
+			}
+			if blocked.Locked != (tt.wantOutcome == loginLocked) {
+				t.Errorf("Locked = %v", blocked.Locked)
+			}
+		})
+	}
+}
+
+// loginRepo serves one shared IP's failure count and per-account counts.
+type loginRepo struct {
+	store
+	ip       loginFailureStats
+	accounts map[string]loginFailureStats
+	users    map[string]User
+	outcomes []string
+}
+
+func (r *loginRepo) IPLoginFailures(context.Context, string, time.Time) (loginFailureStats, error) {
+	return r.ip, nil
+}
+
+func (r *loginRepo) AccountLoginFailures(_ context.Context, username string, _ time.Time) (loginFailureStats, error) {
+	return r.accounts[username], nil
+}
+
+func (r *loginRepo) GetUserByUsername(_ context.Context, username string) (User, error) {
+	u, ok := r.users[username]
+	if !ok {
+		return User{}, errors.New("not found")
+	}
+	return u, nil
+}
+
+func (r *loginRepo) GetTOTP(context.Context, string) (totpState, bool, error) {
+	return totpState{}, false, nil
+}
+
+func (r *loginRepo) InsertLoginEvent(_ context.Context, _ string, _ *string, _, outcome string) error {
+	r.outcomes = append(r.outcomes, outcome)
+	return nil
+}
+
+// Behind a proxy every client shares an IP. Someone hammering one account
+// must not lock the others out.
+func TestBusyIPDoesNotLockOtherAccounts(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &loginRepo{
+		ip: loginFailureStats{Failures: ipSuspectAfter + 25, LastFailure: now},
+		accounts: map[string]loginFailureStats{
+			"MALLORY_TARGET": {Failures: 4, LastFailure: now},
+		},
+		users: map[string]User{"BOB": {ID: "u2", Username: "BOB", PasswordHash: string(hash)}},
+	}
+	svc := &Service{repo: repo, jwtSecret: []byte("test"), now: func() time.Time { return now }}
+
+	resp, err := svc.Login("bob", "correct horse", "10.0.0.2")
+	if err != nil || resp.Token == "" {
+		t.Fatalf("Login = %+v, %v; want a session", resp, err)
+	}
+
+	// The account under attack is still slowed down.
+	_, err = svc.Login("mallory_target", "guess", "10.0.0.2")
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) || throttled.Locked {
+		t.Fatalf("err = %v, want a delay", err)
+	}
+	if want := []string{loginSuccess, loginThrottled}; fmt.Sprint(repo.outcomes) != fmt.Sprint(want) {
+		t.Fatalf("audit = %v, want %v", repo.outcomes, want)
+	}
+}
@@ -1,30 +1,60 @@
 package auth
 
 import (
+	"encoding/json"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
 )
 
-func (s *Service) Middleware() gin.HandlerFunc {
+// Middleware requires a session JWT or a personal access token. Access
+// tokens must hold every scope listed; with no scopes the route is
+// session-only and access tokens are refused.
+func (s *Service) Middleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authz := strings.TrimSpace(c.GetHeader("Authorization"))
 		if authz == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization"})
+			httpapi.Unauthorized(c, "missing authorization")
 			return
 		}
 
 		parts := strings.SplitN(authz, " ", 2)
 		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization"})
+			httpapi.Unauthorized(c, "invalid authorization")
 			return
 		}
+		raw := strings.TrimSpace(parts[1])
 
-		userID, username, err := s.ParseToken(parts[1])
-		if err != nil || userID == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			return
+		var userID, username string
+		if isAccessToken(raw) {
+			tok, err := s.verifyAccessToken(c.Request.Context(), raw)
+			if err != nil {
+				httpapi.Unauthorized(c, "invalid token")
+				return
+			}
+			if len(scopes) == 0 {
+				httpapi.WriteError(c, http.StatusForbidden, "SCOPE_REQUIRED", "access tokens cannot use this endpoint", nil)
+				return
+			}
+			for _, sc := range scopes {
+				if !slices.Contains(tok.Scopes, sc) {
+					httpapi.WriteError(c, http.StatusForbidden, "SCOPE_REQUIRED", "token lacks scope "+sc,
+						map[string]any{"scope": sc})
+					return
+				}
+			}
+			userID, username = tok.UserID, tok.Username
+			c.Set("tokenId", tok.ID)
+		} else {
+			var err error
+			userID, username, err = s.ParseToken(raw)
+			if err != nil || userID == "" {
+				httpapi.Unauthorized(c, "invalid token")
+				return
+			}
 		}
 
 		// IMPORTANT: handlers expect snake_case keys
@@ -37,3 +67,68 @@ func (s *Service) Middleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalMiddleware identifies the user when a valid bearer token is sent but
+// lets the request through either way. Use it on public routes that behave
+// better for signed-in users. Access tokens need foods:read to be recognised.
+func (s *Service) OptionalMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authz := strings.TrimSpace(c.GetHeader("Authorization"))
+		parts := strings.SplitN(authz, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			raw := strings.TrimSpace(parts[1])
+			var userID, username string
+			if isAccessToken(raw) {
+				if tok, err := s.verifyAccessToken(c.Request.Context(), raw); err == nil && slices.Contains(tok.Scopes, ScopeFoodsRead) {
+					userID, username = tok.UserID, tok.Username
+				}
+			} else if id, name, err := s.ParseToken(raw); err == nil {
+				userID, username = id, name
+			}
+			if userID != "" {
+				c.Set("user_id", userID)
+				c.Set("username", username)
+				c.Set("userId", userID)
+			}
+		}
+		c.Next()
+	}
+}
+
+// sessionUserID returns the user of a valid session token in the request, or
+// "". Access tokens don't count: they can't start an SSO link either.
+func (s *Service) sessionUserID(c *gin.Context) string {
+	parts := strings.SplitN(strings.TrimSpace(c.GetHeader("Authorization")), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	raw := strings.TrimSpace(parts[1])
+	if isAccessToken(raw) {
+		return ""
+	}
+	userID, _, err := s.ParseToken(raw)
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
+// ChallengeRateKey is the rate-limit key for /auth/login/2fa: client IP plus
+// the user the challenge was issued to, so fresh challenges don't reset the
+// count. Invalid or expired challenges share one bucket per IP.
+func (s *Service) ChallengeRateKey(c *gin.Context) string {
+	key := httpapi.KeyByIP(c) + "|c:"
+	body, err := httpapi.PeekBody(c)
+	if err != nil {
+		return key
+	}
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+	}
+	_ = json.Unmarshal(body, &req)
+	userID, _, err := parseToken(s.jwtSecret, strings.TrimSpace(req.ChallengeToken), purposeTwoFactor)
+	if err != nil {
+		return key
+	}
+	return key + userID
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChallengeRateKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := &Service{jwtSecret: []byte("test")}
+	challenge := func(userID string) string {
+		tok, err := issueToken(svc.jwtSecret, userID, "name", purposeTwoFactor, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	r := gin.New()
+	var key, body string
+	r.POST("/", func(c *gin.Context) {
+		key = svc.ChallengeRateKey(c)
+		b, _ := io.ReadAll(c.Request.Body)
+		body = string(b)
+	})
+	keyFor := func(remote, payload string) string {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+		req.RemoteAddr = remote
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if body != payload {
+			t.Fatalf("handler saw body %q, want %q", body, payload)
+		}
+		return key
+	}
+
+	alice1 := keyFor("203.0.113.7:1", `{"challengeToken":"`+challenge("alice")+`","code":"123456"}`)
+	alice2 := keyFor("203.0.113.7:2", `{"challengeToken":"`+challenge("alice")+`","code":"654321"}`)
+	bob := keyFor("203.0.113.7:3", `{"challengeToken":"`+challenge("bob")+`","code":"123456"}`)
+	if alice1 != alice2 {
+		t.Errorf("fresh challenge changed the key: %q vs %q", alice1, alice2)
+	}
+	if alice1 == bob {
+		t.Errorf("different users share key %q", bob)
+	}
+
+	// Session tokens, garbage and empty bodies all land in the per-IP bucket.
+	session, _ := issueToken(svc.jwtSecret, "alice", "name", "", time.Now().Add(time.Minute))
+	for _, payload := range []string{`{"challengeToken":"` + session + `"}`, `{"challengeToken":"nope"}`, `not json`, ``} {
+		if got := keyFor("203.0.113.7:4", payload); got != "ip:203.0.113.7|c:" {
+			t.Errorf("payload %q: key = %q", payload, got)
+		}
+	}
+}
+
+func TestStreamMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+	svc := &Service{jwtSecret: []byte("test"), now: func() time.Time { return now }}
+
+	r := gin.New()
+	r.GET("/stream", svc.StreamMiddleware(ScopeLogsRead), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userId"))
+	})
+	get := func(query, bearer string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/stream"+query, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	st, err := svc.IssueStreamToken("alice", "ALICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.ExpiresAt.Equal(now.Add(streamTokenTTL).UTC()) {
+		t.Errorf("ExpiresAt = %v", st.ExpiresAt)
+	}
+	session, _ := IssueToken(svc.jwtSecret, "bob", "BOB", now.Add(time.Hour))
+	expired, _ := issueToken(svc.jwtSecret, "alice", "ALICE", purposeStream, now.Add(-time.Second))
+
+	tests := []struct {
+		name, query, bearer string
+		wantCode            int
+		wantUser            string
+	}{
+		{"stream token in query", "?token=" + st.Token, "", http.StatusOK, "alice"},
+		{"session header", "", session, http.StatusOK, "bob"},
+		{"header wins over query", "?token=" + st.Token, session, http.StatusOK, "bob"},
+		// A session token must not travel in URLs, and a stream token opens nothing else.
+		{"session token in query", "?token=" + session, "", http.StatusUnauthorized, ""},
+		{"stream token as header", "", st.Token, http.StatusUnauthorized, ""},
+		{"expired stream token", "?token=" + expired, "", http.StatusUnauthorized, ""},
+		{"nothing", "", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := get(tt.query, tt.bearer)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", code, tt.wantCode, body)
+			}
+			if tt.wantCode == http.StatusOK && body != tt.wantUser {
+				t.Fatalf("user = %q, want %q", body, tt.wantUser)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -10,8 +12,42 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// LoginResponse carries either a session token or, for 2FA users, a
+// challenge token to send to /auth/login/2fa with a code.
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
+}
+
+type SSOStartResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// SSOCallbackRequest is what the IdP redirected back to the client with.
+type SSOCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorCodeRequest confirms a sensitive 2FA change with a TOTP or recovery code.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
 }
 
 type MeResponse struct {
@@ -34,3 +70,52 @@ type UpdateSettingsRequest struct {
 	CarbsGoalG   *int    `json:"carbsGoalG,omitempty"`
 	FatGoalG     *int    `json:"fatGoalG,omitempty"`
 }
+
+// Goals is one version of a user's targets. It applies from EffectiveFrom
+// (YYYY-MM-DD, user's timezone) until the next version starts.
+type Goals struct {
+	EffectiveFrom string `json:"effectiveFrom"`
+	CalorieGoal   int    `json:"calorieGoal"`
+	ProteinGoalG  int    `json:"proteinGoalG"`
+	CarbsGoalG    int    `json:"carbsGoalG"`
+	FatGoalG      int    `json:"fatGoalG"`
+}
+
+type GoalHistoryResponse struct {
+	Items []Goals `json:"items"`
+}
+
+// AccessToken describes a personal access token; the secret itself is only
+// returned once, by CreateToken.
+type AccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+type TokenListResponse struct {
+	Items []AccessToken `json:"items"`
+}
+
+type CreateTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Omit for a token that never expires.
+	ExpiresInDays *int `json:"expiresInDays,omitempty"`
+}
+
+type CreateTokenResponse struct {
+	Token string `json:"token"`
+	AccessToken
+}
+
+// StreamTokenResponse is a short-lived token for ?token= on /logs/stream,
+// for clients such as EventSource that can't send an Authorization header.
+type StreamTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
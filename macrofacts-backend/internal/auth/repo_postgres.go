@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 )
 
 type Repo struct {
@@ -28,9 +32,26 @@ func (r *Repo) CreateUser(ctx context.Context, username string, passwordHash str
 		return "", errors.New("username required")
 	}
 
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	id, err := createUser(ctx, tx, username, passwordHash)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func createUser(ctx context.Context, tx pgx.Tx, username string, passwordHash string) (string, error) {
 	// Insert defaults so brand-new users always have settings.
 	var id string
-	err := r.db.QueryRow(ctx, `
+	err := tx.QueryRow(ctx, `
 		insert into users (
 			username,
 			password_hash,
@@ -47,6 +68,16 @@ func (r *Repo) CreateUser(ctx context.Context, username string, passwordHash str
 	if err != nil {
 		return "", ErrUsernameTaken
 	}
+
+	// Seed goal history so every day since sign-up has a version to resolve to.
+	if _, err := tx.Exec(ctx, `
+		insert into user_goals (user_id, effective_from, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g)
+		select id, created_at::date, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g
+		from users
+		where id = $1::uuid
+	`, id); err != nil {
+		return "", err
+	}
 	return id, nil
 }
 
@@ -65,6 +96,55 @@ func (r *Repo) GetUserByUsername(ctx context.Context, username string) (User, er
 	return u, nil
 }
 
+type loginFailureStats struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// AccountLoginFailures counts failed logins for username since `since`,
+// ignoring any before its most recent successful login.
+func (r *Repo) AccountLoginFailures(ctx context.Context, username string, since time.Time) (loginFailureStats, error) {
+	var st loginFailureStats
+	var last *time.Time
+	err := r.db.QueryRow(ctx, `
+		select count(*)::int, max(created_at)
+		from login_events
+		where username = $1
+		  and outcome = 'failure'
+		  and created_at > greatest($2::timestamptz, coalesce((
+			select max(created_at) from login_events
+			where username = $1 and outcome = 'success'
+		  ), '-infinity'::timestamptz))
+	`, username, since).Scan(&st.Failures, &last)
+	if last != nil {
+		st.LastFailure = *last
+	}
+	return st, err
+}
+
+// IPLoginFailures counts failed logins from ip since `since`, across all usernames.
+func (r *Repo) IPLoginFailures(ctx context.Context, ip string, since time.Time) (loginFailureStats, error) {
+	var st loginFailureStats
+	var last *time.Time
+	err := r.db.QueryRow(ctx, `
+		select count(*)::int, max(created_at)
+		from login_events
+		where ip = $1 and outcome = 'failure' and created_at > $2
+	`, ip, since).Scan(&st.Failures, &last)
+	if last != nil {
+		st.LastFailure = *last
+	}
+	return st, err
+}
+
+func (r *Repo) InsertLoginEvent(ctx context.Context, username string, userID *string, ip, outcome string) error {
+	_, err := r.db.Exec(ctx, `
+		insert into login_events (username, user_id, ip, outcome)
+		values ($1, $2::uuid, nullif($3, ''), $4)
+	`, username, userID, ip, outcome)
+	return err
+}
+
 func (r *Repo) GetSettings(ctx context.Context, userID string) (MeSettingsResponse, error) {
 	var s MeSettingsResponse
 
@@ -87,13 +167,34 @@ func (r *Repo) GetSettings(ctx context.Context, userID string) (MeSettingsRespon
 	)
 
 	if err != nil {
-		return MeSettingsResponse{}, errors.New("settings not found")
+		return MeSettingsResponse{}, apperr.NotFound("settings not found")
 	}
 	return s, nil
 }
 
-func (r *Repo) UpsertSettings(ctx context.Context, userID string, req UpdateSettingsRequest) error {
-	_, err := r.db.Exec(ctx, `
+// SyncVersions returns the user's latest sync version and the version at
+// which settings (and with them, goals) last changed.
+func (r *Repo) SyncVersions(ctx context.Context, userID string) (syncVersion int64, settingsVersion int64, err error) {
+	err = r.db.QueryRow(ctx, `
+		select sync_version, settings_version
+		from users
+		where id = $1::uuid
+	`, userID).Scan(&syncVersion, &settingsVersion)
+	return syncVersion, settingsVersion, err
+}
+
+// UpsertSettings updates the current settings on users. When any goal changes,
+// the resulting goal set is also versioned into user_goals from effectiveFrom on.
+// With a baseVersion, settings changed after it leave the row untouched and
+// return ErrSettingsChanged.
+func (r *Repo) UpsertSettings(ctx context.Context, userID string, req UpdateSettingsRequest, effectiveFrom time.Time, baseVersion *int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
 		update users
 		set
 			timezone       = coalesce($2, timezone, 'UTC'),
@@ -102,7 +203,64 @@ func (r *Repo) UpsertSettings(ctx context.Context, userID string, req UpdateSett
 			carbs_goal_g   = coalesce($5, carbs_goal_g, 200),
 			fat_goal_g     = coalesce($6, fat_goal_g, 70)
 		where id = $1::uuid
-	`, userID, req.Timezone, req.CalorieGoal, req.ProteinGoalG, req.CarbsGoalG, req.FatGoalG)
+		  and ($7::bigint is null or settings_version <= $7)
+	`, userID, req.Timezone, req.CalorieGoal, req.ProteinGoalG, req.CarbsGoalG, req.FatGoalG, baseVersion)
+	if err != nil {
+		return err
+	}
+	if baseVersion != nil && tag.RowsAffected() == 0 {
+		return ErrSettingsChanged
+	}
 
-	return err
+	if req.CalorieGoal != nil || req.ProteinGoalG != nil || req.CarbsGoalG != nil || req.FatGoalG != nil {
+		// Same-day edits overwrite that day's version instead of stacking up rows.
+		_, err = tx.Exec(ctx, `
+			insert into user_goals (user_id, effective_from, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g)
+			select id, $2::date, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g
+			from users
+			where id = $1::uuid
+			on conflict (user_id, effective_from)
+			do update set
+				calorie_goal   = excluded.calorie_goal,
+				protein_goal_g = excluded.protein_goal_g,
+				carbs_goal_g   = excluded.carbs_goal_g,
+				fat_goal_g     = excluded.fat_goal_g,
+				created_at     = now()
+		`, userID, effectiveFrom.Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListGoals returns every goal version that could apply on or before `to`,
+// oldest first.
+func (r *Repo) ListGoals(ctx context.Context, userID string, to time.Time) ([]Goals, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			to_char(effective_from, 'YYYY-MM-DD'),
+			calorie_goal,
+			protein_goal_g,
+			carbs_goal_g,
+			fat_goal_g
+		from user_goals
+		where user_id = $1::uuid and effective_from <= $2::date
+		order by effective_from asc
+	`, userID, to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Goals
+	for rows.Next() {
+		var g Goals
+		if err := rows.Scan(&g.EffectiveFrom, &g.CalorieGoal, &g.ProteinGoalG, &g.CarbsGoalG, &g.FatGoalG); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
 }
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// oidcState is a pending SSO login, keyed by its OAuth state parameter.
+type oidcState struct {
+	Verifier   string
+	Nonce      string
+	LinkUserID *string
+}
+
+func (r *Repo) InsertOIDCState(ctx context.Context, state string, st oidcState, expiresAt time.Time) error {
+	// Abandoned logins are cleaned up here rather than by a worker.
+	if _, err := r.db.Exec(ctx, `delete from oidc_login_states where expires_at < now()`); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(ctx, `
+		insert into oidc_login_states (state, code_verifier, nonce, link_user_id, expires_at)
+		values ($1, $2, $3, $4::uuid, $5)
+	`, state, st.Verifier, st.Nonce, st.LinkUserID, expiresAt)
+	return err
+}
+
+// TakeOIDCState deletes and returns an unexpired state, so each can be used once.
+func (r *Repo) TakeOIDCState(ctx context.Context, state string) (oidcState, bool, error) {
+	var st oidcState
+	err := r.db.QueryRow(ctx, `
+		delete from oidc_login_states
+		where state = $1 and expires_at > now()
+		returning code_verifier, nonce, link_user_id::text
+	`, state).Scan(&st.Verifier, &st.Nonce, &st.LinkUserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return oidcState{}, false, nil
+	}
+	if err != nil {
+		return oidcState{}, false, err
+	}
+	return st, true, nil
+}
+
+// UserByIdentity finds the account linked to an IdP subject.
+func (r *Repo) UserByIdentity(ctx context.Context, issuer, subject string) (User, bool, error) {
+	var u User
+	err := r.db.QueryRow(ctx, `
+		select u.id::text, u.username
+		from user_identities i
+		join users u on u.id = i.user_id
+		where i.issuer = $1 and i.subject = $2
+	`, issuer, subject).Scan(&u.ID, &u.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, false, nil
+	}
+	if err != nil {
+		return User{}, false, err
+	}
+	return u, true, nil
+}
+
+func (r *Repo) GetUserByID(ctx context.Context, id string) (User, error) {
+	var u User
+	err := r.db.QueryRow(ctx, `
+		select id::text, username, password_hash
+		from users
+		where id = $1::uuid
+	`, id).Scan(&u.ID, &u.Username, &u.PasswordHash)
+	if err != nil {
+		return User{}, errors.New("not found")
+	}
+	return u, nil
+}
+
+// LinkIdentity returns false if the identity is already linked (to anyone).
+func (r *Repo) LinkIdentity(ctx context.Context, userID, issuer, subject, email string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		insert into user_identities (issuer, subject, user_id, email)
+		values ($1, $2, $3::uuid, nullif($4, ''))
+		on conflict (issuer, subject) do nothing
+	`, issuer, subject, userID, email)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateSSOUser creates an account and links it in one transaction, so a
+// failed link never leaves an orphan user behind.
+func (r *Repo) CreateSSOUser(ctx context.Context, username, issuer, subject, email string) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	id, err := createUser(ctx, tx, username, ssoPasswordHash)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(ctx, `
+		insert into user_identities (issuer, subject, user_id, email)
+		values ($1, $2, $3::uuid, nullif($4, ''))
+	`, issuer, subject, id, email); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *Repo) ListTokens(ctx context.Context, userID string) ([]AccessToken, error) {
+	rows, err := r.db.Query(ctx, `
+		select id::text, name, token_prefix, scopes, created_at, last_used_at, expires_at
+		from personal_access_tokens
+		where user_id = $1::uuid and revoked_at is null
+		order by created_at desc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AccessToken{}
+	for rows.Next() {
+		var t AccessToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Scopes, &t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// CountTokens counts tokens that are still usable.
+func (r *Repo) CountTokens(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `
+		select count(*)::int
+		from personal_access_tokens
+		where user_id = $1::uuid and revoked_at is null
+		  and (expires_at is null or expires_at > now())
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func (r *Repo) CreateToken(ctx context.Context, userID, name, tokenHash, prefix string, scopes []string, expiresAt *time.Time) (AccessToken, error) {
+	t := AccessToken{Name: name, Prefix: prefix, Scopes: scopes, ExpiresAt: expiresAt}
+	err := r.db.QueryRow(ctx, `
+		insert into personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		values ($1::uuid, $2, $3, $4, $5, $6)
+		returning id::text, created_at
+	`, userID, name, tokenHash, prefix, scopes, expiresAt).Scan(&t.ID, &t.CreatedAt)
+	return t, err
+}
+
+func (r *Repo) RevokeToken(ctx context.Context, userID, id string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		update personal_access_tokens
+		set revoked_at = now()
+		where id = $1::uuid and user_id = $2::uuid and revoked_at is null
+	`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// TokenByHash finds a usable (not revoked or expired) token.
+func (r *Repo) TokenByHash(ctx context.Context, tokenHash string) (accessToken, bool, error) {
+	var t accessToken
+	err := r.db.QueryRow(ctx, `
+		select t.id::text, t.user_id::text, u.username, t.scopes, t.last_used_at
+		from personal_access_tokens t
+		join users u on u.id = t.user_id
+		where t.token_hash = $1 and t.revoked_at is null
+		  and (t.expires_at is null or t.expires_at > now())
+	`, tokenHash).Scan(&t.ID, &t.UserID, &t.Username, &t.Scopes, &t.LastUsed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return accessToken{}, false, nil
+	}
+	if err != nil {
+		return accessToken{}, false, err
+	}
+	return t, true, nil
+}
+
+func (r *Repo) TouchToken(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `update personal_access_tokens set last_used_at = now() where id = $1::uuid`, id)
+	return err
+}
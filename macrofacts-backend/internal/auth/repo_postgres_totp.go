@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type totpState struct {
+	Secret      string
+	Enabled     bool
+	LastCounter int64
+}
+
+func (r *Repo) GetTOTP(ctx context.Context, userID string) (totpState, bool, error) {
+	var st totpState
+	err := r.db.QueryRow(ctx, `
+		select secret, enabled_at is not null, last_counter
+		from user_totp
+		where user_id = $1::uuid
+	`, userID).Scan(&st.Secret, &st.Enabled, &st.LastCounter)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return totpState{}, false, nil
+	}
+	if err != nil {
+		return totpState{}, false, err
+	}
+	return st, true, nil
+}
+
+// UpsertPendingTOTP stores a not-yet-confirmed secret. It returns false when
+// 2FA is already enabled (the secret is left alone).
+func (r *Repo) UpsertPendingTOTP(ctx context.Context, userID, secret string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		insert into user_totp (user_id, secret)
+		values ($1::uuid, $2)
+		on conflict (user_id) do update
+		set secret = excluded.secret, last_counter = 0, created_at = now()
+		where user_totp.enabled_at is null
+	`, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// EnableTOTP confirms a pending secret, consuming the code's time step, and
+// sets the recovery codes. It returns false when there was nothing pending.
+func (r *Repo) EnableTOTP(ctx context.Context, userID string, counter int64, codeHashes []string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		update user_totp
+		set enabled_at = now(), last_counter = $2
+		where user_id = $1::uuid and enabled_at is null
+	`, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// UseTOTPCounter records counter as used; false if it (or a later one) already was.
+func (r *Repo) UseTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		update user_totp
+		set last_counter = $2
+		where user_id = $1::uuid and enabled_at is not null and last_counter < $2
+	`, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode burns the code with this hash; false if unknown or already used.
+func (r *Repo) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		update user_recovery_codes
+		set used_at = now()
+		where user_id = $1::uuid and code_hash = $2 and used_at is null
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *Repo) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *Repo) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `delete from user_recovery_codes where user_id = $1::uuid`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `delete from user_totp where user_id = $1::uuid`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `delete from user_recovery_codes where user_id = $1::uuid`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		insert into user_recovery_codes (user_id, code_hash)
+		select $1::uuid, unnest($2::text[])
+	`, userID, codeHashes)
+	return err
+}
@@ -7,61 +7,144 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var errInvalidCredentials = apperr.Unauthorized("invalid credentials").WithCode("INVALID_CREDENTIALS")
+
+// ErrSettingsChanged means a conditional settings update lost to a newer change.
+var ErrSettingsChanged = apperr.Conflict("SETTINGS_CHANGED", "settings changed since base version")
+
+// store is the slice of *Repo the service uses; tests swap in fakes.
+type store interface {
+	CreateUser(ctx context.Context, username string, passwordHash string) (string, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUserByID(ctx context.Context, id string) (User, error)
+	GetSettings(ctx context.Context, userID string) (MeSettingsResponse, error)
+	SyncVersions(ctx context.Context, userID string) (syncVersion int64, settingsVersion int64, err error)
+	UpsertSettings(ctx context.Context, userID string, req UpdateSettingsRequest, effectiveFrom time.Time, baseVersion *int64) error
+	ListGoals(ctx context.Context, userID string, to time.Time) ([]Goals, error)
+
+	AccountLoginFailures(ctx context.Context, username string, since time.Time) (loginFailureStats, error)
+	IPLoginFailures(ctx context.Context, ip string, since time.Time) (loginFailureStats, error)
+	InsertLoginEvent(ctx context.Context, username string, userID *string, ip, outcome string) error
+
+	InsertOIDCState(ctx context.Context, state string, st oidcState, expiresAt time.Time) error
+	TakeOIDCState(ctx context.Context, state string) (oidcState, bool, error)
+	UserByIdentity(ctx context.Context, issuer, subject string) (User, bool, error)
+	LinkIdentity(ctx context.Context, userID, issuer, subject, email string) (bool, error)
+	CreateSSOUser(ctx context.Context, username, issuer, subject, email string) (string, error)
+
+	ListTokens(ctx context.Context, userID string) ([]AccessToken, error)
+	CountTokens(ctx context.Context, userID string) (int, error)
+	CreateToken(ctx context.Context, userID, name, tokenHash, prefix string, scopes []string, expiresAt *time.Time) (AccessToken, error)
+	RevokeToken(ctx context.Context, userID, id string) (bool, error)
+	TokenByHash(ctx context.Context, tokenHash string) (accessToken, bool, error)
+	TouchToken(ctx context.Context, id string) error
+
+	GetTOTP(ctx context.Context, userID string) (totpState, bool, error)
+	UpsertPendingTOTP(ctx context.Context, userID, secret string) (bool, error)
+	EnableTOTP(ctx context.Context, userID string, counter int64, codeHashes []string) (bool, error)
+	UseTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	DeleteTOTP(ctx context.Context, userID string) error
+}
+
 type Service struct {
-	repo      *Repo
+	repo      store
 	jwtSecret []byte
+	// Clock for token expiry and TOTP checks.
+	now func() time.Time
+	// nil unless EnableSSO was called.
+	sso *SSOConfig
 }
 
 func NewService(pg *pgxpool.Pool, jwtSecret []byte) *Service {
 	return &Service{
 		repo:      NewRepo(pg),
 		jwtSecret: jwtSecret,
+		now:       time.Now,
 	}
 }
 
 func (s *Service) Register(username, password string) error {
 	u, err := CanonicalizeUsername(username)
-	if err != nil {
+	badUsername := err != nil
+	badPassword := len(password) < 8 || len(password) > 128
+	switch {
+	case badUsername && badPassword:
+		// Report both; the single-field cases keep their specific codes.
+		var v validate.Errors
+		v.Add("username", ErrUsernameInvalid.Message)
+		v.Add("password", ErrPasswordInvalid.Message)
+		return v.Err()
+	case badUsername:
 		return ErrUsernameInvalid
-	}
-	if len(password) < 8 || len(password) > 128 {
+	case badPassword:
 		return ErrPasswordInvalid
 	}
 
 	pwHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return errors.New("failed to hash password")
+		return apperr.Internal("failed to hash password")
 	}
 
 	_, err = s.repo.CreateUser(context.Background(), u, string(pwHash))
 	return err
 }
 
-func (s *Service) Login(username, password string) (string, error) {
+// Login checks credentials from ip. Unknown users and bad passwords both
+// return "invalid credentials" after a full bcrypt compare; too many recent
+// failures return a *LoginThrottledError without checking the password.
+// Users with 2FA get a challenge token for CompleteLogin instead of a session.
+func (s *Service) Login(username, password, ip string) (LoginResponse, error) {
+	ctx := context.Background()
+
 	u, err := CanonicalizeUsername(username)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		// Still costs a compare so malformed names aren't a fast path.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return LoginResponse{}, errInvalidCredentials
 	}
 
-	user, err := s.repo.GetUserByUsername(context.Background(), u)
+	if blocked, outcome := s.loginGate(ctx, u, ip); blocked != nil {
+		s.auditLogin(ctx, u, nil, ip, outcome)
+		return LoginResponse{}, blocked
+	}
+
+	user, err := s.repo.GetUserByUsername(ctx, u)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		s.auditLogin(ctx, u, nil, ip, loginFailure)
+		return LoginResponse{}, errInvalidCredentials
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+		s.auditLogin(ctx, u, &user.ID, ip, loginFailure)
+		return LoginResponse{}, errInvalidCredentials
+	}
+
+	tf, found, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return LoginResponse{}, apperr.Internal("login failed")
+	}
+	if found && tf.Enabled {
+		// Not a success yet: failures before it still count towards lockout.
+		s.auditLogin(ctx, u, &user.ID, ip, loginChallenged)
+		return s.twoFactorChallenge(user.ID, user.Username)
 	}
 
-	return IssueToken(s.jwtSecret, user.ID, user.Username, time.Now().Add(7*24*time.Hour))
+	s.auditLogin(ctx, u, &user.ID, ip, loginSuccess)
+	return s.session(user.ID, user.Username)
 }
 
 func (s *Service) ParseToken(raw string) (string, string, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
-		return "", "", errors.New("missing token")
+		return "", "", apperr.Unauthorized("missing token")
 	}
 	return ParseToken(s.jwtSecret, raw)
 }
@@ -71,8 +154,95 @@ func (s *Service) GetSettings(userID string) (MeSettingsResponse, error) {
 }
 
 func (s *Service) UpdateSettings(userID string, req UpdateSettingsRequest) (MeSettingsResponse, error) {
-	if err := s.repo.UpsertSettings(context.Background(), userID, req); err != nil {
+	return s.updateSettings(userID, req, nil)
+}
+
+// UpdateSettingsAt applies req only if settings haven't changed since
+// baseVersion (a settings_version the client saw), returning
+// ErrSettingsChanged otherwise. Check and write are one statement.
+func (s *Service) UpdateSettingsAt(userID string, req UpdateSettingsRequest, baseVersion int64) (MeSettingsResponse, error) {
+	return s.updateSettings(userID, req, &baseVersion)
+}
+
+func (s *Service) updateSettings(userID string, req UpdateSettingsRequest, baseVersion *int64) (MeSettingsResponse, error) {
+	if err := validateSettings(req); err != nil {
 		return MeSettingsResponse{}, err
 	}
+
+	// Goal changes take effect from "today" in the user's (possibly new) timezone.
+	tz := "UTC"
+	if req.Timezone != nil && *req.Timezone != "" {
+		tz = *req.Timezone
+	} else if cur, err := s.repo.GetSettings(context.Background(), userID); err == nil && cur.Timezone != "" {
+		tz = cur.Timezone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if err := s.repo.UpsertSettings(context.Background(), userID, req, today, baseVersion); err != nil {
+		if errors.Is(err, ErrSettingsChanged) {
+			return MeSettingsResponse{}, err
+		}
+		return MeSettingsResponse{}, apperr.Internal("failed to save settings")
+	}
 	return s.repo.GetSettings(context.Background(), userID)
 }
+
+// validateSettings uses the same goal ranges as the goals wizard.
+func validateSettings(req UpdateSettingsRequest) error {
+	var v validate.Errors
+	if req.Timezone != nil {
+		v.Timezone("timezone", *req.Timezone)
+	}
+	validate.RangePtr(&v, "calorieGoal", req.CalorieGoal, 800, 10000)
+	validate.RangePtr(&v, "proteinGoalG", req.ProteinGoalG, 0, 1000)
+	validate.RangePtr(&v, "carbsGoalG", req.CarbsGoalG, 0, 1000)
+	validate.RangePtr(&v, "fatGoalG", req.FatGoalG, 0, 1000)
+	return v.Err()
+}
+
+func (s *Service) SyncVersions(userID string) (syncVersion int64, settingsVersion int64, err error) {
+	syncVersion, settingsVersion, err = s.repo.SyncVersions(context.Background(), userID)
+	if err != nil {
+		return 0, 0, apperr.Internal("failed to load sync state")
+	}
+	return syncVersion, settingsVersion, nil
+}
+
+// GoalTimeline loads the goal versions needed to resolve any date up to `to`.
+func (s *Service) GoalTimeline(userID string, to time.Time) (GoalTimeline, error) {
+	versions, err := s.repo.ListGoals(context.Background(), userID, to)
+	if err != nil {
+		return GoalTimeline{}, apperr.Internal("failed to load goals")
+	}
+	t := GoalTimeline{versions: versions}
+
+	// Users whose history hasn't been seeded yet still resolve to current goals.
+	if len(versions) == 0 {
+		if cur, err := s.repo.GetSettings(context.Background(), userID); err == nil {
+			t.fallback = &Goals{
+				CalorieGoal:  cur.CalorieGoal,
+				ProteinGoalG: cur.ProteinGoalG,
+				CarbsGoalG:   cur.CarbsGoalG,
+				FatGoalG:     cur.FatGoalG,
+			}
+		}
+	}
+	return t, nil
+}
+
+func (s *Service) GoalHistory(userID string) (GoalHistoryResponse, error) {
+	// Far-future bound so versions scheduled ahead of the user's clock are included.
+	versions, err := s.repo.ListGoals(context.Background(), userID, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return GoalHistoryResponse{}, apperr.Internal("failed to load goals")
+	}
+	if versions == nil {
+		versions = []Goals{}
+	}
+	return GoalHistoryResponse{Items: versions}, nil
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/oidc"
+)
+
+// Provisioning modes for SSO sign-ins with no linked account.
+const (
+	// ProvisionAuto creates a macrofacts account on first sign-in.
+	ProvisionAuto = "auto"
+	// ProvisionLinkOnly only admits identities a signed-in user linked to their account.
+	ProvisionLinkOnly = "link"
+)
+
+// SSO accounts have no usable password: no bcrypt hash ever matches this.
+const ssoPasswordHash = "!sso"
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrSSODisabled  = apperr.NotFound("sso is not configured")
+	errSSONoAccount = apperr.Forbidden("no account is linked to this identity").WithCode("SSO_NO_ACCOUNT")
+	errIdPDown      = apperr.Unavailable("identity provider unavailable")
+	errSSOLinked    = apperr.Conflict("IDENTITY_LINKED", "identity is linked to another account")
+	errSSOLinkOwner = apperr.Forbidden("finish linking signed in as the user who started it").WithCode("SSO_LINK_SESSION")
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^A-Z0-9_.]+`)
+
+type SSOConfig struct {
+	Provider     *oidc.Provider
+	Provisioning string
+	// AllowedDomains limits auto-provisioning to verified emails in these
+	// domains. Empty allows any identity the IdP vouches for.
+	AllowedDomains []string
+}
+
+// EnableSSO turns on OIDC sign-in next to username/password login.
+func (s *Service) EnableSSO(cfg SSOConfig) {
+	if cfg.Provisioning != ProvisionLinkOnly {
+		cfg.Provisioning = ProvisionAuto
+	}
+	for i, d := range cfg.AllowedDomains {
+		cfg.AllowedDomains[i] = strings.ToLower(strings.TrimSpace(d))
+	}
+	s.sso = &cfg
+}
+
+// StartSSO returns the IdP URL to send the browser to. With linkUserID set,
+// the callback links the identity to that (signed-in) user instead of logging in.
+func (s *Service) StartSSO(ctx context.Context, linkUserID string) (SSOStartResponse, error) {
+	if s.sso == nil {
+		return SSOStartResponse{}, ErrSSODisabled
+	}
+	ar, err := s.sso.Provider.AuthCodeURL(ctx)
+	if err != nil {
+		slog.Warn("sso start failed", "err", err)
+		return SSOStartResponse{}, errIdPDown
+	}
+
+	st := oidcState{Verifier: ar.Verifier, Nonce: ar.Nonce}
+	if linkUserID != "" {
+		st.LinkUserID = &linkUserID
+	}
+	if err := s.repo.InsertOIDCState(ctx, ar.State, st, s.now().Add(oidcStateTTL)); err != nil {
+		return SSOStartResponse{}, apperr.Internal("failed to start sso")
+	}
+	return SSOStartResponse{AuthorizationURL: ar.URL, State: ar.State}, nil
+}
+
+// FinishSSO redeems the code the IdP redirected back with. SSO sessions skip
+// local 2FA; the IdP is responsible for its own second factor. Login
+// throttling still applies. callerID is the signed-in user making the
+// request, if any: a link flow only completes for the user who started it,
+// so a victim can't be tricked into linking someone else's identity.
+func (s *Service) FinishSSO(ctx context.Context, code, state, callerID, ip string) (LoginResponse, error) {
+	if s.sso == nil {
+		return LoginResponse{}, ErrSSODisabled
+	}
+	code, state = strings.TrimSpace(code), strings.TrimSpace(state)
+	if code == "" || state == "" {
+		return LoginResponse{}, apperr.InvalidField("code", "code and state required")
+	}
+
+	st, ok, err := s.repo.TakeOIDCState(ctx, state)
+	if err != nil {
+		return LoginResponse{}, apperr.Internal("failed to load sso state")
+	}
+	if !ok {
+		return LoginResponse{}, apperr.Invalid("invalid or expired state")
+	}
+	if st.LinkUserID != nil && *st.LinkUserID != callerID {
+		return LoginResponse{}, errSSOLinkOwner
+	}
+
+	id, err := s.sso.Provider.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		slog.Warn("sso exchange failed", "err", err)
+		return LoginResponse{}, apperr.Unauthorized("sso login failed")
+	}
+
+	user, err := s.ssoUser(ctx, id, st.LinkUserID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	// A lockout from failed password or 2FA attempts covers SSO too.
+	if blocked, outcome := s.loginGate(ctx, user.Username, ip); blocked != nil {
+		s.auditLogin(ctx, user.Username, &user.ID, ip, outcome)
+		return LoginResponse{}, blocked
+	}
+	s.auditLogin(ctx, user.Username, &user.ID, ip, loginSuccess)
+	return s.session(user.ID, user.Username)
+}
+
+func (s *Service) ssoUser(ctx context.Context, id oidc.IDToken, linkUserID *string) (User, error) {
+	user, found, err := s.repo.UserByIdentity(ctx, id.Issuer, id.Subject)
+	if err != nil {
+		return User{}, apperr.Internal("failed to load account")
+	}
+
+	if linkUserID != nil {
+		if found {
+			if user.ID != *linkUserID {
+				return User{}, errSSOLinked
+			}
+			return user, nil
+		}
+		if ok, err := s.repo.LinkIdentity(ctx, *linkUserID, id.Issuer, id.Subject, id.Email); err != nil {
+			return User{}, apperr.Internal("failed to link identity")
+		} else if !ok {
+			return User{}, errSSOLinked
+		}
+		return s.repo.GetUserByID(ctx, *linkUserID)
+	}
+
+	if found {
+		return user, nil
+	}
+	if s.sso.Provisioning != ProvisionAuto || !s.domainAllowed(id) {
+		return User{}, errSSONoAccount
+	}
+	return s.provision(ctx, id)
+}
+
+func (s *Service) domainAllowed(id oidc.IDToken) bool {
+	if len(s.sso.AllowedDomains) == 0 {
+		return true
+	}
+	_, domain, ok := strings.Cut(strings.ToLower(id.Email), "@")
+	if !ok || !id.EmailVerified {
+		return false
+	}
+	for _, d := range s.sso.AllowedDomains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// provision creates an account named after the IdP username (or email),
+// adding a numeric suffix if that name is taken.
+func (s *Service) provision(ctx context.Context, id oidc.IDToken) (User, error) {
+	base := ssoUsername(id)
+	name := base
+	for attempt := 0; attempt < 5; attempt++ {
+		uid, err := s.repo.CreateSSOUser(ctx, name, id.Issuer, id.Subject, id.Email)
+		if err == nil {
+			return User{ID: uid, Username: name}, nil
+		}
+		// A concurrent callback for the same identity may have won.
+		if u, found, lerr := s.repo.UserByIdentity(ctx, id.Issuer, id.Subject); lerr == nil && found {
+			return u, nil
+		}
+		if !errors.Is(err, ErrUsernameTaken) {
+			return User{}, apperr.Internal("failed to create account")
+		}
+		n, _ := rand.Int(rand.Reader, big.NewInt(10000))
+		name = fmt.Sprintf("%s_%04d", base, n.Int64())
+	}
+	return User{}, apperr.Internal("failed to create account")
+}
+
+// ssoUsername fits the IdP's name to our username rules (3-32 of A-Z 0-9 _ .),
+// leaving room for a collision suffix.
+func ssoUsername(id oidc.IDToken) string {
+	raw := id.PreferredUsername
+	if raw == "" {
+		raw, _, _ = strings.Cut(id.Email, "@")
+	}
+	u := usernameInvalidChars.ReplaceAllString(strings.ToUpper(raw), "_")
+	u = strings.Trim(u, "_.")
+	if len(u) > 27 {
+		u = u[:27]
+	}
+	if len(u) < 3 {
+		u = "USER" + u
+	}
+	return u
+}
@@ -0,0 +1,418 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/oidc"
+)
+
+const testClientID = "macrofacts-test"
+
+// fakeIdP is a stand-in OpenID provider: discovery, a one-key JWKS and a
+// token endpoint that checks PKCE and signs ID tokens with whatever claims
+// the test "logged in" with.
+type fakeIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu      sync.Mutex
+	pending map[string]pendingCode
+	seq     int
+}
+
+type pendingCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, pending: map[string]pendingCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// authorize plays the browser and the IdP login page: it reads state, nonce
+// and the PKCE challenge from the authorization URL and returns a code that
+// redeems for an ID token with claims (plus iss, aud, exp and the nonce,
+// unless claims sets its own).
+func (idp *fakeIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientID || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	full := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.seq++
+	code = fmt.Sprintf("code-%d", idp.seq)
+	idp.pending[code] = pendingCode{challenge: q.Get("code_challenge"), claims: full}
+	return code, q.Get("state")
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	p, ok := idp.pending[r.PostForm.Get("code")]
+	delete(idp.pending, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims)
+	tok.Header["kid"] = "k1"
+	signed, err := tok.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+// ssoRepo keeps users, identities and pending states in memory.
+type ssoRepo struct {
+	store
+
+	states     map[string]oidcState
+	users      map[string]User   // by ID
+	identities map[string]string // issuer + "|" + subject -> user ID
+	failures   loginFailureStats // returned for every username
+	outcomes   []string
+}
+
+func newSSORepo() *ssoRepo {
+	return &ssoRepo{states: map[string]oidcState{}, users: map[string]User{}, identities: map[string]string{}}
+}
+
+func (r *ssoRepo) InsertOIDCState(_ context.Context, state string, st oidcState, _ time.Time) error {
+	r.states[state] = st
+	return nil
+}
+
+func (r *ssoRepo) TakeOIDCState(_ context.Context, state string) (oidcState, bool, error) {
+	st, ok := r.states[state]
+	delete(r.states, state)
+	return st, ok, nil
+}
+
+func (r *ssoRepo) UserByIdentity(_ context.Context, issuer, subject string) (User, bool, error) {
+	id, ok := r.identities[issuer+"|"+subject]
+	return r.users[id], ok, nil
+}
+
+func (r *ssoRepo) GetUserByID(_ context.Context, id string) (User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return User{}, errors.New("no such user")
+	}
+	return u, nil
+}
+
+func (r *ssoRepo) LinkIdentity(_ context.Context, userID, issuer, subject, _ string) (bool, error) {
+	if _, taken := r.identities[issuer+"|"+subject]; taken {
+		return false, nil
+	}
+	r.identities[issuer+"|"+subject] = userID
+	return true, nil
+}
+
+func (r *ssoRepo) CreateSSOUser(_ context.Context, username, issuer, subject, _ string) (string, error) {
+	for _, u := range r.users {
+		if u.Username == username {
+			return "", ErrUsernameTaken
+		}
+	}
+	id := fmt.Sprintf("u%d", len(r.users)+1)
+	r.users[id] = User{ID: id, Username: username, PasswordHash: ssoPasswordHash}
+	r.identities[issuer+"|"+subject] = id
+	return id, nil
+}
+
+func (r *ssoRepo) IPLoginFailures(context.Context, string, time.Time) (loginFailureStats, error) {
+	return loginFailureStats{}, nil
+}
+
+func (r *ssoRepo) AccountLoginFailures(context.Context, string, time.Time) (loginFailureStats, error) {
+	return r.failures, nil
+}
+
+func (r *ssoRepo) InsertLoginEvent(_ context.Context, _ string, _ *string, _, outcome string) error {
+	r.outcomes = append(r.outcomes, outcome)
+	return nil
+}
+
+func newSSOService(t *testing.T, cfg SSOConfig) (*Service, *ssoRepo, *fakeIdP) {
+	t.Helper()
+	idp := newFakeIdP(t)
+	repo := newSSORepo()
+	svc := &Service{repo: repo, jwtSecret: []byte("test"), now: time.Now}
+	cfg.Provider = oidc.NewProvider(oidc.Config{
+		Issuer:      idp.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://app.example/sso/callback",
+	})
+	svc.EnableSSO(cfg)
+	return svc, repo, idp
+}
+
+// signIn runs StartSSO, the IdP login and FinishSSO in one go.
+func signIn(t *testing.T, svc *Service, idp *fakeIdP, linkUserID string, claims jwt.MapClaims) (LoginResponse, error) {
+	t.Helper()
+	start, err := svc.StartSSO(context.Background(), linkUserID)
+	if err != nil {
+		t.Fatalf("StartSSO: %v", err)
+	}
+	code, state := idp.authorize(t, start.AuthorizationURL, claims)
+	if state != start.State {
+		t.Fatalf("state in URL = %q, response = %q", state, start.State)
+	}
+	// Link flows finish in the linking user's session, as the handler does.
+	return svc.FinishSSO(context.Background(), code, state, linkUserID, "198.51.100.7")
+}
+
+func TestSSOProvisionsAndSignsIn(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{})
+	claims := jwt.MapClaims{"sub": "alice-1", "preferred_username": "alice.s", "email": "alice@example.com"}
+
+	resp, err := signIn(t, svc, idp, "", claims)
+	if err != nil {
+		t.Fatalf("FinishSSO: %v", err)
+	}
+	if resp.Token == "" || resp.TwoFactorRequired {
+		t.Fatalf("resp = %+v, want a session token", resp)
+	}
+	uid, username, err := ParseToken(svc.jwtSecret, resp.Token)
+	if err != nil {
+		t.Fatalf("session token: %v", err)
+	}
+	if username != "ALICE.S" || repo.users[uid].Username != "ALICE.S" {
+		t.Fatalf("signed in as %q (%s), users = %v", username, uid, repo.users)
+	}
+
+	// The second sign-in finds the linked account instead of creating one.
+	again, err := signIn(t, svc, idp, "", claims)
+	if err != nil {
+		t.Fatalf("second FinishSSO: %v", err)
+	}
+	if uid2, _, _ := ParseToken(svc.jwtSecret, again.Token); uid2 != uid || len(repo.users) != 1 {
+		t.Fatalf("second sign-in as %s with %d users, want %s and 1", uid2, len(repo.users), uid)
+	}
+	if want := []string{loginSuccess, loginSuccess}; fmt.Sprint(repo.outcomes) != fmt.Sprint(want) {
+		t.Fatalf("audit = %v, want %v", repo.outcomes, want)
+	}
+}
+
+func TestSSORejectsNonceMismatch(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{})
+
+	_, err := signIn(t, svc, idp, "", jwt.MapClaims{"sub": "alice-1", "nonce": "not-the-nonce-we-sent"})
+	if apperr.KindOf(err) != apperr.KindUnauthorized {
+		t.Fatalf("err = %v, want unauthorized", err)
+	}
+	if len(repo.users) != 0 {
+		t.Fatalf("users = %v, want none", repo.users)
+	}
+}
+
+func TestSSOStateIsSingleUse(t *testing.T) {
+	svc, _, idp := newSSOService(t, SSOConfig{})
+
+	start, err := svc.StartSSO(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(t, start.AuthorizationURL, jwt.MapClaims{"sub": "alice-1"})
+	if _, err := svc.FinishSSO(context.Background(), code, state, "", ""); err != nil {
+		t.Fatalf("first FinishSSO: %v", err)
+	}
+
+	// Even with a fresh, valid code the state has been consumed.
+	code2, _ := idp.authorize(t, start.AuthorizationURL, jwt.MapClaims{"sub": "alice-1"})
+	_, err = svc.FinishSSO(context.Background(), code2, state, "", "")
+	if ae, ok := apperr.As(err); !ok || ae.Kind != apperr.KindValidation || ae.Message != "invalid or expired state" {
+		t.Fatalf("replayed state: err = %v, want invalid or expired state", err)
+	}
+}
+
+func TestSSOAllowedDomainsNeedVerifiedEmail(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{AllowedDomains: []string{"Example.com"}})
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		ok     bool
+	}{
+		{"unverified", jwt.MapClaims{"sub": "a", "email": "ann@example.com", "email_verified": false}, false},
+		{"no email", jwt.MapClaims{"sub": "b"}, false},
+		{"other domain", jwt.MapClaims{"sub": "c", "email": "cat@example.org", "email_verified": true}, false},
+		{"subdomain", jwt.MapClaims{"sub": "d", "email": "dan@mail.example.com", "email_verified": true}, false},
+		{"verified", jwt.MapClaims{"sub": "e", "email": "eve@EXAMPLE.com", "email_verified": true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signIn(t, svc, idp, "", tt.claims)
+			if tt.ok && err != nil {
+				t.Fatalf("err = %v, want success", err)
+			}
+			if !tt.ok && !errors.Is(err, errSSONoAccount) {
+				t.Fatalf("err = %v, want errSSONoAccount", err)
+			}
+		})
+	}
+	if len(repo.users) != 1 {
+		t.Fatalf("users = %v, want only the verified one", repo.users)
+	}
+}
+
+func TestSSOLinkOnlyNeedsLinkedIdentity(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{Provisioning: ProvisionLinkOnly})
+	repo.users["u1"] = User{ID: "u1", Username: "BOB"}
+
+	claims := jwt.MapClaims{"sub": "bob-1", "email": "bob@example.com"}
+	if _, err := signIn(t, svc, idp, "", claims); !errors.Is(err, errSSONoAccount) {
+		t.Fatalf("unlinked sign-in: err = %v, want errSSONoAccount", err)
+	}
+
+	// Bob links the identity while signed in, then it works on its own.
+	if _, err := signIn(t, svc, idp, "u1", claims); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	resp, err := signIn(t, svc, idp, "", claims)
+	if err != nil {
+		t.Fatalf("sign-in after link: %v", err)
+	}
+	if uid, _, _ := ParseToken(svc.jwtSecret, resp.Token); uid != "u1" {
+		t.Fatalf("signed in as %q, want u1", uid)
+	}
+}
+
+func TestSSOLinkRejectsIdentityOfAnotherAccount(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{})
+	repo.users["u1"] = User{ID: "u1", Username: "ALICE"}
+	repo.users["u2"] = User{ID: "u2", Username: "MALLORY"}
+	repo.identities[idp.URL+"|alice-1"] = "u1"
+
+	_, err := signIn(t, svc, idp, "u2", jwt.MapClaims{"sub": "alice-1"})
+	if !errors.Is(err, errSSOLinked) {
+		t.Fatalf("err = %v, want errSSOLinked", err)
+	}
+	if repo.identities[idp.URL+"|alice-1"] != "u1" {
+		t.Fatal("identity moved to another account")
+	}
+
+	// Re-linking to the account that already has it is a no-op sign-in.
+	if _, err := signIn(t, svc, idp, "u1", jwt.MapClaims{"sub": "alice-1"}); err != nil {
+		t.Fatalf("relink own identity: %v", err)
+	}
+}
+
+// Login CSRF on linking: Mallory starts a link for her account and gets Bob's
+// browser to deliver the callback. Without Mallory's session it must fail.
+func TestSSOLinkNeedsStartingSession(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{Provisioning: ProvisionLinkOnly})
+	repo.users["u1"] = User{ID: "u1", Username: "BOB"}
+	repo.users["u2"] = User{ID: "u2", Username: "MALLORY"}
+
+	for _, caller := range []string{"", "u1"} {
+		start, err := svc.StartSSO(context.Background(), "u2")
+		if err != nil {
+			t.Fatalf("StartSSO: %v", err)
+		}
+		code, state := idp.authorize(t, start.AuthorizationURL, jwt.MapClaims{"sub": "mallory-1"})
+		if _, err := svc.FinishSSO(context.Background(), code, state, caller, ""); !errors.Is(err, errSSOLinkOwner) {
+			t.Fatalf("caller %q: err = %v, want errSSOLinkOwner", caller, err)
+		}
+	}
+	if len(repo.identities) != 0 {
+		t.Fatalf("identities linked: %v", repo.identities)
+	}
+}
+
+func TestSSORespectsLockout(t *testing.T) {
+	svc, repo, idp := newSSOService(t, SSOConfig{})
+	repo.users["u1"] = User{ID: "u1", Username: "ALICE"}
+	repo.identities[idp.URL+"|alice-1"] = "u1"
+	repo.failures = loginFailureStats{Failures: accountLockAfter, LastFailure: time.Now().Add(-time.Minute)}
+
+	resp, err := signIn(t, svc, idp, "", jwt.MapClaims{"sub": "alice-1"})
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("err = %v, want a locked *LoginThrottledError", err)
+	}
+	if resp.Token != "" {
+		t.Fatal("locked account got a session")
+	}
+	if len(repo.outcomes) != 1 || repo.outcomes[0] != loginLocked {
+		t.Fatalf("audit = %v, want [%s]", repo.outcomes, loginLocked)
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+// Stream tokens only have to last until the connection is open; an
+// EventSource that drops fetches a new one before reconnecting.
+const streamTokenTTL = time.Minute
+
+// IssueStreamToken mints a token that opens /logs/stream and nothing else,
+// so it is fine to put in a URL.
+func (s *Service) IssueStreamToken(userID, username string) (StreamTokenResponse, error) {
+	if userID == "" {
+		return StreamTokenResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	exp := s.now().Add(streamTokenTTL)
+	tok, err := issueToken(s.jwtSecret, userID, username, purposeStream, exp)
+	if err != nil {
+		return StreamTokenResponse{}, apperr.Internal("failed to issue stream token")
+	}
+	return StreamTokenResponse{Token: tok, ExpiresAt: exp.UTC()}, nil
+}
+
+// StreamMiddleware is Middleware(scopes...) that also accepts a stream token
+// in ?token= when no Authorization header is sent. The token is only checked
+// here, so an open stream outlives it.
+func (s *Service) StreamMiddleware(scopes ...string) gin.HandlerFunc {
+	header := s.Middleware(scopes...)
+	return func(c *gin.Context) {
+		raw := strings.TrimSpace(c.Query("token"))
+		if raw == "" || c.GetHeader("Authorization") != "" {
+			header(c)
+			return
+		}
+		userID, username, err := parseToken(s.jwtSecret, raw, purposeStream)
+		if err != nil || userID == "" {
+			httpapi.Unauthorized(c, "invalid token")
+			return
+		}
+		c.Set("user_id", userID)
+		c.Set("username", username)
+		c.Set("userId", userID)
+		c.Next()
+	}
+}
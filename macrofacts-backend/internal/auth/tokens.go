@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+// Scopes a personal access token can hold. Session JWTs have all of them.
+const (
+	ScopeLogsRead      = "logs:read"
+	ScopeLogsWrite     = "logs:write"
+	ScopeFoodsRead     = "foods:read"
+	ScopeFoodsWrite    = "foods:write"
+	ScopeWeightRead    = "weight:read"
+	ScopeWeightWrite   = "weight:write"
+	ScopeSettingsRead  = "settings:read"
+	ScopeSettingsWrite = "settings:write"
+)
+
+var allScopes = []string{
+	ScopeLogsRead, ScopeLogsWrite,
+	ScopeFoodsRead, ScopeFoodsWrite,
+	ScopeWeightRead, ScopeWeightWrite,
+	ScopeSettingsRead, ScopeSettingsWrite,
+}
+
+const (
+	// Personal access tokens look like "mfpat_<43 chars>", which tells them apart from JWTs.
+	patPrefix        = "mfpat_"
+	maxTokensPerUser = 50
+	maxTokenDays     = 366
+	// last_used_at is only rewritten when older than this, so busy scripts don't write per request.
+	tokenUsedGranularity = time.Minute
+)
+
+var errTokenNotFound = apperr.NotFound("token not found")
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// accessToken is who a verified personal access token acts as.
+type accessToken struct {
+	ID       string
+	UserID   string
+	Username string
+	Scopes   []string
+	LastUsed *time.Time
+}
+
+func (s *Service) ListTokens(ctx context.Context, userID string) (TokenListResponse, error) {
+	items, err := s.repo.ListTokens(ctx, userID)
+	if err != nil {
+		return TokenListResponse{}, apperr.Internal("failed to load tokens")
+	}
+	return TokenListResponse{Items: items}, nil
+}
+
+// CreateToken returns the secret once; only its hash is stored.
+func (s *Service) CreateToken(ctx context.Context, userID string, req CreateTokenRequest) (CreateTokenResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return CreateTokenResponse{}, apperr.InvalidField("name", "name must be 1-100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		return CreateTokenResponse{}, apperr.InvalidField("scopes", "at least one scope required")
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, sc := range req.Scopes {
+		if !slices.Contains(allScopes, sc) {
+			return CreateTokenResponse{}, apperr.Invalid("unknown scope: " + sc)
+		}
+		if !slices.Contains(scopes, sc) {
+			scopes = append(scopes, sc)
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > maxTokenDays {
+			return CreateTokenResponse{}, apperr.InvalidField("expiresInDays", "expiresInDays must be 1-366")
+		}
+		t := s.now().Add(time.Duration(*req.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	n, err := s.repo.CountTokens(ctx, userID)
+	if err != nil {
+		return CreateTokenResponse{}, apperr.Internal("failed to create token")
+	}
+	if n >= maxTokensPerUser {
+		return CreateTokenResponse{}, apperr.Conflict("LIMIT_REACHED", "token limit reached")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return CreateTokenResponse{}, apperr.Internal("failed to create token")
+	}
+	secret := patPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	tok, err := s.repo.CreateToken(ctx, userID, name, hashToken(secret), secret[:len(patPrefix)+6], scopes, expiresAt)
+	if err != nil {
+		return CreateTokenResponse{}, apperr.Internal("failed to create token")
+	}
+	return CreateTokenResponse{Token: secret, AccessToken: tok}, nil
+}
+
+func (s *Service) RevokeToken(ctx context.Context, userID, id string) error {
+	if !uuidRe.MatchString(id) {
+		return errTokenNotFound
+	}
+	ok, err := s.repo.RevokeToken(ctx, userID, id)
+	if err != nil {
+		return apperr.Internal("failed to revoke token")
+	}
+	if !ok {
+		return errTokenNotFound
+	}
+	return nil
+}
+
+// verifyAccessToken resolves a "mfpat_" bearer token, or fails if it's
+// unknown, revoked or expired.
+func (s *Service) verifyAccessToken(ctx context.Context, raw string) (accessToken, error) {
+	tok, found, err := s.repo.TokenByHash(ctx, hashToken(raw))
+	if err != nil || !found {
+		return accessToken{}, apperr.Unauthorized("invalid token")
+	}
+	if tok.LastUsed == nil || s.now().Sub(*tok.LastUsed) > tokenUsedGranularity {
+		if err := s.repo.TouchToken(ctx, tok.ID); err != nil {
+			slog.Warn("token last-used update failed", "err", err)
+		}
+	}
+	return tok, nil
+}
+
+func isAccessToken(raw string) bool {
+	return strings.HasPrefix(raw, patPrefix)
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
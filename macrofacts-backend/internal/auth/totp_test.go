@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret ("12345678901234567890"), base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFCVectors(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, TOTPCounter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("t=%d: code = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	step := TOTPCounter(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := TOTPCode(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter, ok := VerifyTOTP(rfcSecret, code, now)
+		wantOK := offset >= -totpSkew && offset <= totpSkew
+		if ok != wantOK {
+			t.Errorf("offset %d: ok = %v, want %v", offset, ok, wantOK)
+		}
+		if ok && counter != step+offset {
+			t.Errorf("offset %d: counter = %d, want %d", offset, counter, step+offset)
+		}
+	}
+}
+
+func TestVerifyTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870822", "abcdef"} {
+		if _, ok := VerifyTOTP(rfcSecret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := VerifyTOTP(rfcSecret, " 287 082 ", now); !ok {
+		t.Error("spaced code rejected")
+	}
+	if _, ok := VerifyTOTP("not base32!", "287082", now); ok {
+		t.Error("bad secret accepted")
+	}
+}
+
+// totpRepo keeps one user's 2FA state in memory. Methods the tests don't
+// reach fall through to the nil store and panic.
+type totpRepo struct {
+	store
+	state    totpState
+	found    bool
+	recovery map[string]bool // hash -> used
+
+	failures loginFailureStats // the account's, for loginGate
+	outcomes []string
+}
+
+func (r *totpRepo) IPLoginFailures(context.Context, string, time.Time) (loginFailureStats, error) {
+	return loginFailureStats{}, nil
+}
+
+func (r *totpRepo) AccountLoginFailures(context.Context, string, time.Time) (loginFailureStats, error) {
+	return r.failures, nil
+}
+
+func (r *totpRepo) InsertLoginEvent(_ context.Context, _ string, _ *string, _, outcome string) error {
+	r.outcomes = append(r.outcomes, outcome)
+	return nil
+}
+
+func (r *totpRepo) DeleteTOTP(context.Context, string) error {
+	r.state, r.found = totpState{}, false
+	return nil
+}
+
+func (r *totpRepo) GetTOTP(context.Context, string) (totpState, bool, error) {
+	return r.state, r.found, nil
+}
+
+func (r *totpRepo) EnableTOTP(_ context.Context, _ string, counter int64, hashes []string) (bool, error) {
+	if !r.found || r.state.Enabled {
+		return false, nil
+	}
+	r.state.Enabled = true
+	r.state.LastCounter = counter
+	r.recovery = map[string]bool{}
+	for _, h := range hashes {
+		r.recovery[h] = false
+	}
+	return true, nil
+}
+
+func (r *totpRepo) UseTOTPCounter(_ context.Context, _ string, counter int64) (bool, error) {
+	if !r.state.Enabled || counter <= r.state.LastCounter {
+		return false, nil
+	}
+	r.state.LastCounter = counter
+	return true, nil
+}
+
+func (r *totpRepo) UseRecoveryCode(_ context.Context, _ string, hash string) (bool, error) {
+	used, ok := r.recovery[hash]
+	if !ok || used {
+		return false, nil
+	}
+	r.recovery[hash] = true
+	return true, nil
+}
+
+func newTOTPService(t *testing.T, now *time.Time) (*Service, *totpRepo) {
+	t.Helper()
+	repo := &totpRepo{state: totpState{Secret: rfcSecret}, found: true}
+	return &Service{repo: repo, now: func() time.Time { return *now }}, repo
+}
+
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := TOTPCode(rfcSecret, TOTPCounter(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestSecondFactorRejectsReplay(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	svc, _ := newTOTPService(t, &now)
+
+	// Confirming enrollment consumes the code's step.
+	first := codeAt(t, now)
+	if _, err := svc.ConfirmTOTP("u1", first); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := svc.checkSecondFactor(context.Background(), "u1", first); !errors.Is(err, errInvalidCode) {
+		t.Fatalf("replayed enrollment code: err = %v, want errInvalidCode", err)
+	}
+
+	// The next step's code works once, still within the window.
+	now = now.Add(totpPeriod * time.Second)
+	next := codeAt(t, now)
+	if err := svc.checkSecondFactor(context.Background(), "u1", next); err != nil {
+		t.Fatalf("fresh code: %v", err)
+	}
+	if err := svc.checkSecondFactor(context.Background(), "u1", next); !errors.Is(err, errInvalidCode) {
+		t.Fatalf("replayed code: err = %v, want errInvalidCode", err)
+	}
+
+	// A code from an earlier step is rejected even though it is inside the skew window.
+	if err := svc.checkSecondFactor(context.Background(), "u1", first); !errors.Is(err, errInvalidCode) {
+		t.Fatalf("older code: err = %v, want errInvalidCode", err)
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	svc, repo := newTOTPService(t, &now)
+
+	resp, err := svc.ConfirmTOTP("u1", codeAt(t, now))
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if len(resp.RecoveryCodes) != recoveryCodeCount || len(repo.recovery) != recoveryCodeCount {
+		t.Fatalf("got %d codes, %d stored; want %d", len(resp.RecoveryCodes), len(repo.recovery), recoveryCodeCount)
+	}
+
+	code := resp.RecoveryCodes[0]
+	if err := svc.checkSecondFactor(context.Background(), "u1", code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := svc.checkSecondFactor(context.Background(), "u1", code); !errors.Is(err, errInvalidCode) {
+		t.Fatalf("second use: err = %v, want errInvalidCode", err)
+	}
+
+	// Case and the dash don't matter; the other codes are untouched.
+	loose := strings.ToUpper(strings.Replace(resp.RecoveryCodes[1], "-", " ", 1))
+	if err := svc.checkSecondFactor(context.Background(), "u1", loose); err != nil {
+		t.Fatalf("reformatted code %q: %v", loose, err)
+	}
+
+	if err := svc.checkSecondFactor(context.Background(), "u1", "zzzzz-zzzzz"); !errors.Is(err, errInvalidCode) {
+		t.Fatalf("unknown code: err = %v, want errInvalidCode", err)
+	}
+}
+
+func TestSecondFactorNeedsEnabled(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	svc, _ := newTOTPService(t, &now)
+
+	// Pending enrollment: codes don't count as a second factor yet.
+	if err := svc.checkSecondFactor(context.Background(), "u1", codeAt(t, now)); !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Fatalf("err = %v, want ErrTwoFactorNotEnabled", err)
+	}
+}
+
+// Disabling 2FA takes a code, so it gets the same lockout and audit trail as
+// CompleteLogin; a stolen session mustn't be a free code oracle.
+func TestDisableTOTPIsGated(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	svc, repo := newTOTPService(t, &now)
+	if _, err := svc.ConfirmTOTP("u1", codeAt(t, now)); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	now = now.Add(totpPeriod * time.Second)
+
+	if err := svc.DisableTOTP("u1", "alice", "000000", "203.0.113.7"); !errors.Is(err, errInvalidCode) {
+		t.Fatalf("wrong code: err = %v, want errInvalidCode", err)
+	}
+
+	// Locked out: even the right code isn't checked.
+	repo.failures = loginFailureStats{Failures: accountLockAfter, LastFailure: now}
+	var throttled *LoginThrottledError
+	if err := svc.DisableTOTP("u1", "alice", codeAt(t, now), "203.0.113.7"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("locked account: err = %v, want locked", err)
+	}
+	if !repo.found {
+		t.Fatal("2fa disabled while locked")
+	}
+
+	repo.failures = loginFailureStats{}
+	if err := svc.DisableTOTP("u1", "alice", codeAt(t, now), "203.0.113.7"); err != nil {
+		t.Fatalf("right code: %v", err)
+	}
+	if repo.found {
+		t.Fatal("2fa still enabled")
+	}
+
+	want := []string{loginFailure, loginLocked}
+	if !slices.Equal(repo.outcomes, want) {
+		t.Fatalf("audited %v, want %v", repo.outcomes, want)
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+const (
+	totpIssuer        = "Macrofacts"
+	challengeTTL      = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorEnabled    = apperr.Conflict("TWO_FACTOR_ENABLED", "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = apperr.Conflict("TWO_FACTOR_NOT_ENABLED", "two-factor authentication is not enabled")
+	errInvalidCode         = apperr.InvalidField("code", "invalid code").WithCode("INVALID_CODE")
+)
+
+// EnrollTOTP starts (or restarts) enrollment with a fresh secret. 2FA isn't
+// on until ConfirmTOTP sees a valid code from it.
+func (s *Service) EnrollTOTP(userID, username string) (TOTPEnrollResponse, error) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return TOTPEnrollResponse{}, apperr.Internal("failed to create secret")
+	}
+	ok, err := s.repo.UpsertPendingTOTP(context.Background(), userID, secret)
+	if err != nil {
+		return TOTPEnrollResponse{}, apperr.Internal("failed to save secret")
+	}
+	if !ok {
+		return TOTPEnrollResponse{}, ErrTwoFactorEnabled
+	}
+	return TOTPEnrollResponse{Secret: secret, OTPAuthURI: TOTPURI(totpIssuer, username, secret)}, nil
+}
+
+// ConfirmTOTP turns 2FA on and returns the recovery codes, shown only this once.
+func (s *Service) ConfirmTOTP(userID, code string) (RecoveryCodesResponse, error) {
+	ctx := context.Background()
+	st, found, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return RecoveryCodesResponse{}, apperr.Internal("failed to load 2fa state")
+	}
+	if !found {
+		return RecoveryCodesResponse{}, apperr.Conflict("TWO_FACTOR_NOT_STARTED", "2fa enrollment not started")
+	}
+	if st.Enabled {
+		return RecoveryCodesResponse{}, ErrTwoFactorEnabled
+	}
+	counter, ok := VerifyTOTP(st.Secret, code, s.now())
+	if !ok {
+		return RecoveryCodesResponse{}, errInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return RecoveryCodesResponse{}, apperr.Internal("failed to create recovery codes")
+	}
+	ok, err = s.repo.EnableTOTP(ctx, userID, counter, hashes)
+	if err != nil {
+		return RecoveryCodesResponse{}, apperr.Internal("failed to enable 2fa")
+	}
+	if !ok {
+		return RecoveryCodesResponse{}, ErrTwoFactorEnabled
+	}
+	return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP needs a current code (or recovery code) so a stolen session alone can't do it.
+func (s *Service) DisableTOTP(userID, username, code, ip string) error {
+	ctx := context.Background()
+	if err := s.reauthSecondFactor(ctx, userID, username, code, ip); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTOTP(ctx, userID); err != nil {
+		return apperr.Internal("failed to disable 2fa")
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not.
+func (s *Service) RegenerateRecoveryCodes(userID, username, code, ip string) (RecoveryCodesResponse, error) {
+	ctx := context.Background()
+	if err := s.reauthSecondFactor(ctx, userID, username, code, ip); err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return RecoveryCodesResponse{}, apperr.Internal("failed to create recovery codes")
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return RecoveryCodesResponse{}, apperr.Internal("failed to save recovery codes")
+	}
+	return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// reauthSecondFactor checks the code a signed-in user gives to change 2FA
+// settings. It shares CompleteLogin's lockout and audit trail, so a stolen
+// session can't be used to guess codes.
+func (s *Service) reauthSecondFactor(ctx context.Context, userID, username, code, ip string) error {
+	if blocked, outcome := s.loginGate(ctx, username, ip); blocked != nil {
+		s.auditLogin(ctx, username, &userID, ip, outcome)
+		return blocked
+	}
+	if err := s.checkSecondFactor(ctx, userID, code); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			s.auditLogin(ctx, username, &userID, ip, loginFailure)
+		}
+		return err
+	}
+	return nil
+}
+
+// CompleteLogin exchanges a Login challenge plus a TOTP or recovery code for
+// a session token. Wrong codes count towards the same lockout as passwords.
+func (s *Service) CompleteLogin(challenge, code, ip string) (LoginResponse, error) {
+	ctx := context.Background()
+
+	userID, username, err := parseToken(s.jwtSecret, strings.TrimSpace(challenge), purposeTwoFactor)
+	if err != nil || userID == "" {
+		return LoginResponse{}, apperr.Unauthorized("invalid or expired challenge")
+	}
+
+	if blocked, outcome := s.loginGate(ctx, username, ip); blocked != nil {
+		s.auditLogin(ctx, username, &userID, ip, outcome)
+		return LoginResponse{}, blocked
+	}
+
+	if err := s.checkSecondFactor(ctx, userID, code); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			s.auditLogin(ctx, username, &userID, ip, loginFailure)
+		}
+		return LoginResponse{}, err
+	}
+
+	s.auditLogin(ctx, username, &userID, ip, loginSuccess)
+	return s.session(userID, username)
+}
+
+// twoFactorChallenge is what Login returns instead of a session for 2FA users.
+func (s *Service) twoFactorChallenge(userID, username string) (LoginResponse, error) {
+	tok, err := issueToken(s.jwtSecret, userID, username, purposeTwoFactor, s.now().Add(challengeTTL))
+	if err != nil {
+		return LoginResponse{}, apperr.Internal("failed to issue challenge")
+	}
+	return LoginResponse{TwoFactorRequired: true, ChallengeToken: tok}, nil
+}
+
+func (s *Service) session(userID, username string) (LoginResponse, error) {
+	tok, err := IssueToken(s.jwtSecret, userID, username, s.now().Add(7*24*time.Hour))
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{Token: tok}, nil
+}
+
+// checkSecondFactor accepts a 6-digit TOTP code (each time step once) or an
+// unused recovery code (each once).
+func (s *Service) checkSecondFactor(ctx context.Context, userID, code string) error {
+	st, found, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return apperr.Internal("failed to load 2fa state")
+	}
+	if !found || !st.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) == totpDigits {
+		counter, ok := VerifyTOTP(st.Secret, code, s.now())
+		if !ok || counter <= st.LastCounter {
+			return errInvalidCode
+		}
+		// Conditional on last_counter, so two concurrent uses of one code can't both win.
+		ok, err = s.repo.UseTOTPCounter(ctx, userID, counter)
+		if err != nil {
+			return apperr.Internal("failed to verify code")
+		}
+		if !ok {
+			return errInvalidCode
+		}
+		return nil
+	}
+
+	ok, err := s.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return apperr.Internal("failed to verify code")
+	}
+	if !ok {
+		return errInvalidCode
+	}
+	return nil
+}
+
+// Recovery codes look like "k3j9x-2mf7q": 50 random bits, so a plain
+// SHA-256 is enough to store them.
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	norm := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:])
+}
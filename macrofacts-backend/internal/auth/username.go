@@ -1,17 +1,18 @@
 package auth
 
 import (
-	"errors"
 	"regexp"
 	"strings"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 )
 
 var (
 	usernameRe = regexp.MustCompile(`^[A-Z0-9_.]{3,32}$`)
 
-	ErrUsernameInvalid = errors.New("username_invalid")
-	ErrUsernameTaken   = errors.New("username_taken")
-	ErrPasswordInvalid = errors.New("password_invalid")
+	ErrUsernameInvalid = apperr.InvalidField("username", "username must be 3-32 letters, digits, _ or .").WithCode("USERNAME_INVALID")
+	ErrUsernameTaken   = apperr.Conflict("USERNAME_TAKEN", "username is already taken")
+	ErrPasswordInvalid = apperr.InvalidField("password", "password must be 8-128 characters").WithCode("PASSWORD_INVALID")
 )
 
 func CanonicalizeUsername(s string) (string, error) {
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/event"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/metrics"
+)
+
+// ExportPoolStats publishes the Postgres pool's stats, read on each scrape.
+// Call it once per process.
+func ExportPoolStats(pool *pgxpool.Pool) {
+	gauge := func(name, help string, fn func(*pgxpool.Stat) float64) {
+		metrics.NewGaugeFunc(name, help, func() float64 { return fn(pool.Stat()) })
+	}
+	counter := func(name, help string, fn func(*pgxpool.Stat) float64) {
+		metrics.NewCounterFunc(name, help, func() float64 { return fn(pool.Stat()) })
+	}
+
+	gauge("pgxpool_total_conns", "Open Postgres connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("pgxpool_acquired_conns", "Postgres connections in use.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("pgxpool_idle_conns", "Idle Postgres connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	gauge("pgxpool_constructing_conns", "Postgres connections being opened.",
+		func(s *pgxpool.Stat) float64 { return float64(s.ConstructingConns()) })
+	gauge("pgxpool_max_conns", "Postgres pool size limit.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	counter("pgxpool_acquires_total", "Postgres connection acquires.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("pgxpool_empty_acquires_total", "Acquires that had to wait because no connection was idle.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("pgxpool_canceled_acquires_total", "Acquires cancelled by their context.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+	counter("pgxpool_acquire_duration_seconds_total", "Time spent waiting to acquire connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+	counter("pgxpool_new_conns_total", "Postgres connections opened.",
+		func(s *pgxpool.Stat) float64 { return float64(s.NewConnsCount()) })
+}
+
+var (
+	mongoConns       = metrics.NewGauge("mongo_pool_conns", "Open Mongo connections.").With()
+	mongoInUse       = metrics.NewGauge("mongo_pool_in_use_conns", "Mongo connections checked out.").With()
+	mongoCheckouts   = metrics.NewCounter("mongo_pool_checkouts_total", "Mongo connection checkouts by result (ok or failed).", "result")
+	mongoCheckoutDur = metrics.NewHistogram("mongo_pool_checkout_duration_seconds", "Time to check out a Mongo connection.", nil).With()
+	mongoCleared     = metrics.NewCounter("mongo_pool_cleared_total", "Mongo pools cleared after errors.").With()
+)
+
+// MongoPoolMonitor tracks the Mongo driver's pool; pass it to
+// options.Client().SetPoolMonitor.
+func MongoPoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: func(e *event.PoolEvent) {
+		switch e.Type {
+		case event.ConnectionCreated:
+			mongoConns.Add(1)
+		case event.ConnectionClosed:
+			mongoConns.Add(-1)
+		case event.GetSucceeded:
+			mongoInUse.Add(1)
+			mongoCheckouts.With("ok").Inc()
+			mongoCheckoutDur.Observe(e.Duration.Seconds())
+		case event.GetFailed:
+			mongoCheckouts.With("failed").Inc()
+		case event.ConnectionReturned:
+			mongoInUse.Add(-1)
+		case event.PoolCleared:
+			mongoCleared.Inc()
+		}
+	}}
+}
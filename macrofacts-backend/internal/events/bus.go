@@ -0,0 +1,181 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Event types pushed to clients.
+const (
+	EntryCreated = "entry.created"
+	EntryUpdated = "entry.updated"
+	EntryDeleted = "entry.deleted"
+	DaySummary   = "day.summary"
+	WeightLogged = "weight.logged"
+)
+
+// Event is a per-user change notification. Data is the JSON payload sent to
+// the client as-is.
+type Event struct {
+	UserID string          `json:"userId"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+	At     time.Time       `json:"at"`
+}
+
+// How many undelivered events a subscriber may queue before new ones are dropped.
+const subscriberBuffer = 32
+
+// Bus fans events out to subscribers of the same user. By default delivery
+// is in-process only; after UsePostgres, events go through LISTEN/NOTIFY so
+// every API replica sees them.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan Event]struct{}
+
+	hooks  []hook
+	pg     *pgxpool.Pool
+	closed bool
+}
+
+// Hook sees each event once, on the replica that published it (relayed
+// NOTIFYs from other replicas don't trigger it). Hooks run synchronously in
+// Publish, so keep them quick.
+type Hook func(ctx context.Context, ev Event)
+
+// Interest says whether a hook would act on a user's events of typ. It lets
+// publishers skip building payloads nobody will see; nil means always.
+type Interest func(ctx context.Context, userID, typ string) bool
+
+type hook struct {
+	fn    Hook
+	wants Interest
+}
+
+// AddHook registers h; call during startup, before serving requests.
+func (b *Bus) AddHook(h Hook, wants Interest) {
+	b.hooks = append(b.hooks, hook{fn: h, wants: wants})
+}
+
+// Wants reports whether an event of typ for userID could reach anyone: a
+// stream on this replica or an interested hook. With Postgres fan-out a
+// stream may be open on another replica, so the answer is always yes.
+func (b *Bus) Wants(ctx context.Context, userID, typ string) bool {
+	if b == nil || userID == "" {
+		return false
+	}
+	if b.pg != nil {
+		return true
+	}
+	b.mu.RLock()
+	streams := len(b.subs[userID])
+	b.mu.RUnlock()
+	if streams > 0 {
+		return true
+	}
+	for _, h := range b.hooks {
+		if h.wants == nil || h.wants(ctx, userID, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string]map[chan Event]struct{})}
+}
+
+// Publish never blocks on slow subscribers and never fails the caller; a
+// lost event only means a client refreshes on its next reconnect.
+func (b *Bus) Publish(ctx context.Context, userID, typ string, data any) {
+	if b == nil || userID == "" {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Warn("event encode failed", "type", typ, "err", err)
+		return
+	}
+	ev := Event{UserID: userID, Type: typ, Data: raw, At: time.Now().UTC()}
+
+	for _, h := range b.hooks {
+		h.fn(context.WithoutCancel(ctx), ev)
+	}
+
+	if b.pg != nil {
+		if err := b.notify(ctx, ev); err == nil {
+			return
+		} else {
+			slog.Warn("event notify failed, delivering locally", "type", typ, "err", err)
+		}
+	}
+	b.deliver(ev)
+}
+
+// Subscribe returns a channel of the user's events and a func to stop.
+func (b *Bus) Subscribe(userID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[chan Event]struct{})
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			if b.closed {
+				b.mu.Unlock()
+				return
+			}
+			delete(b.subs[userID], ch)
+			if len(b.subs[userID]) == 0 {
+				delete(b.subs, userID)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Close ends every subscription (their channels close) so long-lived
+// streams can finish during shutdown.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for ch := range subs {
+			close(ch)
+		}
+	}
+	b.subs = nil
+}
+
+func (b *Bus) deliver(ev Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subs[ev.UserID] {
+		select {
+		case ch <- ev:
+		default:
+			// Subscriber isn't keeping up; drop rather than stall publishers.
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWants(t *testing.T) {
+	ctx := context.Background()
+	var nilBus *Bus
+	if nilBus.Wants(ctx, "u1", DaySummary) {
+		t.Fatal("nil bus wants events")
+	}
+
+	b := NewBus()
+	if b.Wants(ctx, "u1", DaySummary) {
+		t.Fatal("no streams or hooks, but wants events")
+	}
+
+	_, stop := b.Subscribe("u1")
+	if !b.Wants(ctx, "u1", DaySummary) {
+		t.Fatal("open stream not counted")
+	}
+	if b.Wants(ctx, "u2", DaySummary) {
+		t.Fatal("u1's stream counted for u2")
+	}
+	stop()
+	if b.Wants(ctx, "u1", DaySummary) {
+		t.Fatal("closed stream still counted")
+	}
+
+	var asked []string
+	b.AddHook(func(context.Context, Event) {}, func(_ context.Context, userID, typ string) bool {
+		asked = append(asked, userID+" "+typ)
+		return userID == "u2"
+	})
+	if b.Wants(ctx, "u1", DaySummary) || !b.Wants(ctx, "u2", DaySummary) {
+		t.Fatal("hook interest not respected")
+	}
+	if len(asked) != 2 || asked[1] != "u2 "+DaySummary {
+		t.Fatalf("interest asked %v", asked)
+	}
+
+	// A hook without an Interest wants everything.
+	b.AddHook(func(context.Context, Event) {}, nil)
+	if !b.Wants(ctx, "u3", EntryCreated) {
+		t.Fatal("hook without interest not counted")
+	}
+}
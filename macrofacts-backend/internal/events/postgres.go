@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Channel name shared by every replica.
+const pgChannel = "macrofacts_events"
+
+// NOTIFY payloads are capped at 8000 bytes by Postgres.
+const maxNotifyPayload = 7900
+
+// UsePostgres routes events through LISTEN/NOTIFY. Call Listen in its own
+// goroutine so this replica receives them too.
+func (b *Bus) UsePostgres(pool *pgxpool.Pool) {
+	b.pg = pool
+}
+
+func (b *Bus) notify(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return errors.New("event too large for notify")
+	}
+	_, err = b.pg.Exec(ctx, `select pg_notify($1, $2)`, pgChannel, string(payload))
+	return err
+}
+
+// Listen holds a dedicated connection on the events channel and delivers
+// notifications locally until ctx is done, reconnecting with backoff.
+func (b *Bus) Listen(ctx context.Context) {
+	if b.pg == nil {
+		return
+	}
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("event listener disconnected", "err", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (b *Bus) listenOnce(ctx context.Context) error {
+	pooled, err := b.pg.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN state is per-connection; take it out of the pool for good.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "listen "+pgChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var ev Event
+		if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+			slog.Warn("event decode failed", "err", err)
+			continue
+		}
+		b.deliver(ev)
+	}
+}
@@ -3,6 +3,16 @@ package foods
 import (
 	"sync"
 	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/metrics"
+)
+
+var (
+	cacheHits         = metrics.NewCounter("foods_barcode_cache_hits_total", "Barcode cache hits for found foods.").With()
+	cacheNegativeHits = metrics.NewCounter("foods_barcode_cache_negative_hits_total", "Barcode cache hits for cached not-found results.").With()
+	cacheMisses       = metrics.NewCounter("foods_barcode_cache_misses_total", "Barcode cache misses, including expired entries.").With()
+	cacheEvictions    = metrics.NewCounter("foods_barcode_cache_evictions_total", "Barcode cache entries removed, by reason (expired or capacity).", "reason")
+	cacheEntries      = metrics.NewGauge("foods_barcode_cache_entries", "Entries in the barcode cache.").With()
 )
 
 // barcodeCache is a tiny, boring in-memory TTL cache.
@@ -37,13 +47,22 @@ func (c *barcodeCache) get(code string) (*FoodDTO, bool) {
 	defer c.mu.Unlock()
 	e, ok := c.m[code]
 	if !ok {
+		cacheMisses.Inc()
 		return nil, false
 	}
 	if now.After(e.expires) {
 		delete(c.m, code)
+		cacheEvictions.With("expired").Inc()
+		cacheEntries.Set(float64(len(c.m)))
+		cacheMisses.Inc()
 		return nil, false
 	}
 	// dto can be nil to represent a cached "not found".
+	if e.dto == nil {
+		cacheNegativeHits.Inc()
+	} else {
+		cacheHits.Inc()
+	}
 	return e.dto, true
 }
 
@@ -55,6 +74,7 @@ func (c *barcodeCache) set(code string, dto *FoodDTO) {
 	defer c.mu.Unlock()
 	c.evictIfNeededLocked()
 	c.m[code] = cacheEntry{dto: dto, expires: time.Now().Add(c.posTTL)}
+	cacheEntries.Set(float64(len(c.m)))
 }
 
 func (c *barcodeCache) setNotFound(code string) {
@@ -65,6 +85,7 @@ func (c *barcodeCache) setNotFound(code string) {
 	defer c.mu.Unlock()
 	c.evictIfNeededLocked()
 	c.m[code] = cacheEntry{dto: nil, expires: time.Now().Add(c.negTTL)}
+	cacheEntries.Set(float64(len(c.m)))
 }
 
 func (c *barcodeCache) evictIfNeededLocked() {
@@ -78,6 +99,7 @@ func (c *barcodeCache) evictIfNeededLocked() {
 	}
 	for k := range c.m {
 		delete(c.m, k)
+		cacheEvictions.With("capacity").Inc()
 		n--
 		if n <= 0 {
 			break
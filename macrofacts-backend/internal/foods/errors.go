@@ -1,12 +1,9 @@
 package foods
 
-type NotFoundError struct {
-	Msg string
-}
+import "github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 
-func (e NotFoundError) Error() string { return e.Msg }
+var errRecipeNotFound = apperr.NotFound("recipe not found")
 
 func IsNotFound(err error) bool {
-	_, ok := err.(NotFoundError)
-	return ok
+	return apperr.KindOf(err) == apperr.KindNotFound
 }
@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
 )
 
 type SearchResponse struct {
@@ -39,7 +41,10 @@ func (h *Handler) Search(c *gin.Context) {
 	limit := parseLimit(c.Query("limit"), 25)
 	cursor := strings.TrimSpace(c.Query("cursor"))
 
-	out, next, err := h.svc.Search(c.Request.Context(), q, limit, cursor)
+	// Empty for anonymous requests (OptionalMiddleware sets it when a valid token is sent).
+	userID := c.GetString("userId")
+
+	out, next, err := h.svc.Search(c.Request.Context(), userID, q, limit, cursor)
 	if err != nil {
 		httpapi.Internal(c, "search failed")
 		return
@@ -48,7 +53,11 @@ func (h *Handler) Search(c *gin.Context) {
 }
 
 func (h *Handler) ByBarcode(c *gin.Context) {
-	code := c.Param("code")
+	code := strings.TrimSpace(c.Param("code"))
+	if !validate.IsBarcodeLookup(code) {
+		httpapi.Error(c, apperr.InvalidField("code", "barcode must be 4-14 digits"))
+		return
+	}
 
 	dto, err := h.svc.ByBarcode(c.Request.Context(), code)
 	if err != nil {
@@ -78,13 +87,81 @@ func (h *Handler) CreateCustom(c *gin.Context) {
 
 	dto, err := h.svc.CreateCustom(c.Request.Context(), userID, req)
 	if err != nil {
-		httpapi.Internal(c, "create failed")
+		httpapi.Error(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, ItemResponse{Item: &dto})
 }
 
+func (h *Handler) ListRecipes(c *gin.Context) {
+	userID := c.GetString("userId")
+	resp, err := h.svc.ListRecipes(c.Request.Context(), userID)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) GetRecipe(c *gin.Context) {
+	userID := c.GetString("userId")
+	id := c.Param("id")
+
+	rec, err := h.svc.Recipe(c.Request.Context(), userID, id)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+func (h *Handler) CreateRecipe(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req RecipeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	rec, err := h.svc.CreateRecipe(c.Request.Context(), userID, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, rec)
+}
+
+func (h *Handler) UpdateRecipe(c *gin.Context) {
+	userID := c.GetString("userId")
+	id := c.Param("id")
+
+	var req RecipeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	rec, err := h.svc.UpdateRecipe(c.Request.Context(), userID, id, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+func (h *Handler) DeleteRecipe(c *gin.Context) {
+	userID := c.GetString("userId")
+	id := c.Param("id")
+
+	if err := h.svc.DeleteRecipe(c.Request.Context(), userID, id); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 func parseLimit(s string, def int) int {
 	if s == "" {
 		return def
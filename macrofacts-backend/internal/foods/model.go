@@ -5,6 +5,10 @@ type FoodSource string
 const (
 	FoodSourceOFF    FoodSource = "off"
 	FoodSourceCustom FoodSource = "custom"
+	FoodSourceRecipe FoodSource = "recipe"
+
+	// Quick entries are log-only: a label and user-entered values, no food behind them.
+	FoodSourceQuick FoodSource = "quick"
 )
 
 // Canonical food representation used across sources (OFF + custom foods).
@@ -51,8 +55,13 @@ type FoodDTO struct {
 
 // CreateFoodRequest is what the API accepts when users add foods.
 // Optional fields are pointers so "unset" is distinct from "set empty".
+// Checked by validateFood; 0 is a valid value for the core macros.
 type CreateFoodRequest struct {
-	Name string `json:"name" binding:"required"`
+	// Client-generated UUID so offline clients can reference the food before
+	// it syncs; generated server-side when omitted.
+	ID *string `json:"id,omitempty"`
+
+	Name string `json:"name"`
 
 	Brand   *string `json:"brand,omitempty"`
 	Barcode *string `json:"barcode,omitempty"`
@@ -61,10 +70,10 @@ type CreateFoodRequest struct {
 	Quantity    *string  `json:"quantity,omitempty"`
 	ServingG    *float64 `json:"servingG,omitempty"`
 
-	KcalPer100g    float64 `json:"kcalPer100g" binding:"required"`
-	ProteinPer100g float64 `json:"proteinPer100g" binding:"required"`
-	CarbsPer100g   float64 `json:"carbsPer100g" binding:"required"`
-	FatPer100g     float64 `json:"fatPer100g" binding:"required"`
+	KcalPer100g    float64 `json:"kcalPer100g"`
+	ProteinPer100g float64 `json:"proteinPer100g"`
+	CarbsPer100g   float64 `json:"carbsPer100g"`
+	FatPer100g     float64 `json:"fatPer100g"`
 
 	FiberPer100g *float64 `json:"fiberPer100g,omitempty"`
 	SugarPer100g *float64 `json:"sugarPer100g,omitempty"`
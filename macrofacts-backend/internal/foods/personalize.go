@@ -0,0 +1,58 @@
+package foods
+
+import "context"
+
+// How many of the user's own foods can be pinned above OFF results on page one.
+const maxHistoryMatches = 5
+
+// HistoryMatch is a food the user has logged before that matches a search,
+// scored by how often and how recently they logged it.
+type HistoryMatch struct {
+	Source FoodSource
+	Ref    string // barcode for OFF, UUID for custom/recipe
+	Score  float64
+}
+
+// HistoryProvider supplies per-user search matches from the food log. It lives
+// behind an interface because the logs package already depends on foods.
+type HistoryProvider interface {
+	MatchHistory(ctx context.Context, userID string, tokens []string, limit int) ([]HistoryMatch, error)
+}
+
+// SetHistoryProvider enables personalized ranking for authenticated searches.
+func (s *Service) SetHistoryProvider(p HistoryProvider) {
+	s.history = p
+}
+
+// historyFoods resolves the user's best-matching logged foods, best first.
+// Failures degrade to plain search rather than failing the request.
+func (s *Service) historyFoods(ctx context.Context, userID string, tokens []string) []FoodDTO {
+	if s.history == nil || userID == "" || len(tokens) == 0 {
+		return nil
+	}
+	matches, err := s.history.MatchHistory(ctx, userID, tokens, maxHistoryMatches)
+	if err != nil {
+		return nil
+	}
+
+	out := make([]FoodDTO, 0, len(matches))
+	for _, m := range matches {
+		var dto *FoodDTO
+		switch m.Source {
+		case FoodSourceOFF:
+			dto, _ = s.ByBarcode(ctx, m.Ref)
+		case FoodSourceCustom:
+			if d, err := s.customRepo.ByID(ctx, m.Ref); err == nil {
+				dto = &d
+			}
+		case FoodSourceRecipe:
+			if d, err := s.ByRecipeID(ctx, userID, m.Ref); err == nil {
+				dto = &d
+			}
+		}
+		if dto != nil {
+			out = append(out, *dto)
+		}
+	}
+	return out
+}
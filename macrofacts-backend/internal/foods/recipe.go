@@ -0,0 +1,320 @@
+package foods
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+// Recipes can nest (a sauce inside a lasagne); anything deeper than this is
+// almost certainly a cycle that slipped past the save-time check.
+const maxRecipeDepth = 5
+
+type RecipeIngredientInput struct {
+	Source    FoodSource `json:"source" binding:"required"`
+	FoodID    *string    `json:"foodId,omitempty"`  // custom food or recipe ID
+	Barcode   *string    `json:"barcode,omitempty"` // OFF
+	QuantityG float64    `json:"quantity_g" binding:"required"`
+}
+
+type RecipeRequest struct {
+	Name     string  `json:"name" binding:"required"`
+	Servings float64 `json:"servings" binding:"required"`
+	// Weight of the finished dish. Defaults to the sum of raw ingredient weights;
+	// set it when cooking gains or loses water (pasta, stews) so per-100g is right.
+	CookedWeightG *float64                `json:"cookedWeightG,omitempty"`
+	Ingredients   []RecipeIngredientInput `json:"ingredients" binding:"required"`
+}
+
+type RecipeIngredient struct {
+	Source    FoodSource `json:"source"`
+	FoodID    *string    `json:"foodId,omitempty"`
+	Barcode   *string    `json:"barcode,omitempty"`
+	QuantityG float64    `json:"quantity_g"`
+
+	// Resolved at read time; nil Name means the food no longer exists.
+	Name     *string  `json:"name,omitempty"`
+	Calories *float64 `json:"calories,omitempty"`
+}
+
+type NutritionTotals struct {
+	Calories float64 `json:"calories"`
+	ProteinG float64 `json:"protein_g"`
+	CarbsG   float64 `json:"carbs_g"`
+	FatG     float64 `json:"fat_g"`
+}
+
+type Recipe struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Servings      float64            `json:"servings"`
+	CookedWeightG float64            `json:"cookedWeightG"`
+	Ingredients   []RecipeIngredient `json:"ingredients"`
+
+	Total      NutritionTotals `json:"total"`
+	PerServing NutritionTotals `json:"perServing"`
+	// Per100g is the recipe as a food, same shape as search results.
+	Per100g FoodDTO `json:"per100g"`
+}
+
+type RecipeListResponse struct {
+	Items []Recipe `json:"items"`
+}
+
+// nutrientSum accumulates absolute grams/kcal across ingredients. Optional
+// nutrients stay nil until at least one ingredient reports them.
+type nutrientSum struct {
+	kcal, protein, carbs, fat float64
+	optional                  map[string]float64
+}
+
+// optionalNutrients maps DTO fields for the secondary nutrients we carry through recipes.
+var optionalNutrients = []struct {
+	key string
+	get func(*FoodDTO) **float64
+}{
+	{"fiber", func(d *FoodDTO) **float64 { return &d.FiberPer100g }},
+	{"sugar", func(d *FoodDTO) **float64 { return &d.SugarPer100g }},
+	{"salt", func(d *FoodDTO) **float64 { return &d.SaltPer100g }},
+	{"sodium", func(d *FoodDTO) **float64 { return &d.SodiumPer100g }},
+	{"saturated_fat", func(d *FoodDTO) **float64 { return &d.SaturatedFatPer100g }},
+	{"monounsaturated_fat", func(d *FoodDTO) **float64 { return &d.MonounsaturatedFatPer100g }},
+	{"polyunsaturated_fat", func(d *FoodDTO) **float64 { return &d.PolyunsaturatedFatPer100g }},
+	{"alpha_linolenic_acid", func(d *FoodDTO) **float64 { return &d.AlphaLinolenicAcidPer100g }},
+}
+
+func (n *nutrientSum) add(d *FoodDTO, grams float64) {
+	m := grams / 100
+	n.kcal += deref(d.KcalPer100g) * m
+	n.protein += deref(d.ProteinPer100g) * m
+	n.carbs += deref(d.CarbsPer100g) * m
+	n.fat += deref(d.FatPer100g) * m
+
+	for _, on := range optionalNutrients {
+		if v := *on.get(d); v != nil {
+			if n.optional == nil {
+				n.optional = make(map[string]float64)
+			}
+			n.optional[on.key] += *v * m
+		}
+	}
+}
+
+// per100g scales totals for a dish weighing weightG into a FoodDTO.
+func (n nutrientSum) per100g(weightG float64) FoodDTO {
+	f := 100 / weightG
+	dto := FoodDTO{
+		KcalPer100g:    ptr(round1(n.kcal * f)),
+		ProteinPer100g: ptr(round1(n.protein * f)),
+		CarbsPer100g:   ptr(round1(n.carbs * f)),
+		FatPer100g:     ptr(round1(n.fat * f)),
+	}
+	for _, on := range optionalNutrients {
+		if v, ok := n.optional[on.key]; ok {
+			*on.get(&dto) = ptr(round1(v * f))
+		}
+	}
+	return dto
+}
+
+func (n nutrientSum) totals(div float64) NutritionTotals {
+	return NutritionTotals{
+		Calories: round1(n.kcal / div),
+		ProteinG: round1(n.protein / div),
+		CarbsG:   round1(n.carbs / div),
+		FatG:     round1(n.fat / div),
+	}
+}
+
+func validateRecipe(req RecipeRequest) (RecipeRequest, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 200 {
+		return req, apperr.InvalidField("name", "invalid name")
+	}
+	if req.Servings <= 0 || req.Servings > 1000 {
+		return req, apperr.InvalidField("servings", "servings out of range")
+	}
+	if len(req.Ingredients) == 0 || len(req.Ingredients) > 100 {
+		return req, apperr.InvalidField("ingredients", "ingredients required")
+	}
+	if req.CookedWeightG != nil && (*req.CookedWeightG <= 0 || *req.CookedWeightG > 100000) {
+		return req, apperr.Invalid("cooked weight out of range")
+	}
+
+	for i, in := range req.Ingredients {
+		if in.QuantityG <= 0 || in.QuantityG > 50000 {
+			return req, apperr.Invalid("ingredient quantity out of range")
+		}
+		switch in.Source {
+		case FoodSourceOFF:
+			code := strings.TrimSpace(derefStr(in.Barcode))
+			if code == "" {
+				code = strings.TrimSpace(derefStr(in.FoodID))
+			}
+			if code == "" {
+				return req, apperr.InvalidField("barcode", "barcode required for off")
+			}
+			req.Ingredients[i].Barcode = &code
+			req.Ingredients[i].FoodID = nil
+		case FoodSourceCustom, FoodSourceRecipe:
+			if strings.TrimSpace(derefStr(in.FoodID)) == "" {
+				return req, apperr.Invalid("foodId required for " + string(in.Source))
+			}
+			req.Ingredients[i].Barcode = nil
+		default:
+			return req, apperr.Invalid("invalid ingredient source")
+		}
+	}
+	return req, nil
+}
+
+// buildRecipe resolves every ingredient and computes the nutrition views.
+// depth guards against cycles through nested recipes.
+func (s *Service) buildRecipe(ctx context.Context, userID string, row recipeRow, depth int) (Recipe, error) {
+	if depth > maxRecipeDepth {
+		return Recipe{}, apperr.Invalid("recipe nesting too deep")
+	}
+
+	rec := Recipe{
+		ID:          row.ID,
+		Name:        row.Name,
+		Servings:    row.Servings,
+		Ingredients: make([]RecipeIngredient, 0, len(row.Ingredients)),
+	}
+
+	var sum nutrientSum
+	var rawWeight float64
+	for _, in := range row.Ingredients {
+		item := RecipeIngredient{
+			Source:    in.Source,
+			FoodID:    in.FoodID,
+			Barcode:   in.Barcode,
+			QuantityG: in.QuantityG,
+		}
+		rawWeight += in.QuantityG
+
+		dto, err := s.resolveIngredient(ctx, userID, in, depth)
+		if err != nil {
+			return Recipe{}, err
+		}
+		if dto != nil {
+			name := dto.Name
+			kcal := round1(deref(dto.KcalPer100g) * in.QuantityG / 100)
+			item.Name = &name
+			item.Calories = &kcal
+			sum.add(dto, in.QuantityG)
+		}
+		rec.Ingredients = append(rec.Ingredients, item)
+	}
+
+	rec.CookedWeightG = rawWeight
+	if row.CookedWeightG != nil {
+		rec.CookedWeightG = *row.CookedWeightG
+	}
+
+	rec.Total = sum.totals(1)
+	rec.PerServing = sum.totals(rec.Servings)
+
+	per100 := sum.per100g(rec.CookedWeightG)
+	per100.ID = rec.ID
+	per100.Source = FoodSourceRecipe
+	per100.Name = rec.Name
+	per100.ServingG = ptr(round1(rec.CookedWeightG / rec.Servings))
+	rec.Per100g = per100
+
+	return rec, nil
+}
+
+// resolveIngredient returns nil (not an error) when an OFF/custom food has
+// disappeared, so one stale ingredient doesn't make the whole recipe unreadable.
+func (s *Service) resolveIngredient(ctx context.Context, userID string, in recipeIngredientRow, depth int) (*FoodDTO, error) {
+	switch in.Source {
+	case FoodSourceOFF:
+		return s.ByBarcode(ctx, derefStr(in.Barcode))
+	case FoodSourceCustom:
+		d, err := s.customRepo.ByID(ctx, derefStr(in.FoodID))
+		if err != nil {
+			return nil, nil
+		}
+		return &d, nil
+	case FoodSourceRecipe:
+		row, err := s.recipeRepo.ByID(ctx, userID, derefStr(in.FoodID))
+		if err != nil {
+			return nil, nil
+		}
+		sub, err := s.buildRecipe(ctx, userID, row, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &sub.Per100g, nil
+	}
+	return nil, nil
+}
+
+// checkNoCycle walks the nested recipes of `ingredients` and fails if any path
+// leads back to recipeID.
+func (s *Service) checkNoCycle(ctx context.Context, userID, recipeID string, ingredients []RecipeIngredientInput) error {
+	seen := map[string]bool{}
+	var walk func(ids []string, depth int) error
+	walk = func(ids []string, depth int) error {
+		if depth > maxRecipeDepth {
+			return apperr.Invalid("recipe nesting too deep")
+		}
+		for _, id := range ids {
+			if id == recipeID {
+				return apperr.Invalid("recipe cannot contain itself")
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			row, err := s.recipeRepo.ByID(ctx, userID, id)
+			if err != nil {
+				return apperr.NotFound("ingredient recipe not found")
+			}
+			var next []string
+			for _, in := range row.Ingredients {
+				if in.Source == FoodSourceRecipe {
+					next = append(next, derefStr(in.FoodID))
+				}
+			}
+			if err := walk(next, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var ids []string
+	for _, in := range ingredients {
+		if in.Source == FoodSourceRecipe {
+			ids = append(ids, derefStr(in.FoodID))
+		}
+	}
+	return walk(ids, 1)
+}
+
+func deref(p *float64) float64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func derefStr(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -4,12 +4,20 @@ import (
 	"context"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/metrics"
 )
 
+// Mongo is the slow part of search, so buckets reach further than HTTP's.
+var offQueryDuration = metrics.NewHistogram("foods_off_query_duration_seconds",
+	"OpenFoodFacts Mongo query latency. op is barcode or search; mode is the search mode, or exact for barcodes.",
+	[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}, "op", "mode")
+
 type RepoMongoOFF struct {
 	col        *mongo.Collection
 	searchMode string // "keywords" | "regex" | "text"
@@ -83,6 +91,7 @@ func (r *RepoMongoOFF) ByBarcode(ctx context.Context, code string) (*OffFoodDoc,
 	if code == "" {
 		return nil, nil
 	}
+	defer observeOFF("barcode", "exact", time.Now())
 
 	// 1) Try "code" first (works on standard OFF dumps)
 	filter := bson.M{
@@ -127,6 +136,10 @@ func (r *RepoMongoOFF) ByBarcode(ctx context.Context, code string) (*OffFoodDoc,
 	return &out, nil
 }
 
+func observeOFF(op, mode string, start time.Time) {
+	offQueryDuration.With(op, mode).Observe(time.Since(start).Seconds())
+}
+
 func (r *RepoMongoOFF) SearchByNameOrBrand(
 	ctx context.Context,
 	q string,
@@ -138,6 +151,7 @@ func (r *RepoMongoOFF) SearchByNameOrBrand(
 	if len(tokens) == 0 {
 		return []OffFoodDoc{}, nil, nil
 	}
+	defer observeOFF("search", r.searchMode, time.Now())
 
 	filter := bson.M{
 		"_keywords": bson.M{"$in": tokens},
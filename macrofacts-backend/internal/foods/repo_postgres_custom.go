@@ -6,8 +6,11 @@ import (
 	"errors"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 )
 
 type RepoPostgresCustom struct {
@@ -21,7 +24,7 @@ func NewRepoPostgresCustom(db *pgxpool.Pool) *RepoPostgresCustom {
 func (r *RepoPostgresCustom) Create(ctx context.Context, userID string, req CreateFoodRequest) (FoodDTO, error) {
 	name := strings.TrimSpace(req.Name)
 	if name == "" {
-		return FoodDTO{}, errors.New("name required")
+		return FoodDTO{}, apperr.InvalidField("name", "name required")
 	}
 
 	// Build OFF-compatible nutriments payload for long-term parity with OFF.
@@ -69,19 +72,19 @@ func (r *RepoPostgresCustom) Create(ctx context.Context, userID string, req Crea
 
 	nutrimentsJSON, err := json.Marshal(nutriments)
 	if err != nil {
-		return FoodDTO{}, errors.New("failed to encode nutriments")
+		return FoodDTO{}, apperr.Internal("failed to encode nutriments")
 	}
 
 	var id string
 	err = r.db.QueryRow(ctx, `
 		insert into foods_custom
-			(created_by_user_id, name, brand, barcode,
+			(id, created_by_user_id, name, brand, barcode,
 			 kcal_per_100g, protein_g_per_100g, fat_g_per_100g, carbs_g_per_100g,
 			 fiber_g_per_100g, sugar_g_per_100g, salt_g_per_100g,
 			 serving_g,
 			 nutriments)
 		values
-			($1, $2, $3, $4,
+			(coalesce(nullif($14, '')::uuid, gen_random_uuid()), $1, $2, $3, $4,
 			 $5, $6, $7, $8,
 			 $9, $10, $11,
 			 $12,
@@ -101,16 +104,23 @@ func (r *RepoPostgresCustom) Create(ctx context.Context, userID string, req Crea
 		req.SaltPer100g,
 		req.ServingG,
 		nutrimentsJSON,
+		derefStr(req.ID),
 	).Scan(&id)
 
 	if err != nil {
-		// Unique constraint for barcode
+		// Unique constraint for barcode (or a reused client id)
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if pgErr.Code == "23505" { // unique_violation
-				return FoodDTO{}, errors.New("barcode already exists")
+				if pgErr.ConstraintName == "foods_custom_pkey" {
+					return FoodDTO{}, apperr.Conflict("ID_EXISTS", "id already exists")
+				}
+				return FoodDTO{}, apperr.Conflict("BARCODE_EXISTS", "barcode already exists")
+			}
+			if pgErr.Code == "22P02" { // invalid_text_representation
+				return FoodDTO{}, apperr.InvalidField("id", "invalid id")
 			}
 		}
-		return FoodDTO{}, errors.New("failed to create food")
+		return FoodDTO{}, apperr.Internal("failed to create food")
 	}
 
 	return r.ByID(ctx, id)
@@ -157,8 +167,11 @@ func (r *RepoPostgresCustom) ByID(ctx context.Context, id string) (FoodDTO, erro
 		&dto.Verified,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return FoodDTO{}, apperr.NotFound("food not found")
+	}
 	if err != nil {
-		return FoodDTO{}, errors.New("not found")
+		return FoodDTO{}, apperr.Internal("failed to load food")
 	}
 
 	// Map nutriments JSONB into the extended DTO nutrient fields (same keys as OFF).
@@ -179,7 +192,7 @@ func (r *RepoPostgresCustom) ByID(ctx context.Context, id string) (FoodDTO, erro
 func (r *RepoPostgresCustom) ByBarcode(ctx context.Context, code string) (*FoodDTO, error) {
 	code = strings.TrimSpace(code)
 	if code == "" {
-		return nil, errors.New("empty barcode")
+		return nil, apperr.InvalidField("barcode", "empty barcode")
 	}
 
 	var dto FoodDTO
@@ -224,7 +237,7 @@ func (r *RepoPostgresCustom) ByBarcode(ctx context.Context, code string) (*FoodD
 	)
 
 	if err != nil {
-		return nil, errors.New("not found")
+		return nil, apperr.NotFound("food not found")
 	}
 
 	if len(nutrimentsJSON) > 0 {
@@ -240,3 +253,67 @@ func (r *RepoPostgresCustom) ByBarcode(ctx context.Context, code string) (*FoodD
 
 	return &dto, nil
 }
+
+// CustomFoodChange is a custom food as of a sync version.
+type CustomFoodChange struct {
+	Version int64
+	Food    FoodDTO
+}
+
+// ChangedSince lists the user's custom foods with version > since, oldest
+// change first. since < 0 means everything.
+func (r *RepoPostgresCustom) ChangedSince(ctx context.Context, userID string, since int64, limit int) ([]CustomFoodChange, error) {
+	rows, err := r.db.Query(ctx, `
+		select id::text, version
+		from foods_custom
+		where created_by_user_id = $1 and version > $2
+		order by version asc
+		limit $3
+	`, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	type ref struct {
+		id      string
+		version int64
+	}
+	var refs []ref
+	for rows.Next() {
+		var f ref
+		if err := rows.Scan(&f.id, &f.version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		refs = append(refs, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]CustomFoodChange, 0, len(refs))
+	for _, f := range refs {
+		dto, err := r.ByID(ctx, f.id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, CustomFoodChange{Version: f.version, Food: dto})
+	}
+	return out, nil
+}
+
+// OwnedBy reports whether custom food id exists and was created by userID.
+func (r *RepoPostgresCustom) OwnedBy(ctx context.Context, id, userID string) (exists bool, owned bool, err error) {
+	var owner string
+	err = r.db.QueryRow(ctx, `
+		select created_by_user_id::text from foods_custom where id = $1::uuid
+	`, id).Scan(&owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, owner == userID, nil
+}
@@ -0,0 +1,188 @@
+package foods
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+type RepoPostgresRecipes struct {
+	db *pgxpool.Pool
+}
+
+func NewRepoPostgresRecipes(db *pgxpool.Pool) *RepoPostgresRecipes {
+	return &RepoPostgresRecipes{db: db}
+}
+
+var errRecipeInUse = apperr.Conflict("RECIPE_IN_USE", "recipe is used by another recipe")
+
+type recipeRow struct {
+	ID            string
+	Name          string
+	Servings      float64
+	CookedWeightG *float64
+	Ingredients   []recipeIngredientRow
+}
+
+type recipeIngredientRow struct {
+	Source    FoodSource
+	FoodID    *string
+	Barcode   *string
+	QuantityG float64
+}
+
+func (r *RepoPostgresRecipes) Create(ctx context.Context, userID string, req RecipeRequest) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		insert into recipes (user_id, name, servings, cooked_weight_g)
+		values ($1, $2, $3, $4)
+		returning id::text
+	`, userID, req.Name, req.Servings, req.CookedWeightG).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	if err := insertIngredients(ctx, tx, id, req.Ingredients); err != nil {
+		return "", err
+	}
+	return id, tx.Commit(ctx)
+}
+
+// Update replaces the recipe header and its whole ingredient list.
+func (r *RepoPostgresRecipes) Update(ctx context.Context, userID, id string, req RecipeRequest) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		update recipes
+		set name = $3, servings = $4, cooked_weight_g = $5, updated_at = now()
+		where id = $1::uuid and user_id = $2
+	`, id, userID, req.Name, req.Servings, req.CookedWeightG)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errRecipeNotFound
+	}
+
+	if _, err := tx.Exec(ctx, `delete from recipe_ingredients where recipe_id = $1::uuid`, id); err != nil {
+		return err
+	}
+	if err := insertIngredients(ctx, tx, id, req.Ingredients); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *RepoPostgresRecipes) Delete(ctx context.Context, userID, id string) error {
+	tag, err := r.db.Exec(ctx, `
+		delete from recipes
+		where id = $1::uuid and user_id = $2
+	`, id, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+			return errRecipeInUse
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errRecipeNotFound
+	}
+	return nil
+}
+
+func (r *RepoPostgresRecipes) ByID(ctx context.Context, userID, id string) (recipeRow, error) {
+	var rec recipeRow
+	err := r.db.QueryRow(ctx, `
+		select id::text, name, servings::float8, cooked_weight_g::float8
+		from recipes
+		where id = $1::uuid and user_id = $2
+	`, id, userID).Scan(&rec.ID, &rec.Name, &rec.Servings, &rec.CookedWeightG)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return recipeRow{}, errRecipeNotFound
+	}
+	if err != nil {
+		return recipeRow{}, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		select source, coalesce(food_id, sub_recipe_id)::text, barcode, quantity_g::float8
+		from recipe_ingredients
+		where recipe_id = $1::uuid
+		order by position asc
+	`, id)
+	if err != nil {
+		return recipeRow{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var in recipeIngredientRow
+		var src string
+		if err := rows.Scan(&src, &in.FoodID, &in.Barcode, &in.QuantityG); err != nil {
+			return recipeRow{}, err
+		}
+		in.Source = FoodSource(src)
+		rec.Ingredients = append(rec.Ingredients, in)
+	}
+	return rec, rows.Err()
+}
+
+func (r *RepoPostgresRecipes) ListIDs(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		select id::text
+		from recipes
+		where user_id = $1
+		order by lower(name) asc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func insertIngredients(ctx context.Context, tx pgx.Tx, recipeID string, ingredients []RecipeIngredientInput) error {
+	for i, in := range ingredients {
+		var foodID, subRecipeID *string
+		switch in.Source {
+		case FoodSourceCustom:
+			foodID = in.FoodID
+		case FoodSourceRecipe:
+			subRecipeID = in.FoodID
+		}
+		_, err := tx.Exec(ctx, `
+			insert into recipe_ingredients
+				(recipe_id, position, source, food_id, sub_recipe_id, barcode, quantity_g)
+			values ($1::uuid, $2, $3, $4::uuid, $5::uuid, $6, $7)
+		`, recipeID, i, string(in.Source), foodID, subRecipeID, in.Barcode, in.QuantityG)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,26 +3,43 @@ package foods
 import (
 	"context"
 	"errors"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
 )
 
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 type Service struct {
 	offRepo    *RepoMongoOFF
 	customRepo *RepoPostgresCustom
+	recipeRepo *RepoPostgresRecipes
 	cache      *barcodeCache
+	history    HistoryProvider
 }
 
-func NewService(offRepo *RepoMongoOFF, customRepo *RepoPostgresCustom) *Service {
+func NewService(offRepo *RepoMongoOFF, customRepo *RepoPostgresCustom, recipeRepo *RepoPostgresRecipes) *Service {
 	return &Service{
 		offRepo:    offRepo,
 		customRepo: customRepo,
+		recipeRepo: recipeRepo,
 		// Big enough to be useful, small enough to be boring
 		cache: newBarcodeCache(10000, 24*time.Hour, 30*time.Minute),
 	}
 }
 
-func (s *Service) Search(ctx context.Context, q string, limit int, cursor string) ([]FoodDTO, *string, error) {
+// offFromStart is handed out as the next cursor when a first page is all
+// history matches. It doesn't parse as a keyword cursor, so the next page
+// starts OFF from the top, and being non-empty it skips the history lookup.
+const offFromStart = "start"
+
+// Search looks up OFF products by name/brand. For authenticated users (userID
+// non-empty) foods they've logged before are pinned to the top of the first
+// page; later pages are plain OFF results and may repeat one of them.
+func (s *Service) Search(ctx context.Context, userID string, q string, limit int, cursor string) ([]FoodDTO, *string, error) {
 	q = strings.TrimSpace(q)
 	if q == "" {
 		return []FoodDTO{}, nil, nil
@@ -31,14 +48,33 @@ func (s *Service) Search(ctx context.Context, q string, limit int, cursor string
 		limit = 25
 	}
 
-	docs, next, err := s.offRepo.SearchByNameOrBrand(ctx, q, limit, cursor)
+	var mine []FoodDTO
+	if cursor == "" {
+		mine = s.historyFoods(ctx, userID, keywordize(q))
+		if len(mine) >= limit {
+			next := offFromStart
+			return mine[:limit], &next, nil
+		}
+	}
+	seen := make(map[string]bool, len(mine))
+	for _, d := range mine {
+		if d.Barcode != nil {
+			seen[*d.Barcode] = true
+		}
+	}
+
+	docs, next, err := s.offRepo.SearchByNameOrBrand(ctx, q, limit-len(mine), cursor)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	out := make([]FoodDTO, 0, len(docs))
+	out := make([]FoodDTO, 0, limit)
+	out = append(out, mine...)
 	for _, d := range docs {
 		dto := offDocToDTO(d)
+		if dto.Barcode != nil && seen[*dto.Barcode] {
+			continue
+		}
 		out = append(out, dto)
 	}
 	return out, next, nil
@@ -76,15 +112,189 @@ func (s *Service) ByBarcode(ctx context.Context, code string) (*FoodDTO, error)
 
 func (s *Service) CreateCustom(ctx context.Context, userID string, req CreateFoodRequest) (FoodDTO, error) {
 	if userID == "" {
-		return FoodDTO{}, errors.New("unauthorized")
+		return FoodDTO{}, apperr.Unauthorized("unauthorized")
+	}
+	if err := validateFood(req); err != nil {
+		return FoodDTO{}, err
 	}
 	return s.customRepo.Create(ctx, userID, req)
 }
 
+// validateFood reports every problem with a custom food at once.
+func validateFood(req CreateFoodRequest) error {
+	var v validate.Errors
+
+	v.Required("name", req.Name)
+	v.MaxLen("name", strings.TrimSpace(req.Name), 200)
+	if req.Brand != nil {
+		v.MaxLen("brand", *req.Brand, 200)
+	}
+	if req.Barcode != nil {
+		v.Barcode("barcode", strings.TrimSpace(*req.Barcode))
+	}
+	if req.ServingG != nil && (*req.ServingG <= 0 || *req.ServingG > 5000) {
+		v.Add("servingG", "servingG must be above 0 and at most 5000")
+	}
+
+	// Per 100g nothing can exceed 100g, and nothing has more than pure fat's energy.
+	v.Range("kcalPer100g", req.KcalPer100g, 0, 900)
+	v.Range("proteinPer100g", req.ProteinPer100g, 0, 100)
+	v.Range("carbsPer100g", req.CarbsPer100g, 0, 100)
+	v.Range("fatPer100g", req.FatPer100g, 0, 100)
+	for field, x := range map[string]*float64{
+		"fiberPer100g":              req.FiberPer100g,
+		"sugarPer100g":              req.SugarPer100g,
+		"saltPer100g":               req.SaltPer100g,
+		"sodiumPer100g":             req.SodiumPer100g,
+		"saturatedFatPer100g":       req.SaturatedFatPer100g,
+		"monounsaturatedFatPer100g": req.MonounsaturatedFatPer100g,
+		"polyunsaturatedFatPer100g": req.PolyunsaturatedFatPer100g,
+		"alphaLinolenicAcidPer100g": req.AlphaLinolenicAcidPer100g,
+	} {
+		validate.RangePtr(&v, field, x, 0, 100)
+	}
+	for key, x := range req.Nutriments {
+		if x < 0 {
+			v.Add("nutriments."+key, "nutriments."+key+" must not be negative")
+		}
+	}
+
+	v.Macros("kcalPer100g", req.KcalPer100g, req.ProteinPer100g, req.CarbsPer100g, req.FatPer100g)
+	if req.SugarPer100g != nil && *req.SugarPer100g > req.CarbsPer100g {
+		v.Add("sugarPer100g", "sugarPer100g can't exceed carbsPer100g")
+	}
+	if req.SaturatedFatPer100g != nil && *req.SaturatedFatPer100g > req.FatPer100g {
+		v.Add("saturatedFatPer100g", "saturatedFatPer100g can't exceed fatPer100g")
+	}
+	return v.Err()
+}
+
+// CustomFoodsChangedSince feeds delta sync; see RepoPostgresCustom.ChangedSince.
+func (s *Service) CustomFoodsChangedSince(ctx context.Context, userID string, since int64, limit int) ([]CustomFoodChange, error) {
+	return s.customRepo.ChangedSince(ctx, userID, since, limit)
+}
+
+// CustomFoodOwnedBy reports whether a custom food exists and belongs to userID.
+func (s *Service) CustomFoodOwnedBy(ctx context.Context, id, userID string) (exists bool, owned bool, err error) {
+	return s.customRepo.OwnedBy(ctx, id, userID)
+}
+
 func (s *Service) ByCustomID(ctx context.Context, id string) (FoodDTO, error) {
 	id = strings.TrimSpace(id)
 	if id == "" {
-		return FoodDTO{}, errors.New("missing id")
+		return FoodDTO{}, apperr.Invalid("missing id")
+	}
+	// Not a UUID can't be a food; don't let the cast fail as a server error.
+	if !uuidRe.MatchString(id) {
+		return FoodDTO{}, apperr.NotFound("food not found")
 	}
 	return s.customRepo.ByID(ctx, id)
 }
+
+func (s *Service) ListRecipes(ctx context.Context, userID string) (RecipeListResponse, error) {
+	if userID == "" {
+		return RecipeListResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	ids, err := s.recipeRepo.ListIDs(ctx, userID)
+	if err != nil {
+		return RecipeListResponse{}, apperr.Internal("failed to load recipes")
+	}
+
+	out := RecipeListResponse{Items: make([]Recipe, 0, len(ids))}
+	for _, id := range ids {
+		rec, err := s.Recipe(ctx, userID, id)
+		if err != nil {
+			return RecipeListResponse{}, err
+		}
+		out.Items = append(out.Items, rec)
+	}
+	return out, nil
+}
+
+func (s *Service) Recipe(ctx context.Context, userID, id string) (Recipe, error) {
+	if userID == "" {
+		return Recipe{}, apperr.Unauthorized("unauthorized")
+	}
+	id = strings.TrimSpace(id)
+	if !uuidRe.MatchString(id) {
+		return Recipe{}, errRecipeNotFound
+	}
+	row, err := s.recipeRepo.ByID(ctx, userID, id)
+	if err != nil {
+		if IsNotFound(err) {
+			return Recipe{}, err
+		}
+		return Recipe{}, apperr.Internal("failed to load recipe")
+	}
+	return s.buildRecipe(ctx, userID, row, 0)
+}
+
+func (s *Service) CreateRecipe(ctx context.Context, userID string, req RecipeRequest) (Recipe, error) {
+	if userID == "" {
+		return Recipe{}, apperr.Unauthorized("unauthorized")
+	}
+	req, err := validateRecipe(req)
+	if err != nil {
+		return Recipe{}, err
+	}
+	// A new recipe can't be referenced yet, so only depth matters here.
+	if err := s.checkNoCycle(ctx, userID, "", req.Ingredients); err != nil {
+		return Recipe{}, err
+	}
+
+	id, err := s.recipeRepo.Create(ctx, userID, req)
+	if err != nil {
+		return Recipe{}, apperr.Internal("failed to create recipe")
+	}
+	return s.Recipe(ctx, userID, id)
+}
+
+func (s *Service) UpdateRecipe(ctx context.Context, userID, id string, req RecipeRequest) (Recipe, error) {
+	if userID == "" {
+		return Recipe{}, apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return Recipe{}, errRecipeNotFound
+	}
+	req, err := validateRecipe(req)
+	if err != nil {
+		return Recipe{}, err
+	}
+	if err := s.checkNoCycle(ctx, userID, id, req.Ingredients); err != nil {
+		return Recipe{}, err
+	}
+
+	if err := s.recipeRepo.Update(ctx, userID, id, req); err != nil {
+		if IsNotFound(err) {
+			return Recipe{}, err
+		}
+		return Recipe{}, apperr.Internal("failed to update recipe")
+	}
+	return s.Recipe(ctx, userID, id)
+}
+
+func (s *Service) DeleteRecipe(ctx context.Context, userID, id string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return errRecipeNotFound
+	}
+	if err := s.recipeRepo.Delete(ctx, userID, id); err != nil {
+		if IsNotFound(err) || errors.Is(err, errRecipeInUse) {
+			return err
+		}
+		return apperr.Internal("failed to delete recipe")
+	}
+	return nil
+}
+
+// ByRecipeID returns the recipe as a per-100g food, computed from the current
+// ingredient data. Callers that log it snapshot these values.
+func (s *Service) ByRecipeID(ctx context.Context, userID, id string) (FoodDTO, error) {
+	rec, err := s.Recipe(ctx, userID, id)
+	if err != nil {
+		return FoodDTO{}, err
+	}
+	return rec.Per100g, nil
+}
@@ -0,0 +1,117 @@
+package goals
+
+import (
+	"math"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
+)
+
+var activityFactors = map[ActivityLevel]float64{
+	ActivitySedentary:  1.2,
+	ActivityLight:      1.375,
+	ActivityModerate:   1.55,
+	ActivityActive:     1.725,
+	ActivityVeryActive: 1.9,
+}
+
+// Calorie adjustment relative to TDEE. Percentages rather than fixed offsets so
+// a 50kg and a 120kg user get proportionate deficits.
+var objectiveFactors = map[Objective]float64{
+	ObjectiveCut:      0.80,
+	ObjectiveMaintain: 1.00,
+	ObjectiveBulk:     1.10,
+}
+
+// Share of calories from protein / carbs / fat.
+type macroSplit struct {
+	protein, carbs, fat float64
+}
+
+var presetSplits = map[Preset]macroSplit{
+	PresetBalanced:    {0.30, 0.40, 0.30},
+	PresetHighProtein: {0.40, 0.35, 0.25},
+	PresetKeto:        {0.25, 0.05, 0.70},
+	PresetLowFat:      {0.25, 0.55, 0.20},
+}
+
+// Order proposals are returned in (map iteration order isn't stable).
+var presetOrder = []Preset{PresetBalanced, PresetHighProtein, PresetKeto, PresetLowFat}
+
+// Nobody should be told to eat less than this without a clinician involved.
+const minCalorieGoal = 1200
+
+func validateWizard(req WizardRequest) error {
+	var v validate.Errors
+	if req.Sex != SexMale && req.Sex != SexFemale {
+		v.Add("sex", "sex must be male or female")
+	}
+	v.Range("age", float64(req.Age), 14, 100)
+	v.Range("heightCm", req.HeightCm, 100, 250)
+	v.Range("weightKg", req.WeightKg, 30, 300)
+	validate.RangePtr(&v, "bodyFatPct", req.BodyFatPct, 3, 60)
+	if _, ok := activityFactors[req.ActivityLevel]; !ok {
+		v.Add("activityLevel", "invalid activity level")
+	}
+	if _, ok := objectiveFactors[req.Objective]; !ok {
+		v.Add("objective", "invalid objective")
+	}
+	if req.Preset != nil {
+		if _, ok := presetSplits[*req.Preset]; !ok {
+			v.Add("preset", "invalid preset")
+		}
+	}
+	return v.Err()
+}
+
+// bmr picks Katch-McArdle when body fat is known (it accounts for lean mass,
+// which matters a lot for very lean or very heavy users) and Mifflin-St Jeor otherwise.
+func bmr(req WizardRequest) (float64, string) {
+	if req.BodyFatPct != nil {
+		lbm := req.WeightKg * (1 - *req.BodyFatPct/100)
+		return 370 + 21.6*lbm, "katch_mcardle"
+	}
+
+	base := 10*req.WeightKg + 6.25*req.HeightCm - 5*float64(req.Age)
+	if req.Sex == SexMale {
+		return base + 5, "mifflin_st_jeor"
+	}
+	return base - 161, "mifflin_st_jeor"
+}
+
+func calculate(req WizardRequest) (WizardResponse, error) {
+	if err := validateWizard(req); err != nil {
+		return WizardResponse{}, err
+	}
+
+	b, formula := bmr(req)
+	tdee := b * activityFactors[req.ActivityLevel]
+
+	cal := int(math.Round(tdee * objectiveFactors[req.Objective]))
+	if cal < minCalorieGoal {
+		cal = minCalorieGoal
+	}
+
+	resp := WizardResponse{
+		BMR:         int(math.Round(b)),
+		BMRFormula:  formula,
+		TDEE:        int(math.Round(tdee)),
+		CalorieGoal: cal,
+		Proposals:   make([]Proposal, 0, len(presetOrder)),
+	}
+	for _, p := range presetOrder {
+		resp.Proposals = append(resp.Proposals, proposal(p, cal))
+	}
+	return resp, nil
+}
+
+func proposal(p Preset, cal int) Proposal {
+	split := presetSplits[p]
+	kcal := float64(cal)
+	return Proposal{
+		Preset:       p,
+		CalorieGoal:  cal,
+		ProteinGoalG: int(math.Round(kcal * split.protein / 4)),
+		CarbsGoalG:   int(math.Round(kcal * split.carbs / 4)),
+		FatGoalG:     int(math.Round(kcal * split.fat / 9)),
+	}
+}
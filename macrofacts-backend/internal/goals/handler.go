@@ -0,0 +1,156 @@
+package goals
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) Wizard(c *gin.Context) {
+	var req WizardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	resp, err := h.svc.Wizard(req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) Accept(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req WizardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	s, err := h.svc.Accept(uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *Handler) ListProfiles(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.ListProfiles(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) CreateProfile(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req CreateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	p, err := h.svc.CreateProfile(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, p)
+}
+
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	p, err := h.svc.UpdateProfile(c.Request.Context(), uid, id, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *Handler) DeleteProfile(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	if err := h.svc.DeleteProfile(c.Request.Context(), uid, id); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) GetSchedule(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.GetSchedule(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) SetSchedule(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req Schedule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	resp, err := h.svc.SetSchedule(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) SetOverride(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req SetOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	if err := h.svc.SetOverride(c.Request.Context(), uid, c.Param("date"), req); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteOverride(c *gin.Context) {
+	uid := c.GetString("userId")
+	if err := h.svc.DeleteOverride(c.Request.Context(), uid, c.Param("date")); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package goals
+
+type Sex string
+
+const (
+	SexMale   Sex = "male"
+	SexFemale Sex = "female"
+)
+
+type ActivityLevel string
+
+const (
+	ActivitySedentary  ActivityLevel = "sedentary"
+	ActivityLight      ActivityLevel = "light"
+	ActivityModerate   ActivityLevel = "moderate"
+	ActivityActive     ActivityLevel = "active"
+	ActivityVeryActive ActivityLevel = "very_active"
+)
+
+type Objective string
+
+const (
+	ObjectiveCut      Objective = "cut"
+	ObjectiveMaintain Objective = "maintain"
+	ObjectiveBulk     Objective = "bulk"
+)
+
+type Preset string
+
+const (
+	PresetBalanced    Preset = "balanced"
+	PresetHighProtein Preset = "high_protein"
+	PresetKeto        Preset = "keto"
+	PresetLowFat      Preset = "low_fat"
+)
+
+type WizardRequest struct {
+	Sex      Sex     `json:"sex"`
+	Age      int     `json:"age"`
+	HeightCm float64 `json:"heightCm"`
+	WeightKg float64 `json:"weightKg"`
+	// Optional; when present BMR uses Katch-McArdle (lean-mass based).
+	BodyFatPct *float64 `json:"bodyFatPct,omitempty"`
+
+	ActivityLevel ActivityLevel `json:"activityLevel"`
+	Objective     Objective     `json:"objective"`
+
+	// Preset picks the proposal to apply; the wizard response always lists all of them.
+	Preset *Preset `json:"preset,omitempty"`
+}
+
+type Proposal struct {
+	Preset       Preset `json:"preset"`
+	CalorieGoal  int    `json:"calorieGoal"`
+	ProteinGoalG int    `json:"proteinGoalG"`
+	CarbsGoalG   int    `json:"carbsGoalG"`
+	FatGoalG     int    `json:"fatGoalG"`
+}
+
+type WizardResponse struct {
+	BMR        int    `json:"bmr"`
+	BMRFormula string `json:"bmrFormula"` // "mifflin_st_jeor" | "katch_mcardle"
+	TDEE       int    `json:"tdee"`
+
+	CalorieGoal int        `json:"calorieGoal"`
+	Proposals   []Proposal `json:"proposals"`
+}
+
+// Profile is a named goal set (e.g. "training", "rest") that can be assigned
+// to weekdays or to individual dates.
+type Profile struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	CalorieGoal  int    `json:"calorieGoal"`
+	ProteinGoalG int    `json:"proteinGoalG"`
+	CarbsGoalG   int    `json:"carbsGoalG"`
+	FatGoalG     int    `json:"fatGoalG"`
+}
+
+type ProfileListResponse struct {
+	Items []Profile `json:"items"`
+}
+
+type CreateProfileRequest struct {
+	Name         string `json:"name" binding:"required"`
+	CalorieGoal  int    `json:"calorieGoal" binding:"required"`
+	ProteinGoalG int    `json:"proteinGoalG"`
+	CarbsGoalG   int    `json:"carbsGoalG"`
+	FatGoalG     int    `json:"fatGoalG"`
+}
+
+type UpdateProfileRequest struct {
+	Name         *string `json:"name,omitempty"`
+	CalorieGoal  *int    `json:"calorieGoal,omitempty"`
+	ProteinGoalG *int    `json:"proteinGoalG,omitempty"`
+	CarbsGoalG   *int    `json:"carbsGoalG,omitempty"`
+	FatGoalG     *int    `json:"fatGoalG,omitempty"`
+}
+
+// Schedule maps lowercase weekday names ("monday".."sunday") to a profile ID.
+// Days that are missing or null use the base goals from settings.
+type Schedule struct {
+	Weekdays map[string]*string `json:"weekdays"`
+}
+
+// Plan is everything that decides which goals apply on a day, as sync sends
+// it: live profiles with today's values, the current schedule and every day
+// override (date -> profile ID).
+type Plan struct {
+	Profiles  []Profile         `json:"profiles"`
+	Schedule  Schedule          `json:"schedule"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+type SetOverrideRequest struct {
+	ProfileID string `json:"profileId" binding:"required"`
+}
+
+// Resolved is the goal set that applies on one date and where it came from.
+type Resolved struct {
+	CalorieGoal  int
+	ProteinGoalG int
+	CarbsGoalG   int
+	FatGoalG     int
+
+	ProfileID   *string
+	ProfileName *string
+}
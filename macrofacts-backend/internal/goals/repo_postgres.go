@@ -0,0 +1,348 @@
+package goals
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+)
+
+type RepoPostgres struct {
+	db *pgxpool.Pool
+}
+
+func NewRepoPostgres(db *pgxpool.Pool) *RepoPostgres {
+	return &RepoPostgres{db: db}
+}
+
+var (
+	errProfileNotFound = apperr.NotFound("profile not found")
+	errProfileExists   = apperr.Conflict("PROFILE_EXISTS", "profile name already exists")
+)
+
+type profileRow struct {
+	ID       string
+	Name     string
+	Archived bool
+}
+
+type profileVersionRow struct {
+	ProfileID string
+	Goals     auth.Goals
+}
+
+type scheduleRow struct {
+	EffectiveFrom string
+	Weekday       time.Weekday
+	ProfileID     *string
+}
+
+func (r *RepoPostgres) ListProfiles(ctx context.Context, userID string) ([]profileRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select id::text, name, archived_at is not null
+		from goal_profiles
+		where user_id = $1::uuid
+		order by created_at asc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []profileRow
+	for rows.Next() {
+		var p profileRow
+		if err := rows.Scan(&p.ID, &p.Name, &p.Archived); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListProfileVersions returns all versions starting on or before `to`, grouped
+// by profile and oldest first within each profile.
+func (r *RepoPostgres) ListProfileVersions(ctx context.Context, userID string, to time.Time) ([]profileVersionRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			v.profile_id::text,
+			to_char(v.effective_from, 'YYYY-MM-DD'),
+			v.calorie_goal,
+			v.protein_goal_g,
+			v.carbs_goal_g,
+			v.fat_goal_g
+		from goal_profile_versions v
+		join goal_profiles p on p.id = v.profile_id
+		where p.user_id = $1::uuid and v.effective_from <= $2::date
+		order by v.profile_id, v.effective_from asc
+	`, userID, to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []profileVersionRow
+	for rows.Next() {
+		var v profileVersionRow
+		if err := rows.Scan(
+			&v.ProfileID,
+			&v.Goals.EffectiveFrom,
+			&v.Goals.CalorieGoal,
+			&v.Goals.ProteinGoalG,
+			&v.Goals.CarbsGoalG,
+			&v.Goals.FatGoalG,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (r *RepoPostgres) CreateProfile(ctx context.Context, userID string, name string, g auth.Goals, effectiveFrom time.Time) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		insert into goal_profiles (user_id, name)
+		values ($1::uuid, $2)
+		returning id::text
+	`, userID, name).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return "", errProfileExists
+		}
+		return "", err
+	}
+
+	if err := insertProfileVersion(ctx, tx, id, g, effectiveFrom); err != nil {
+		return "", err
+	}
+	return id, tx.Commit(ctx)
+}
+
+// UpdateProfile renames the profile and/or versions new goal values from
+// effectiveFrom on, so past days keep the values they were logged against.
+func (r *RepoPostgres) UpdateProfile(ctx context.Context, userID, id string, name *string, g *auth.Goals, effectiveFrom time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		update goal_profiles
+		set name = coalesce($3, name)
+		where id = $1::uuid and user_id = $2::uuid and archived_at is null
+	`, id, userID, name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return errProfileExists
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errProfileNotFound
+	}
+
+	if g != nil {
+		if err := insertProfileVersion(ctx, tx, id, *g, effectiveFrom); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ArchiveProfile hides the profile and drops it from the schedule going forward.
+// Versions are kept so past days still resolve to what applied then.
+func (r *RepoPostgres) ArchiveProfile(ctx context.Context, userID, id string, effectiveFrom time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		update goal_profiles
+		set archived_at = now()
+		where id = $1::uuid and user_id = $2::uuid and archived_at is null
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errProfileNotFound
+	}
+
+	// Fork the current schedule from effectiveFrom with this profile removed.
+	_, err = tx.Exec(ctx, `
+		insert into goal_schedule (user_id, effective_from, weekday, profile_id)
+		select s.user_id, $3::date, s.weekday, nullif(s.profile_id, $2::uuid)
+		from goal_schedule s
+		where s.user_id = $1::uuid
+		  and s.effective_from = (
+			select max(effective_from) from goal_schedule
+			where user_id = $1::uuid and effective_from <= $3::date
+		  )
+		on conflict (user_id, effective_from, weekday)
+		do update set profile_id = excluded.profile_id
+	`, userID, id, effectiveFrom.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		delete from goal_day_overrides
+		where user_id = $1::uuid and profile_id = $2::uuid and date >= $3::date
+	`, userID, id, effectiveFrom.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *RepoPostgres) ListSchedule(ctx context.Context, userID string, to time.Time) ([]scheduleRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select to_char(effective_from, 'YYYY-MM-DD'), weekday, profile_id::text
+		from goal_schedule
+		where user_id = $1::uuid and effective_from <= $2::date
+		order by effective_from asc, weekday asc
+	`, userID, to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []scheduleRow
+	for rows.Next() {
+		var s scheduleRow
+		var wd int16
+		if err := rows.Scan(&s.EffectiveFrom, &wd, &s.ProfileID); err != nil {
+			return nil, err
+		}
+		s.Weekday = time.Weekday(wd)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ReplaceSchedule writes a full week starting at effectiveFrom. Weekdays not
+// in the map are stored as null (base goals).
+func (r *RepoPostgres) ReplaceSchedule(ctx context.Context, userID string, effectiveFrom time.Time, week map[time.Weekday]string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		var pid *string
+		if id, ok := week[wd]; ok {
+			pid = &id
+		}
+		_, err := tx.Exec(ctx, `
+			insert into goal_schedule (user_id, effective_from, weekday, profile_id)
+			values ($1::uuid, $2::date, $3, $4::uuid)
+			on conflict (user_id, effective_from, weekday)
+			do update set profile_id = excluded.profile_id
+		`, userID, effectiveFrom.Format("2006-01-02"), int16(wd), pid)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return errProfileNotFound
+			}
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *RepoPostgres) ListOverrides(ctx context.Context, userID string, from, to time.Time) (map[string]string, error) {
+	rows, err := r.db.Query(ctx, `
+		select to_char(date, 'YYYY-MM-DD'), profile_id::text
+		from goal_day_overrides
+		where user_id = $1::uuid and date between $2::date and $3::date
+	`, userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var d, pid string
+		if err := rows.Scan(&d, &pid); err != nil {
+			return nil, err
+		}
+		out[d] = pid
+	}
+	return out, rows.Err()
+}
+
+// PlanVersion is the sync version of the user's last goal plan change (0 if none).
+func (r *RepoPostgres) PlanVersion(ctx context.Context, userID string) (int64, error) {
+	var v int64
+	err := r.db.QueryRow(ctx, `select goal_plan_version from users where id = $1::uuid`, userID).Scan(&v)
+	return v, err
+}
+
+func (r *RepoPostgres) SetOverride(ctx context.Context, userID string, date time.Time, profileID string) error {
+	tag, err := r.db.Exec(ctx, `
+		insert into goal_day_overrides (user_id, date, profile_id)
+		select $1::uuid, $2::date, p.id
+		from goal_profiles p
+		where p.id = $3::uuid and p.user_id = $1::uuid and p.archived_at is null
+		on conflict (user_id, date)
+		do update set profile_id = excluded.profile_id
+	`, userID, date.Format("2006-01-02"), profileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errProfileNotFound
+	}
+	return nil
+}
+
+func (r *RepoPostgres) DeleteOverride(ctx context.Context, userID string, date time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		delete from goal_day_overrides
+		where user_id = $1::uuid and date = $2::date
+	`, userID, date.Format("2006-01-02"))
+	return err
+}
+
+func insertProfileVersion(ctx context.Context, tx pgx.Tx, profileID string, g auth.Goals, effectiveFrom time.Time) error {
+	_, err := tx.Exec(ctx, `
+		insert into goal_profile_versions
+			(profile_id, effective_from, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g)
+		values ($1::uuid, $2::date, $3, $4, $5, $6)
+		on conflict (profile_id, effective_from)
+		do update set
+			calorie_goal   = excluded.calorie_goal,
+			protein_goal_g = excluded.protein_goal_g,
+			carbs_goal_g   = excluded.carbs_goal_g,
+			fat_goal_g     = excluded.fat_goal_g
+	`, profileID, effectiveFrom.Format("2006-01-02"), g.CalorieGoal, g.ProteinGoalG, g.CarbsGoalG, g.FatGoalG)
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,106 @@
+package goals
+
+import (
+	"sort"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+)
+
+// Resolver answers "which goals applied on date X" for a loaded date range.
+// Precedence: per-date override, then the weekday schedule in effect on that
+// date, then the base goal history from settings.
+type Resolver struct {
+	base      auth.GoalTimeline
+	profiles  map[string]auth.GoalTimeline
+	names     map[string]string
+	schedules []scheduleVersion // sorted by effectiveFrom asc
+	overrides map[string]string // date -> profile ID
+}
+
+type scheduleVersion struct {
+	effectiveFrom string
+	week          [7]*string
+}
+
+func newResolver(base auth.GoalTimeline, profiles []profileRow, versions []profileVersionRow, schedule []scheduleRow, overrides map[string]string) Resolver {
+	r := Resolver{
+		base:      base,
+		profiles:  make(map[string]auth.GoalTimeline),
+		names:     make(map[string]string, len(profiles)),
+		overrides: overrides,
+	}
+	for _, p := range profiles {
+		r.names[p.ID] = p.Name
+	}
+
+	// versions arrive grouped by profile, oldest first.
+	byProfile := make(map[string][]auth.Goals)
+	for _, v := range versions {
+		byProfile[v.ProfileID] = append(byProfile[v.ProfileID], v.Goals)
+	}
+	for id, vs := range byProfile {
+		r.profiles[id] = auth.NewGoalTimeline(vs)
+	}
+
+	for _, s := range schedule {
+		if n := len(r.schedules); n == 0 || r.schedules[n-1].effectiveFrom != s.EffectiveFrom {
+			r.schedules = append(r.schedules, scheduleVersion{effectiveFrom: s.EffectiveFrom})
+		}
+		r.schedules[len(r.schedules)-1].week[s.Weekday] = s.ProfileID
+	}
+	return r
+}
+
+// At resolves goals for date (YYYY-MM-DD). ok is false when nothing at all is
+// known, in which case callers fall back to their own defaults.
+func (r Resolver) At(date string) (Resolved, bool) {
+	if pid := r.profileFor(date); pid != "" {
+		if t, ok := r.profiles[pid]; ok {
+			if g, ok := t.At(date); ok {
+				out := fromGoals(g)
+				name := r.names[pid]
+				out.ProfileID = &pid
+				out.ProfileName = &name
+				return out, true
+			}
+		}
+	}
+
+	g, ok := r.base.At(date)
+	if !ok {
+		return Resolved{}, false
+	}
+	return fromGoals(g), true
+}
+
+func (r Resolver) profileFor(date string) string {
+	if pid, ok := r.overrides[date]; ok {
+		return pid
+	}
+
+	// Schedules only apply from when they were set; earlier days use base goals.
+	i := sort.Search(len(r.schedules), func(i int) bool {
+		return r.schedules[i].effectiveFrom > date
+	})
+	if i == 0 {
+		return ""
+	}
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	if pid := r.schedules[i-1].week[d.Weekday()]; pid != nil {
+		return *pid
+	}
+	return ""
+}
+
+func fromGoals(g auth.Goals) Resolved {
+	return Resolved{
+		CalorieGoal:  g.CalorieGoal,
+		ProteinGoalG: g.ProteinGoalG,
+		CarbsGoalG:   g.CarbsGoalG,
+		FatGoalG:     g.FatGoalG,
+	}
+}
@@ -0,0 +1,392 @@
+package goals
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
+)
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type Service struct {
+	repo    *RepoPostgres
+	authSvc *auth.Service
+}
+
+func NewService(repo *RepoPostgres, authSvc *auth.Service) *Service {
+	return &Service{repo: repo, authSvc: authSvc}
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Wizard computes BMR/TDEE and a proposal per preset. Nothing is persisted.
+func (s *Service) Wizard(req WizardRequest) (WizardResponse, error) {
+	return calculate(req)
+}
+
+// Accept recomputes the proposal for the chosen preset (balanced by default)
+// and writes it into the user's settings.
+func (s *Service) Accept(userID string, req WizardRequest) (auth.MeSettingsResponse, error) {
+	if userID == "" {
+		return auth.MeSettingsResponse{}, apperr.Unauthorized("unauthorized")
+	}
+
+	resp, err := calculate(req)
+	if err != nil {
+		return auth.MeSettingsResponse{}, err
+	}
+
+	preset := PresetBalanced
+	if req.Preset != nil {
+		preset = *req.Preset
+	}
+	p := proposal(preset, resp.CalorieGoal)
+
+	return s.authSvc.UpdateSettings(userID, auth.UpdateSettingsRequest{
+		CalorieGoal:  &p.CalorieGoal,
+		ProteinGoalG: &p.ProteinGoalG,
+		CarbsGoalG:   &p.CarbsGoalG,
+		FatGoalG:     &p.FatGoalG,
+	})
+}
+
+// Resolver loads everything needed to resolve goals for dates in [from, to].
+func (s *Service) Resolver(ctx context.Context, userID string, from, to time.Time) (Resolver, error) {
+	base, err := s.authSvc.GoalTimeline(userID, to)
+	if err != nil {
+		return Resolver{}, err
+	}
+	profiles, err := s.repo.ListProfiles(ctx, userID)
+	if err != nil {
+		return Resolver{}, apperr.Internal("failed to load goal profiles")
+	}
+	versions, err := s.repo.ListProfileVersions(ctx, userID, to)
+	if err != nil {
+		return Resolver{}, apperr.Internal("failed to load goal profiles")
+	}
+	schedule, err := s.repo.ListSchedule(ctx, userID, to)
+	if err != nil {
+		return Resolver{}, apperr.Internal("failed to load goal schedule")
+	}
+	overrides, err := s.repo.ListOverrides(ctx, userID, from, to)
+	if err != nil {
+		return Resolver{}, apperr.Internal("failed to load goal overrides")
+	}
+	return newResolver(base, profiles, versions, schedule, overrides), nil
+}
+
+func (s *Service) ListProfiles(ctx context.Context, userID string) (ProfileListResponse, error) {
+	if userID == "" {
+		return ProfileListResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	today := s.today(userID)
+
+	rows, err := s.repo.ListProfiles(ctx, userID)
+	if err != nil {
+		return ProfileListResponse{}, apperr.Internal("failed to load goal profiles")
+	}
+	versions, err := s.repo.ListProfileVersions(ctx, userID, today)
+	if err != nil {
+		return ProfileListResponse{}, apperr.Internal("failed to load goal profiles")
+	}
+	r := newResolver(auth.GoalTimeline{}, rows, versions, nil, nil)
+
+	out := ProfileListResponse{Items: []Profile{}}
+	for _, p := range rows {
+		if p.Archived {
+			continue
+		}
+		item := Profile{ID: p.ID, Name: p.Name}
+		if g, ok := r.profiles[p.ID].At(today.Format("2006-01-02")); ok {
+			item.CalorieGoal = g.CalorieGoal
+			item.ProteinGoalG = g.ProteinGoalG
+			item.CarbsGoalG = g.CarbsGoalG
+			item.FatGoalG = g.FatGoalG
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+func (s *Service) CreateProfile(ctx context.Context, userID string, req CreateProfileRequest) (Profile, error) {
+	if userID == "" {
+		return Profile{}, apperr.Unauthorized("unauthorized")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 60 {
+		return Profile{}, apperr.InvalidField("name", "invalid name")
+	}
+	g := auth.Goals{
+		CalorieGoal:  req.CalorieGoal,
+		ProteinGoalG: req.ProteinGoalG,
+		CarbsGoalG:   req.CarbsGoalG,
+		FatGoalG:     req.FatGoalG,
+	}
+	if err := validateGoals(g); err != nil {
+		return Profile{}, err
+	}
+
+	id, err := s.repo.CreateProfile(ctx, userID, name, g, s.today(userID))
+	if err != nil {
+		if errors.Is(err, errProfileExists) {
+			return Profile{}, err
+		}
+		return Profile{}, apperr.Internal("failed to create goal profile")
+	}
+	return Profile{
+		ID:           id,
+		Name:         name,
+		CalorieGoal:  g.CalorieGoal,
+		ProteinGoalG: g.ProteinGoalG,
+		CarbsGoalG:   g.CarbsGoalG,
+		FatGoalG:     g.FatGoalG,
+	}, nil
+}
+
+func (s *Service) UpdateProfile(ctx context.Context, userID, id string, req UpdateProfileRequest) (Profile, error) {
+	if userID == "" {
+		return Profile{}, apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return Profile{}, errProfileNotFound
+	}
+
+	var name *string
+	if req.Name != nil {
+		n := strings.TrimSpace(*req.Name)
+		if n == "" || len(n) > 60 {
+			return Profile{}, apperr.InvalidField("name", "invalid name")
+		}
+		name = &n
+	}
+
+	var g *auth.Goals
+	if req.CalorieGoal != nil || req.ProteinGoalG != nil || req.CarbsGoalG != nil || req.FatGoalG != nil {
+		cur, err := s.profile(ctx, userID, id)
+		if err != nil {
+			return Profile{}, err
+		}
+		next := auth.Goals{
+			CalorieGoal:  pick(req.CalorieGoal, cur.CalorieGoal),
+			ProteinGoalG: pick(req.ProteinGoalG, cur.ProteinGoalG),
+			CarbsGoalG:   pick(req.CarbsGoalG, cur.CarbsGoalG),
+			FatGoalG:     pick(req.FatGoalG, cur.FatGoalG),
+		}
+		if err := validateGoals(next); err != nil {
+			return Profile{}, err
+		}
+		g = &next
+	}
+
+	if err := s.repo.UpdateProfile(ctx, userID, id, name, g, s.today(userID)); err != nil {
+		if errors.Is(err, errProfileNotFound) || errors.Is(err, errProfileExists) {
+			return Profile{}, err
+		}
+		return Profile{}, apperr.Internal("failed to update goal profile")
+	}
+	return s.profile(ctx, userID, id)
+}
+
+func (s *Service) DeleteProfile(ctx context.Context, userID, id string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return errProfileNotFound
+	}
+	if err := s.repo.ArchiveProfile(ctx, userID, id, s.today(userID)); err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			return err
+		}
+		return apperr.Internal("failed to delete goal profile")
+	}
+	return nil
+}
+
+func (s *Service) GetSchedule(ctx context.Context, userID string) (Schedule, error) {
+	if userID == "" {
+		return Schedule{}, apperr.Unauthorized("unauthorized")
+	}
+	today := s.today(userID)
+	rows, err := s.repo.ListSchedule(ctx, userID, today)
+	if err != nil {
+		return Schedule{}, apperr.Internal("failed to load goal schedule")
+	}
+	r := newResolver(auth.GoalTimeline{}, nil, nil, rows, nil)
+
+	out := Schedule{Weekdays: make(map[string]*string, 7)}
+	for name, wd := range weekdayNames {
+		out.Weekdays[name] = nil
+		if n := len(r.schedules); n > 0 {
+			out.Weekdays[name] = r.schedules[n-1].week[wd]
+		}
+	}
+	return out, nil
+}
+
+// SetSchedule replaces the weekly schedule from today on.
+func (s *Service) SetSchedule(ctx context.Context, userID string, req Schedule) (Schedule, error) {
+	if userID == "" {
+		return Schedule{}, apperr.Unauthorized("unauthorized")
+	}
+
+	week := make(map[time.Weekday]string, 7)
+	for name, pid := range req.Weekdays {
+		wd, ok := weekdayNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return Schedule{}, apperr.Invalid("invalid weekday")
+		}
+		if pid != nil && *pid != "" {
+			week[wd] = *pid
+		}
+	}
+	if err := s.checkProfiles(ctx, userID, week); err != nil {
+		return Schedule{}, err
+	}
+
+	if err := s.repo.ReplaceSchedule(ctx, userID, s.today(userID), week); err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			return Schedule{}, err
+		}
+		return Schedule{}, apperr.Internal("failed to save goal schedule")
+	}
+	return s.GetSchedule(ctx, userID)
+}
+
+func (s *Service) SetOverride(ctx context.Context, userID, date string, req SetOverrideRequest) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return apperr.InvalidField("date", "invalid date")
+	}
+	if !uuidRe.MatchString(req.ProfileID) {
+		return errProfileNotFound
+	}
+	if err := s.repo.SetOverride(ctx, userID, d, req.ProfileID); err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			return err
+		}
+		return apperr.Internal("failed to save override")
+	}
+	return nil
+}
+
+func (s *Service) DeleteOverride(ctx context.Context, userID, date string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return apperr.InvalidField("date", "invalid date")
+	}
+	if err := s.repo.DeleteOverride(ctx, userID, d); err != nil {
+		return apperr.Internal("failed to delete override")
+	}
+	return nil
+}
+
+// PlanVersion tells sync whether the goal plan changed since a token.
+func (s *Service) PlanVersion(ctx context.Context, userID string) (int64, error) {
+	v, err := s.repo.PlanVersion(ctx, userID)
+	if err != nil {
+		return 0, apperr.Internal("failed to load sync state")
+	}
+	return v, nil
+}
+
+// Plan bundles profiles, schedule and overrides for sync clients.
+func (s *Service) Plan(ctx context.Context, userID string) (Plan, error) {
+	profiles, err := s.ListProfiles(ctx, userID)
+	if err != nil {
+		return Plan{}, err
+	}
+	schedule, err := s.GetSchedule(ctx, userID)
+	if err != nil {
+		return Plan{}, err
+	}
+	// Overrides are one row per date, so sending all of them stays small.
+	overrides, err := s.repo.ListOverrides(ctx, userID, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return Plan{}, apperr.Internal("failed to load goal overrides")
+	}
+	return Plan{Profiles: profiles.Items, Schedule: schedule, Overrides: overrides}, nil
+}
+
+func (s *Service) profile(ctx context.Context, userID, id string) (Profile, error) {
+	list, err := s.ListProfiles(ctx, userID)
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, p := range list.Items {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Profile{}, errProfileNotFound
+}
+
+// checkProfiles makes sure every assigned profile belongs to the user and is active.
+func (s *Service) checkProfiles(ctx context.Context, userID string, week map[time.Weekday]string) error {
+	if len(week) == 0 {
+		return nil
+	}
+	rows, err := s.repo.ListProfiles(ctx, userID)
+	if err != nil {
+		return apperr.Internal("failed to load goal profiles")
+	}
+	active := make(map[string]bool, len(rows))
+	for _, p := range rows {
+		active[p.ID] = !p.Archived
+	}
+	for _, pid := range week {
+		if !active[pid] {
+			return errProfileNotFound
+		}
+	}
+	return nil
+}
+
+func (s *Service) today(userID string) time.Time {
+	tz := "UTC"
+	if settings, err := s.authSvc.GetSettings(userID); err == nil && settings.Timezone != "" {
+		tz = settings.Timezone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func validateGoals(g auth.Goals) error {
+	var v validate.Errors
+	v.Range("calorieGoal", float64(g.CalorieGoal), 800, 10000)
+	v.Range("proteinGoalG", float64(g.ProteinGoalG), 0, 1000)
+	v.Range("carbsGoalG", float64(g.CarbsGoalG), 0, 1000)
+	v.Range("fatGoalG", float64(g.FatGoalG), 0, 1000)
+	return v.Err()
+}
+
+func pick(p *int, def int) int {
+	if p != nil {
+		return *p
+	}
+	return def
+}
@@ -4,9 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/metrics"
 )
 
 func RequestIDMiddleware() gin.HandlerFunc {
@@ -43,6 +45,35 @@ func LoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
 	}
 }
 
+var (
+	httpRequests = metrics.NewCounter("http_requests_total",
+		"HTTP requests by method, route template and status.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency by method, route template and status.", nil, "method", "route", "status")
+	httpInFlight = metrics.NewGauge("http_requests_in_flight", "HTTP requests being served.").With()
+)
+
+// MetricsMiddleware records request counts and latencies. Routes are labelled
+// by template (/api/logs/entries/:id) so IDs don't explode the series count;
+// requests that matched no route share "unmatched".
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.With(c.Request.Method, route, status).Inc()
+		httpDuration.With(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
 func newRequestID() string {
 	b := make([]byte, 16)
 	_, _ = rand.Read(b)
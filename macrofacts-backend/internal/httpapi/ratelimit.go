@@ -1,90 +1,182 @@
 package httpapi
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+// KeyFunc picks the bucket a request counts against. An empty key skips limiting.
+type KeyFunc func(c *gin.Context) string
+
+// Policy is one limit: Burst requests at once, refilling at Rate per second.
+type Policy struct {
+	Name  string
+	Rate  rate.Limit
+	Burst int
+	Key   KeyFunc
 }
 
+// RateLimiter applies one Policy, keeping its buckets in a LimiterStore.
+// Limiters can share a store; bucket keys are prefixed with the policy name.
 type RateLimiter struct {
-	mu       sync.Mutex
-	visitors map[string]*visitor
-
-	rate  rate.Limit
-	burst int
-
-	ttl time.Duration
+	policy Policy
+	store  LimiterStore
 }
 
-func NewRateLimiter(r rate.Limit, burst int, ttl time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		visitors: make(map[string]*visitor),
-		rate:     r,
-		burst:    burst,
-		ttl:      ttl,
+func NewRateLimiter(p Policy, store LimiterStore) *RateLimiter {
+	if p.Key == nil {
+		p.Key = KeyByIP
 	}
+	return &RateLimiter{policy: p, store: store}
+}
+
+// Middleware blocks when tokens are exhausted. Every limited response carries
+// RateLimit-Limit/-Remaining/-Reset (IETF draft names, values in requests and
+// seconds); rejections add Retry-After.
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := rl.policy.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		d, err := rl.store.Take(c.Request.Context(), rl.policy.Name+"|"+key, rl.policy)
+		if err != nil {
+			// Fail open: a limiter outage shouldn't take the API down with it.
+			slog.Warn("rate limit store failed", "policy", rl.policy.Name, "err", err)
+			c.Next()
+			return
+		}
 
-	// cleanup goroutine
-	go func() {
-		ticker := time.NewTicker(time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			rl.cleanup()
+		remaining := int(math.Floor(d.Tokens))
+		if remaining < 0 {
+			remaining = 0
 		}
-	}()
+		h := c.Writer.Header()
+		h.Set("RateLimit-Policy", rl.policyHeader())
+		h.Set("RateLimit-Limit", strconv.Itoa(rl.policy.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(rl.secondsUntilFull(d.Tokens)))
 
-	return rl
+		if !d.Allowed {
+			retry := int(math.Ceil(d.RetryAfter.Seconds()))
+			if retry < 1 {
+				retry = 1
+			}
+			h.Set("Retry-After", strconv.Itoa(retry))
+			WriteError(c, http.StatusTooManyRequests, "RATE_LIMITED",
+				"Too many requests. Please try again soon.",
+				map[string]any{"policy": rl.policy.Name, "retry_after_seconds": retry})
+			return
+		}
+		c.Next()
+	}
 }
 
-func (rl *RateLimiter) get(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// policyHeader describes the policy as "<burst>;w=<seconds to refill it>".
+func (rl *RateLimiter) policyHeader() string {
+	return strconv.Itoa(rl.policy.Burst) + ";w=" + strconv.Itoa(rl.secondsUntilFull(0))
+}
 
-	v, ok := rl.visitors[ip]
-	if !ok {
-		lim := rate.NewLimiter(rl.rate, rl.burst)
-		rl.visitors[ip] = &visitor{limiter: lim, lastSeen: time.Now()}
-		return lim
+func (rl *RateLimiter) secondsUntilFull(tokens float64) int {
+	if rl.policy.Rate <= 0 {
+		return 0
 	}
+	missing := float64(rl.policy.Burst) - tokens
+	if missing <= 0 {
+		return 0
+	}
+	return int(math.Ceil(missing / float64(rl.policy.Rate)))
+}
 
-	v.lastSeen = time.Now()
-	return v.limiter
+// KeyByIP counts requests per client IP.
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
 }
 
-func (rl *RateLimiter) cleanup() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// KeyByUserOrIP counts per authenticated user (set by auth middleware that
+// runs earlier in the chain), falling back to the client IP.
+func KeyByUserOrIP(c *gin.Context) string {
+	if uid := c.GetString("userId"); uid != "" {
+		return "user:" + uid
+	}
+	return KeyByIP(c)
+}
 
-	cutoff := time.Now().Add(-rl.ttl)
-	for ip, v := range rl.visitors {
-		if v.lastSeen.Before(cutoff) {
-			delete(rl.visitors, ip)
-		}
+// Largest body PeekBody will buffer.
+const maxCredentialBody = 16 << 10
+
+// PeekBody reads the start of the request body for key functions and puts
+// it back for the handler.
+func PeekBody(c *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCredentialBody))
+	if err != nil {
+		return nil, err
 	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	return body, nil
 }
 
-// Middleware blocks when tokens are exhausted.
-func (rl *RateLimiter) Middleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !rl.get(ip).Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": gin.H{
-					"code":    "rate_limited",
-					"message": "Too many requests. Please try again soon.",
-				},
-			})
-			c.Abort()
-			return
+// KeyByIPAndUsername counts per (IP, username) for credential endpoints so
+// one attacker can't lock out a user from everywhere, and one user's typos
+// don't block a shared IP.
+func KeyByIPAndUsername(c *gin.Context) string {
+	body, err := PeekBody(c)
+	if err != nil {
+		return KeyByIP(c)
+	}
+	var creds struct {
+		Username string `json:"username"`
+	}
+	_ = json.Unmarshal(body, &creds)
+	return KeyByIP(c) + "|u:" + strings.ToLower(strings.TrimSpace(creds.Username))
+}
+
+// ParseRate reads "N/unit" (unit s, m or h), optionally ":burst", e.g.
+// "10/m" or "300/m:60". Burst defaults to N.
+func ParseRate(spec string) (rate.Limit, int, error) {
+	spec = strings.TrimSpace(spec)
+	countPart, rest, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, errors.New("rate must look like N/unit")
+	}
+	unitPart, burstPart, hasBurst := strings.Cut(rest, ":")
+
+	n, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil || n <= 0 {
+		return 0, 0, errors.New("invalid rate count")
+	}
+
+	var per time.Duration
+	switch strings.TrimSpace(unitPart) {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return 0, 0, errors.New("invalid rate unit")
+	}
+
+	burst := n
+	if hasBurst {
+		burst, err = strconv.Atoi(strings.TrimSpace(burstPart))
+		if err != nil || burst <= 0 {
+			return 0, 0, errors.New("invalid burst")
 		}
-		c.Next()
 	}
+	return rate.Limit(float64(n) / per.Seconds()), burst, nil
 }
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore keeps token buckets in the rate_limit_buckets table so every
+// replica draws from the same bucket. Each Take is a single upsert; the row
+// lock serializes concurrent requests for one key, and the database clock
+// is used so replica clock skew doesn't matter.
+type PostgresStore struct {
+	db  *pgxpool.Pool
+	ttl time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPostgresStore deletes buckets idle for longer than ttl.
+func NewPostgresStore(db *pgxpool.Pool, ttl time.Duration) *PostgresStore {
+	ps := &PostgresStore{db: db, ttl: ttl, stop: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ps.stop:
+				return
+			case <-ticker.C:
+				ps.cleanup()
+			}
+		}
+	}()
+
+	return ps
+}
+
+func (ps *PostgresStore) Take(ctx context.Context, key string, p Policy) (Decision, error) {
+	// `avail` is the bucket refilled up to now() (capped at burst). All SET
+	// expressions see the old row, so allowed/tokens agree with each other.
+	var d Decision
+	err := ps.db.QueryRow(ctx, `
+		insert into rate_limit_buckets as b (key, tokens, allowed, updated_at)
+		values ($1, $2::float8 - 1, true, now())
+		on conflict (key) do update set
+			tokens = least($2::float8, b.tokens + extract(epoch from (now() - b.updated_at)) * $3::float8)
+				- case when least($2::float8, b.tokens + extract(epoch from (now() - b.updated_at)) * $3::float8) >= 1
+					then 1 else 0 end,
+			allowed = least($2::float8, b.tokens + extract(epoch from (now() - b.updated_at)) * $3::float8) >= 1,
+			updated_at = now()
+		returning tokens, allowed
+	`, key, float64(p.Burst), float64(p.Rate)).Scan(&d.Tokens, &d.Allowed)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if !d.Allowed {
+		d.RetryAfter = time.Second
+		if p.Rate > 0 {
+			d.RetryAfter = time.Duration((1 - d.Tokens) / float64(p.Rate) * float64(time.Second))
+		}
+	}
+	return d, nil
+}
+
+// Close stops the cleanup goroutine. Safe to call more than once.
+func (ps *PostgresStore) Close() {
+	ps.stopOnce.Do(func() { close(ps.stop) })
+}
+
+func (ps *PostgresStore) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := ps.db.Exec(ctx, `
+		delete from rate_limit_buckets
+		where updated_at < now() - make_interval(secs => $1)
+	`, ps.ttl.Seconds())
+	if err != nil {
+		slog.Warn("rate limit cleanup failed", "err", err)
+	}
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Decision is the outcome of taking one token from a bucket.
+type Decision struct {
+	Allowed bool
+	// Tokens left after this request (fractional while refilling).
+	Tokens float64
+	// When denied: how long until a token is available.
+	RetryAfter time.Duration
+}
+
+// LimiterStore holds token buckets. Take refills key's bucket for the time
+// since its last use, then consumes one token if there is one.
+type LimiterStore interface {
+	Take(ctx context.Context, key string, p Policy) (Decision, error)
+	Close()
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// MemoryStore keeps buckets in-process. Fine for a single replica; with
+// several, each enforces the full limit on its own (use PostgresStore).
+type MemoryStore struct {
+	mu       sync.Mutex
+	visitors map[string]*visitor
+
+	ttl time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemoryStore drops buckets idle for longer than ttl.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	ms := &MemoryStore{
+		visitors: make(map[string]*visitor),
+		ttl:      ttl,
+		stop:     make(chan struct{}),
+	}
+
+	// cleanup goroutine; exits on Close
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ms.stop:
+				return
+			case <-ticker.C:
+				ms.cleanup()
+			}
+		}
+	}()
+
+	return ms
+}
+
+func (ms *MemoryStore) Take(_ context.Context, key string, p Policy) (Decision, error) {
+	now := time.Now()
+	lim := ms.get(key, p)
+
+	res := lim.ReserveN(now, 1)
+	delay := res.DelayFrom(now)
+	if !res.OK() || delay > 0 {
+		// Don't let a rejected request eat into future capacity.
+		res.CancelAt(now)
+		if !res.OK() {
+			delay = time.Second
+		}
+		return Decision{Allowed: false, Tokens: lim.TokensAt(now), RetryAfter: delay}, nil
+	}
+	return Decision{Allowed: true, Tokens: lim.TokensAt(now)}, nil
+}
+
+// Close stops the cleanup goroutine. Safe to call more than once.
+func (ms *MemoryStore) Close() {
+	ms.stopOnce.Do(func() { close(ms.stop) })
+}
+
+func (ms *MemoryStore) get(key string, p Policy) *rate.Limiter {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	v, ok := ms.visitors[key]
+	if !ok {
+		lim := rate.NewLimiter(p.Rate, p.Burst)
+		ms.visitors[key] = &visitor{limiter: lim, lastSeen: time.Now()}
+		return lim
+	}
+
+	v.lastSeen = time.Now()
+	return v.limiter
+}
+
+func (ms *MemoryStore) cleanup() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	cutoff := time.Now().Add(-ms.ttl)
+	for key, v := range ms.visitors {
+		if v.lastSeen.Before(cutoff) {
+			delete(ms.visitors, key)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/time/rate"
+)
+
+// stores returns every LimiterStore implementation to run a test against.
+// PostgresStore needs TEST_DATABASE_URL and is skipped without it.
+func stores(t *testing.T) map[string]LimiterStore {
+	t.Helper()
+	out := map[string]LimiterStore{"memory": NewMemoryStore(time.Hour)}
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		pool, err := pgxpool.New(context.Background(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		if _, err := pool.Exec(context.Background(), `
+			create unlogged table if not exists rate_limit_buckets (
+				key text primary key,
+				tokens double precision not null,
+				allowed boolean not null,
+				updated_at timestamptz not null default now()
+			)`); err != nil {
+			t.Fatal(err)
+		}
+		out["postgres"] = NewPostgresStore(pool, time.Hour)
+	}
+	for _, s := range out {
+		t.Cleanup(s.Close)
+	}
+	return out
+}
+
+// uniqueKey keeps Postgres runs from seeing buckets left by earlier runs.
+func uniqueKey(t *testing.T, name string) string {
+	return fmt.Sprintf("%s|%s|%d", t.Name(), name, time.Now().UnixNano())
+}
+
+func TestStoreTakeExhaustsBurst(t *testing.T) {
+	// Refills once an hour, so nothing comes back during the test.
+	p := Policy{Name: "test", Rate: rate.Every(time.Hour), Burst: 3}
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			key := uniqueKey(t, "a")
+			for i := 0; i < 3; i++ {
+				d, err := store.Take(context.Background(), key, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !d.Allowed {
+					t.Fatalf("take %d denied", i+1)
+				}
+				if left := int(d.Tokens + 0.01); left != 2-i {
+					t.Fatalf("take %d: tokens = %v, want %d", i+1, d.Tokens, 2-i)
+				}
+			}
+
+			d, err := store.Take(context.Background(), key, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed {
+				t.Fatal("take past burst allowed")
+			}
+			if d.RetryAfter < 59*time.Minute || d.RetryAfter > time.Hour {
+				t.Fatalf("RetryAfter = %v, want about an hour", d.RetryAfter)
+			}
+
+			// Other keys have their own bucket.
+			if d, _ := store.Take(context.Background(), uniqueKey(t, "b"), p); !d.Allowed {
+				t.Fatal("separate key denied")
+			}
+		})
+	}
+}
+
+func TestStoreTakeRefills(t *testing.T) {
+	p := Policy{Name: "test", Rate: 20, Burst: 1}
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			key := uniqueKey(t, "a")
+			if d, _ := store.Take(context.Background(), key, p); !d.Allowed {
+				t.Fatal("first take denied")
+			}
+			if d, _ := store.Take(context.Background(), key, p); d.Allowed {
+				t.Fatal("second take allowed before refill")
+			}
+			time.Sleep(100 * time.Millisecond) // 20/s refills a token every 50ms
+			if d, _ := store.Take(context.Background(), key, p); !d.Allowed {
+				t.Fatal("take after refill denied")
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryStore(time.Hour)
+	t.Cleanup(store.Close)
+	// 2 requests, refilling one every 30 seconds.
+	rl := NewRateLimiter(Policy{Name: "test", Rate: rate.Every(30 * time.Second), Burst: 2, Key: KeyByIP}, store)
+
+	r := gin.New()
+	r.GET("/", rl.Middleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	do := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		status           int
+		remaining, reset string
+		retryAfter       string
+	}{
+		{http.StatusNoContent, "1", "30", ""},
+		{http.StatusNoContent, "0", "60", ""},
+		{http.StatusTooManyRequests, "0", "60", "30"},
+	}
+	for i, tt := range tests {
+		w := do("203.0.113.7:1000")
+		h := w.Header()
+		if w.Code != tt.status {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, tt.status)
+		}
+		if h.Get("RateLimit-Policy") != "2;w=60" || h.Get("RateLimit-Limit") != "2" {
+			t.Errorf("request %d: policy %q, limit %q", i+1, h.Get("RateLimit-Policy"), h.Get("RateLimit-Limit"))
+		}
+		if h.Get("RateLimit-Remaining") != tt.remaining || h.Get("RateLimit-Reset") != tt.reset {
+			t.Errorf("request %d: remaining %q reset %q, want %s and %s",
+				i+1, h.Get("RateLimit-Remaining"), h.Get("RateLimit-Reset"), tt.remaining, tt.reset)
+		}
+		if h.Get("Retry-After") != tt.retryAfter {
+			t.Errorf("request %d: Retry-After %q, want %q", i+1, h.Get("Retry-After"), tt.retryAfter)
+		}
+	}
+
+	// Another client is unaffected.
+	if w := do("198.51.100.9:1000"); w.Code != http.StatusNoContent {
+		t.Fatalf("other IP: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func keyFor(t *testing.T, trusted []string, remote, xff string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(trusted); err != nil {
+		t.Fatal(err)
+	}
+	var key string
+	r.GET("/", func(c *gin.Context) { key = KeyByUserOrIP(c) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remote
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return key
+}
+
+func TestSpoofedForwardedForDoesNotChangeKey(t *testing.T) {
+	want := "ip:203.0.113.7"
+	for _, xff := range []string{"", "1.2.3.4", "198.51.100.1, 10.0.0.1"} {
+		if got := keyFor(t, nil, "203.0.113.7:5555", xff); got != want {
+			t.Errorf("XFF %q: key = %q, want %q", xff, got, want)
+		}
+	}
+}
+
+func TestForwardedForHonouredFromTrustedProxy(t *testing.T) {
+	got := keyFor(t, []string{"10.0.0.0/8"}, "10.1.2.3:443", "203.0.113.7")
+	if got != "ip:203.0.113.7" {
+		t.Errorf("key = %q, want client address from XFF", got)
+	}
+
+	// A client can't chain a fake address ahead of the real one.
+	got = keyFor(t, []string{"10.0.0.0/8"}, "10.1.2.3:443", "1.2.3.4, 203.0.113.7")
+	if got != "ip:203.0.113.7" {
+		t.Errorf("key = %q, want rightmost untrusted address", got)
+	}
+}
@@ -1,9 +1,11 @@
 package httpapi
 
 import (
+	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 )
 
 type ErrorEnvelope struct {
@@ -50,3 +52,39 @@ func NotFound(c *gin.Context, message string, details map[string]any) {
 func Internal(c *gin.Context, message string) {
 	WriteError(c, http.StatusInternalServerError, "INTERNAL", message, nil)
 }
+
+var kindStatus = map[apperr.Kind]int{
+	apperr.KindInternal:     http.StatusInternalServerError,
+	apperr.KindValidation:   http.StatusBadRequest,
+	apperr.KindNotFound:     http.StatusNotFound,
+	apperr.KindConflict:     http.StatusConflict,
+	apperr.KindForbidden:    http.StatusForbidden,
+	apperr.KindUnauthorized: http.StatusUnauthorized,
+	apperr.KindUnavailable:  http.StatusBadGateway,
+}
+
+// Error writes a service error as an envelope. Typed errors map by kind,
+// with field errors under details.fields; anything untyped is logged and
+// reported as a generic 500 so internals (SQL, driver errors) never leak.
+func Error(c *gin.Context, err error) {
+	e, ok := apperr.As(err)
+	if !ok {
+		slog.Error("unhandled error", "request_id", RequestID(c), "path", c.FullPath(), "err", err)
+		Internal(c, "internal error")
+		return
+	}
+
+	var details map[string]any
+	if len(e.Fields) > 0 {
+		details = map[string]any{"fields": e.Fields}
+	}
+	WriteError(c, kindStatus[e.Kind], e.Code, e.Message, details)
+}
+
+// Recovery turns panics into the standard 500 envelope.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, rec any) {
+		slog.Error("panic", "request_id", RequestID(c), "path", c.Request.URL.Path, "panic", rec)
+		Internal(c, "internal error")
+	})
+}
@@ -0,0 +1,173 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLen = 255
+)
+
+// keyRepo is the part of RepoPostgres the middleware and expiry loop use.
+type keyRepo interface {
+	Reserve(ctx context.Context, userID, key, method, path, hash string, expiresAt time.Time) (record, bool, error)
+	Complete(ctx context.Context, userID, key string, status int, contentType string, body []byte) error
+	Release(ctx context.Context, userID, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// Store replays responses for retried mutating requests that carry an
+// Idempotency-Key header. Keys are scoped per user and expire after ttl.
+type Store struct {
+	repo keyRepo
+	ttl  time.Duration
+}
+
+func NewStore(repo *RepoPostgres, ttl time.Duration) *Store {
+	return &Store{repo: repo, ttl: ttl}
+}
+
+// Middleware must run after auth; requests without a user or key pass through.
+//
+// First request with a key: runs normally and its response (anything below
+// 500) is stored. Retry with the same key and body: the stored response is
+// returned with Idempotent-Replayed: true. Same key, different request: 422.
+// Retry while the first is still running: 409.
+func (s *Store) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(HeaderKey))
+		userID := c.GetString("userId")
+		if key == "" || userID == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLen {
+			httpapi.BadRequest(c, "Idempotency-Key too long", map[string]any{"max_length": maxKeyLen})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			httpapi.BadRequest(c, "could not read request body", nil)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		method := c.Request.Method
+		path := c.Request.URL.Path
+		hash := requestHash(method, path, body)
+
+		// Keep bookkeeping alive if the client hangs up mid-request; that's
+		// exactly the case a retry will follow.
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		rec, created, err := s.repo.Reserve(ctx, userID, key, method, path, hash, time.Now().Add(s.ttl))
+		if err != nil {
+			httpapi.Internal(c, "failed to check idempotency key")
+			return
+		}
+		if !created {
+			switch {
+			case rec.RequestHash != hash:
+				httpapi.WriteError(c, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED",
+					"Idempotency-Key was already used for a different request", nil)
+			case rec.StatusCode == 0:
+				httpapi.WriteError(c, http.StatusConflict, "REQUEST_IN_PROGRESS",
+					"a request with this Idempotency-Key is still being processed", nil)
+			default:
+				c.Header(HeaderReplayed, "true")
+				c.Data(rec.StatusCode, rec.ContentType, rec.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		// Deferred so a panicking handler frees the key instead of leaving it
+		// "in progress" until it expires; the panic then carries on to Recovery.
+		defer func() {
+			if p := recover(); p != nil {
+				s.release(ctx, userID, key)
+				panic(p)
+			}
+			status := w.Status()
+			if status >= http.StatusInternalServerError {
+				s.release(ctx, userID, key)
+				return
+			}
+			if err := s.repo.Complete(ctx, userID, key, status, w.Header().Get("Content-Type"), w.buf.Bytes()); err != nil {
+				slog.Warn("idempotency store failed", "err", err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// release frees a reserved key so the request can be retried.
+func (s *Store) release(ctx context.Context, userID, key string) {
+	if err := s.repo.Release(ctx, userID, key); err != nil {
+		slog.Warn("idempotency release failed", "err", err)
+	}
+}
+
+// RunExpiry deletes expired keys every interval until ctx is done.
+func (s *Store) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.repo.DeleteExpired(ctx)
+			if err != nil {
+				slog.Warn("idempotency expiry failed", "err", err)
+			} else if n > 0 {
+				slog.Info("idempotency keys expired", "count", n)
+			}
+		}
+	}
+}
+
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// captureWriter tees the response body so it can be stored after the handler runs.
+type captureWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
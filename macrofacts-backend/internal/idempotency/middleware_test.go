@@ -0,0 +1,129 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+// memRepo keeps keys in memory; StatusCode 0 means still in progress.
+type memRepo struct {
+	mu   sync.Mutex
+	keys map[string]record
+}
+
+func newMemRepo() *memRepo { return &memRepo{keys: map[string]record{}} }
+
+func (m *memRepo) Reserve(_ context.Context, userID, key, _, _, hash string, _ time.Time) (record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec, ok := m.keys[userID+"|"+key]; ok {
+		return rec, false, nil
+	}
+	m.keys[userID+"|"+key] = record{RequestHash: hash}
+	return record{}, true, nil
+}
+
+func (m *memRepo) Complete(_ context.Context, userID, key string, status int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec := m.keys[userID+"|"+key]
+	rec.StatusCode, rec.ContentType, rec.Body = status, contentType, append([]byte(nil), body...)
+	m.keys[userID+"|"+key] = rec
+	return nil
+}
+
+func (m *memRepo) Release(_ context.Context, userID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, userID+"|"+key)
+	return nil
+}
+
+func (m *memRepo) DeleteExpired(context.Context) (int64, error) { return 0, nil }
+
+func newRouter(repo keyRepo, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(httpapi.Recovery())
+	r.POST("/things", func(c *gin.Context) { c.Set("userId", "u1") }, (&Store{repo: repo, ttl: time.Hour}).Middleware(), handler)
+	return r
+}
+
+func post(r http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	req.Header.Set(HeaderKey, key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPanickingHandlerReleasesKey(t *testing.T) {
+	repo := newMemRepo()
+	calls := 0
+	r := newRouter(repo, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+
+	if w := post(r, "k1", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("first attempt = %d, want 500", w.Code)
+	}
+	if len(repo.keys) != 0 {
+		t.Fatalf("key still reserved after panic: %+v", repo.keys)
+	}
+
+	w := post(r, "k1", `{}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("retry = %d %s, want 201", w.Code, w.Body)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestRetryReplaysStoredResponse(t *testing.T) {
+	repo := newMemRepo()
+	calls := 0
+	r := newRouter(repo, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"n": calls})
+	})
+
+	first := post(r, "k1", `{"a":1}`)
+	second := post(r, "k1", `{"a":1}`)
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(HeaderReplayed) != "true" {
+		t.Error("replay not marked")
+	}
+
+	if w := post(r, "k1", `{"a":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body = %d, want 422", w.Code)
+	}
+}
+
+func TestServerErrorReleasesKey(t *testing.T) {
+	repo := newMemRepo()
+	r := newRouter(repo, func(c *gin.Context) { httpapi.Internal(c, "nope") })
+
+	post(r, "k1", `{}`)
+	if len(repo.keys) != 0 {
+		t.Fatalf("key kept after 500: %+v", repo.keys)
+	}
+}
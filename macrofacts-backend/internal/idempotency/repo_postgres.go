@@ -0,0 +1,92 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RepoPostgres struct {
+	db *pgxpool.Pool
+}
+
+func NewRepoPostgres(db *pgxpool.Pool) *RepoPostgres {
+	return &RepoPostgres{db: db}
+}
+
+// record is a stored key. StatusCode is 0 while the first request is still running.
+type record struct {
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Reserve claims (userID, key) for a new request. When the key is already
+// taken (and not expired) it returns the existing record and created=false.
+func (r *RepoPostgres) Reserve(ctx context.Context, userID, key, method, path, hash string, expiresAt time.Time) (record, bool, error) {
+	// An expired key that the sweeper hasn't reached yet must not block reuse.
+	if _, err := r.db.Exec(ctx, `
+		delete from idempotency_keys
+		where user_id = $1 and key = $2 and expires_at <= now()
+	`, userID, key); err != nil {
+		return record{}, false, err
+	}
+
+	tag, err := r.db.Exec(ctx, `
+		insert into idempotency_keys (user_id, key, method, path, request_hash, expires_at)
+		values ($1, $2, $3, $4, $5, $6)
+		on conflict (user_id, key) do nothing
+	`, userID, key, method, path, hash, expiresAt)
+	if err != nil {
+		return record{}, false, err
+	}
+	if tag.RowsAffected() == 1 {
+		return record{RequestHash: hash}, true, nil
+	}
+
+	var rec record
+	err = r.db.QueryRow(ctx, `
+		select request_hash, coalesce(status_code, 0), coalesce(content_type, ''), coalesce(response_body, ''::bytea)
+		from idempotency_keys
+		where user_id = $1 and key = $2
+	`, userID, key).Scan(&rec.RequestHash, &rec.StatusCode, &rec.ContentType, &rec.Body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Released between our insert and select; let the client retry.
+		return record{}, false, errors.New("idempotency key released concurrently")
+	}
+	if err != nil {
+		return record{}, false, err
+	}
+	return rec, false, nil
+}
+
+// Complete stores the response so retries can replay it.
+func (r *RepoPostgres) Complete(ctx context.Context, userID, key string, status int, contentType string, body []byte) error {
+	_, err := r.db.Exec(ctx, `
+		update idempotency_keys
+		set status_code = $3, content_type = $4, response_body = $5
+		where user_id = $1 and key = $2
+	`, userID, key, status, contentType, body)
+	return err
+}
+
+// Release drops a reservation whose request failed server-side, so the key can be retried.
+func (r *RepoPostgres) Release(ctx context.Context, userID, key string) error {
+	_, err := r.db.Exec(ctx, `
+		delete from idempotency_keys
+		where user_id = $1 and key = $2
+	`, userID, key)
+	return err
+}
+
+func (r *RepoPostgres) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, `delete from idempotency_keys where expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,145 @@
+package logs
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+)
+
+const maxCopyEntries = 200
+
+// CopyEntries duplicates entries onto another date/meal in one transaction.
+func (s *Service) CopyEntries(ctx context.Context, userID string, req CopyEntriesRequest) ([]string, error) {
+	if userID == "" {
+		return nil, apperr.Unauthorized("unauthorized")
+	}
+
+	toDay, err := time.Parse("2006-01-02", req.ToDate)
+	if err != nil {
+		return nil, apperr.InvalidField("toDate", "invalid toDate")
+	}
+
+	src, err := s.copySource(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(src) == 0 {
+		return nil, apperr.Invalid("nothing to copy")
+	}
+	if len(src) > maxCopyEntries {
+		return nil, apperr.Invalid("too many entries")
+	}
+
+	slots, err := s.mealSlots(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[Meal]bool, len(slots))
+	for _, sl := range slots {
+		if !sl.Archived {
+			active[Meal(sl.Key)] = true
+		}
+	}
+
+	out := make([]entryRow, 0, len(src))
+	for _, e := range src {
+		meal := Meal(e.Meal)
+		if req.ToMeal != nil {
+			meal = *req.ToMeal
+		}
+		if !active[meal] {
+			return nil, apperr.Invalid("invalid meal: " + string(meal))
+		}
+
+		c := e
+		if req.Reresolve {
+			c, err = s.reresolve(ctx, userID, e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.Meal = string(meal)
+		out = append(out, c)
+	}
+
+	ids, err := s.repo.InsertEntries(ctx, userID, toDay, out)
+	if err != nil {
+		return nil, apperr.Internal("failed to copy entries")
+	}
+
+	date := toDay.Format("2006-01-02")
+	s.publishEntries(ctx, userID, events.EntryCreated, date, entryEvents(ids, out, date))
+	return ids, nil
+}
+
+func (s *Service) copySource(ctx context.Context, userID string, req CopyEntriesRequest) ([]entryRow, error) {
+	if len(req.EntryIDs) > 0 {
+		if len(req.EntryIDs) > maxCopyEntries {
+			return nil, apperr.Invalid("too many entries")
+		}
+		// Listing an entry twice copies it once.
+		ids := make([]string, 0, len(req.EntryIDs))
+		seen := make(map[string]bool, len(req.EntryIDs))
+		for _, id := range req.EntryIDs {
+			if !uuidRe.MatchString(id) {
+				return nil, apperr.InvalidField("entryIds", "invalid entry id: "+id)
+			}
+			id = strings.ToLower(id)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		rows, err := s.repo.ListEntriesByIDs(ctx, userID, ids)
+		if err != nil {
+			return nil, apperr.Internal("failed to load entries")
+		}
+		// IDs that aren't the user's (or don't exist) simply don't come back.
+		if len(rows) != len(ids) {
+			return nil, apperr.NotFound("entry not found")
+		}
+		return rows, nil
+	}
+
+	if req.FromDate == nil {
+		return nil, apperr.Invalid("fromDate or entryIds required")
+	}
+	fromDay, err := time.Parse("2006-01-02", *req.FromDate)
+	if err != nil {
+		return nil, apperr.InvalidField("fromDate", "invalid fromDate")
+	}
+
+	var rows []entryRow
+	if req.FromMeal != nil {
+		rows, err = s.repo.ListEntriesForMeal(ctx, userID, fromDay, string(*req.FromMeal))
+	} else {
+		rows, err = s.repo.ListEntriesForDate(ctx, userID, fromDay)
+	}
+	if err != nil {
+		return nil, apperr.Internal("failed to load entries")
+	}
+	return rows, nil
+}
+
+// reresolve recomputes the snapshot from current food data. Entries whose food
+// no longer exists keep their original snapshot rather than failing the copy;
+// any other lookup failure does fail it.
+func (s *Service) reresolve(ctx context.Context, userID string, e entryRow) (entryRow, error) {
+	switch foods.FoodSource(e.Source) {
+	case foods.FoodSourceOFF, foods.FoodSourceCustom, foods.FoodSourceRecipe:
+	default:
+		return e, nil
+	}
+	fresh, err := s.resolveEntry(ctx, userID, foods.FoodSource(e.Source), e.FoodID, e.Barcode, e.QuantityG)
+	if foods.IsNotFound(err) {
+		return e, nil
+	}
+	if err != nil {
+		return entryRow{}, err
+	}
+	return fresh, nil
+}
@@ -0,0 +1,185 @@
+package logs
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+)
+
+// Entries lose half their weight in the frequent-foods ranking every 30 days.
+const frequentHalfLifeDays = 30.0
+
+// AddFavorite stars a food. The food must resolve so we don't collect dead refs.
+func (s *Service) AddFavorite(ctx context.Context, userID string, req FavoriteRequest) (foods.FoodDTO, error) {
+	if userID == "" {
+		return foods.FoodDTO{}, apperr.Unauthorized("unauthorized")
+	}
+	source, ref, err := favoriteRef(req.Source, req.FoodID, req.Barcode)
+	if err != nil {
+		return foods.FoodDTO{}, err
+	}
+
+	dto, err := s.resolveFood(ctx, userID, source, ref)
+	if err != nil {
+		return foods.FoodDTO{}, err
+	}
+
+	if err := s.repo.AddFavorite(ctx, userID, string(source), ref); err != nil {
+		return foods.FoodDTO{}, apperr.Internal("failed to save favorite")
+	}
+	return dto, nil
+}
+
+func (s *Service) RemoveFavorite(ctx context.Context, userID string, source foods.FoodSource, ref string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	ok, err := s.repo.RemoveFavorite(ctx, userID, string(source), strings.TrimSpace(ref))
+	if err != nil {
+		return apperr.Internal("failed to remove favorite")
+	}
+	if !ok {
+		return apperr.NotFound("not found")
+	}
+	return nil
+}
+
+// ListFavorites returns starred foods with current food data, newest star first.
+// Favorites whose food has since disappeared are skipped.
+func (s *Service) ListFavorites(ctx context.Context, userID string) (FavoritesResponse, error) {
+	if userID == "" {
+		return FavoritesResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	rows, err := s.repo.ListFavorites(ctx, userID)
+	if err != nil {
+		return FavoritesResponse{}, apperr.Internal("failed to load favorites")
+	}
+
+	out := FavoritesResponse{Items: make([]foods.FoodDTO, 0, len(rows))}
+	for _, f := range rows {
+		dto, err := s.resolveFood(ctx, userID, foods.FoodSource(f.Source), f.Ref)
+		if err != nil {
+			continue
+		}
+		out.Items = append(out.Items, dto)
+	}
+	return out, nil
+}
+
+// FrequentFoods ranks what the user logs most, weighted towards recent entries.
+// The cursor is an opaque offset.
+func (s *Service) FrequentFoods(ctx context.Context, userID string, q FrequentFoodsQuery) (FrequentFoodsResponse, error) {
+	if userID == "" {
+		return FrequentFoodsResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	if q.Limit <= 0 || q.Limit > 50 {
+		q.Limit = 25
+	}
+	if q.Hour != nil && (*q.Hour < 0 || *q.Hour > 23) {
+		return FrequentFoodsResponse{}, apperr.Invalid("hour out of range")
+	}
+
+	offset := 0
+	if q.Cursor != "" {
+		n, err := strconv.Atoi(q.Cursor)
+		if err != nil || n < 0 {
+			return FrequentFoodsResponse{}, apperr.InvalidField("cursor", "invalid cursor")
+		}
+		offset = n
+	}
+
+	var meal *string
+	if q.Meal != nil {
+		m := string(*q.Meal)
+		meal = &m
+	}
+
+	// Fetch one extra row to know whether there's another page.
+	rows, err := s.repo.ListFrequentFoods(ctx, userID, s.location(userID).String(), meal, q.Hour, frequentHalfLifeDays, q.Limit+1, offset)
+	if err != nil {
+		return FrequentFoodsResponse{}, apperr.Internal("failed to load frequent foods")
+	}
+
+	resp := FrequentFoodsResponse{Items: make([]FrequentFood, 0, len(rows))}
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		next := strconv.Itoa(offset + q.Limit)
+		resp.NextCursor = &next
+	}
+	for _, r := range rows {
+		resp.Items = append(resp.Items, FrequentFood{
+			RecentFood:   recentFoodFromRow(r.entryRow),
+			LogCount:     r.LogCount,
+			Score:        math.Round(r.Score*1000) / 1000,
+			LastLoggedAt: r.LastLogged.UTC().Format("2006-01-02T15:04:05Z"),
+			Favorite:     r.Favorite,
+		})
+	}
+	return resp, nil
+}
+
+// MatchHistory implements foods.HistoryProvider so search can rank the user's
+// own foods first. Tokens are lowercase [a-z0-9] words from the search query.
+func (s *Service) MatchHistory(ctx context.Context, userID string, tokens []string, limit int) ([]foods.HistoryMatch, error) {
+	if userID == "" || len(tokens) == 0 {
+		return nil, nil
+	}
+	rows, err := s.repo.HistoryMatches(ctx, userID, tokens, frequentHalfLifeDays, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]foods.HistoryMatch, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, foods.HistoryMatch{Source: foods.FoodSource(r.Source), Ref: r.Ref, Score: r.Score})
+	}
+	return out, nil
+}
+
+func (s *Service) resolveFood(ctx context.Context, userID string, source foods.FoodSource, ref string) (foods.FoodDTO, error) {
+	switch source {
+	case foods.FoodSourceOFF:
+		d, err := s.foods.ByBarcode(ctx, ref)
+		if err != nil || d == nil {
+			return foods.FoodDTO{}, apperr.NotFound("food not found")
+		}
+		return *d, nil
+	case foods.FoodSourceCustom:
+		d, err := s.foods.ByCustomID(ctx, ref)
+		if err != nil {
+			return foods.FoodDTO{}, apperr.NotFound("food not found")
+		}
+		return d, nil
+	case foods.FoodSourceRecipe:
+		d, err := s.foods.ByRecipeID(ctx, userID, ref)
+		if err != nil {
+			return foods.FoodDTO{}, apperr.NotFound("food not found")
+		}
+		return d, nil
+	}
+	return foods.FoodDTO{}, apperr.InvalidField("source", "invalid source")
+}
+
+// favoriteRef picks the identifier stored for a favorite, accepting foodId as
+// the barcode for OFF foods the same way CreateEntry does.
+func favoriteRef(source foods.FoodSource, foodID, barcode *string) (foods.FoodSource, string, error) {
+	switch source {
+	case foods.FoodSourceOFF:
+		if b := strings.TrimSpace(derefStr(barcode)); b != "" {
+			return source, b, nil
+		}
+		if id := strings.TrimSpace(derefStr(foodID)); id != "" {
+			return source, id, nil
+		}
+		return "", "", apperr.InvalidField("barcode", "barcode required for off")
+	case foods.FoodSourceCustom, foods.FoodSourceRecipe:
+		if id := strings.TrimSpace(derefStr(foodID)); id != "" {
+			return source, id, nil
+		}
+		return "", "", apperr.Invalid("foodId required for " + string(source))
+	}
+	return "", "", apperr.InvalidField("source", "invalid source")
+}
@@ -1,9 +1,15 @@
 package logs
 
 import (
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
 )
 
@@ -19,7 +25,27 @@ func (h *Handler) Today(c *gin.Context) {
 	uid := c.GetString("userId")
 	resp, err := h.svc.Today(c.Request.Context(), uid)
 	if err != nil {
-		httpapi.BadRequest(c, err.Error(), nil)
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) Day(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.Day(c.Request.Context(), uid, c.Param("date"))
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) Summary(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.Summary(c.Request.Context(), uid, c.Query("from"), c.Query("to"))
+	if err != nil {
+		httpapi.Error(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, resp)
@@ -36,9 +62,277 @@ func (h *Handler) CreateEntry(c *gin.Context) {
 
 	id, err := h.svc.CreateEntry(c.Request.Context(), uid, req)
 	if err != nil {
-		httpapi.BadRequest(c, err.Error(), nil)
+		httpapi.Error(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, CreateEntryResponse{ID: id})
 }
+
+func (h *Handler) DeleteEntry(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	if err := h.svc.DeleteEntry(c.Request.Context(), uid, id); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) MealSlots(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.MealSlots(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) UpdateMealSlots(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req UpdateMealSlotsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	resp, err := h.svc.UpdateMealSlots(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) ListSavedMeals(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.ListSavedMeals(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) GetSavedMeal(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	m, err := h.svc.SavedMeal(c.Request.Context(), uid, id)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+func (h *Handler) CreateSavedMeal(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req CreateSavedMealRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	m, err := h.svc.CreateSavedMeal(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+func (h *Handler) SaveMealFromDay(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req SaveMealFromDayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	m, err := h.svc.SaveMealFromDay(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+func (h *Handler) DeleteSavedMeal(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	if err := h.svc.DeleteSavedMeal(c.Request.Context(), uid, id); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) LogSavedMeal(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	var req LogSavedMealRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	ids, err := h.svc.LogSavedMeal(c.Request.Context(), uid, id, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, CreateEntriesResponse{IDs: ids})
+}
+
+func (h *Handler) CopyEntries(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req CopyEntriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	ids, err := h.svc.CopyEntries(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, CreateEntriesResponse{IDs: ids})
+}
+
+func (h *Handler) ListFavorites(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.ListFavorites(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) AddFavorite(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req FavoriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	dto, err := h.svc.AddFavorite(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, foods.ItemResponse{Item: &dto})
+}
+
+func (h *Handler) RemoveFavorite(c *gin.Context) {
+	uid := c.GetString("userId")
+	source := foods.FoodSource(c.Param("source"))
+	ref := c.Param("ref")
+
+	if err := h.svc.RemoveFavorite(c.Request.Context(), uid, source, ref); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) FrequentFoods(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	q := FrequentFoodsQuery{Cursor: strings.TrimSpace(c.Query("cursor"))}
+	q.Limit, _ = strconv.Atoi(c.Query("limit"))
+	if v := c.Query("meal"); v != "" {
+		m := Meal(v)
+		q.Meal = &m
+	}
+	if v := c.Query("hour"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			httpapi.Error(c, apperr.InvalidField("hour", "invalid hour"))
+			return
+		}
+		q.Hour = &n
+	}
+
+	resp, err := h.svc.FrequentFoods(c.Request.Context(), uid, q)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) SyncPull(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.SyncPull(c.Request.Context(), uid, c.Query("since"))
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) SyncPush(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req SyncPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	resp, err := h.svc.SyncPush(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Keeps proxies from closing an idle stream.
+const streamHeartbeat = 25 * time.Second
+
+// Stream pushes the user's entry and day-summary events as Server-Sent Events.
+func (h *Handler) Stream(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	ch, stop := h.svc.Subscribe(uid)
+	defer stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case ev, ok := <-ch:
+			if !ok {
+				// Server shutting down; the client will reconnect.
+				return false
+			}
+			c.SSEvent(ev.Type, ev.Data)
+		case <-heartbeat.C:
+			_, _ = io.WriteString(w, ": ping\n\n")
+		}
+		return true
+	})
+}
@@ -0,0 +1,84 @@
+package logs
+
+import (
+	"context"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
+)
+
+// EntryEvent is the payload of entry.created/updated/deleted.
+type EntryEvent struct {
+	ID   string `json:"id"`
+	Date string `json:"date"`
+	Meal Meal   `json:"meal,omitempty"`
+}
+
+// Subscribe streams the user's live events. Without a bus the channel never
+// fires, so callers only see their own heartbeats.
+func (s *Service) Subscribe(userID string) (<-chan events.Event, func()) {
+	if s.events == nil {
+		return nil, func() {}
+	}
+	return s.events.Subscribe(userID)
+}
+
+// publishEntries announces entry changes on one date, then the refreshed
+// summary for that date.
+func (s *Service) publishEntries(ctx context.Context, userID, typ, date string, entries []EntryEvent) {
+	if s.events == nil {
+		return
+	}
+	for _, e := range entries {
+		s.events.Publish(ctx, userID, typ, e)
+	}
+	s.publishDaySummary(ctx, userID, date)
+}
+
+// publishDaySummary loads the day's totals and goals, so it first checks
+// that a stream or webhook will actually see the result.
+func (s *Service) publishDaySummary(ctx context.Context, userID, date string) {
+	if !s.events.Wants(ctx, userID, events.DaySummary) {
+		return
+	}
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return
+	}
+	totals, err := s.repo.DailyTotals(ctx, userID, day, day)
+	if err != nil {
+		return
+	}
+	// No summary beats one judged against the default goals: day.goal_reached
+	// is only ever sent once per date.
+	resolver, err := s.goalResolver(ctx, userID, day, day)
+	if err != nil {
+		return
+	}
+	var t DayIntake
+	if len(totals) > 0 {
+		t = totals[0]
+	}
+	s.events.Publish(ctx, userID, events.DaySummary, DaySummary{
+		Date: date,
+		Summary: newSummary(goalsAt(resolver, date), MacroTotals{
+			Calories: t.Calories,
+			ProteinG: t.ProteinG,
+			CarbsG:   t.CarbsG,
+			FatG:     t.FatG,
+		}),
+	})
+}
+
+// entryEvents pairs inserted ids with the rows they came from.
+func entryEvents(ids []string, rows []entryRow, date string) []EntryEvent {
+	out := make([]EntryEvent, 0, len(ids))
+	for i, id := range ids {
+		ev := EntryEvent{ID: id, Date: date}
+		if i < len(rows) {
+			ev.Meal = Meal(rows[i].Meal)
+		}
+		out = append(out, ev)
+	}
+	return out
+}
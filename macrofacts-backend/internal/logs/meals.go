@@ -0,0 +1,154 @@
+package logs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+const maxMealSlots = 12
+
+var defaultMealSlots = []MealSlot{
+	{Key: MealBreakfast, Label: "Breakfast"},
+	{Key: MealLunch, Label: "Lunch"},
+	{Key: MealDinner, Label: "Dinner"},
+	{Key: MealSnacks, Label: "Snacks"},
+}
+
+// mealSlots returns the user's slots in display order, archived ones last.
+// Accounts created after the meal-slot migration are seeded on first use.
+func (s *Service) mealSlots(ctx context.Context, userID string) ([]mealSlotRow, error) {
+	rows, err := s.repo.ListMealSlots(ctx, userID)
+	if err != nil {
+		return nil, apperr.Internal("failed to load meal slots")
+	}
+	if len(rows) > 0 {
+		return rows, nil
+	}
+
+	if err := s.repo.SeedMealSlots(ctx, userID, defaultMealSlots); err != nil {
+		return nil, apperr.Internal("failed to load meal slots")
+	}
+	rows, err = s.repo.ListMealSlots(ctx, userID)
+	if err != nil {
+		return nil, apperr.Internal("failed to load meal slots")
+	}
+	return rows, nil
+}
+
+func (s *Service) MealSlots(ctx context.Context, userID string) (MealSlotsResponse, error) {
+	if userID == "" {
+		return MealSlotsResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	rows, err := s.mealSlots(ctx, userID)
+	if err != nil {
+		return MealSlotsResponse{}, err
+	}
+
+	out := MealSlotsResponse{Items: []MealSlot{}}
+	for _, r := range rows {
+		if r.Archived {
+			continue
+		}
+		out.Items = append(out.Items, MealSlot{Key: Meal(r.Key), Label: r.Label})
+	}
+	return out, nil
+}
+
+func (s *Service) UpdateMealSlots(ctx context.Context, userID string, req UpdateMealSlotsRequest) (MealSlotsResponse, error) {
+	if userID == "" {
+		return MealSlotsResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	if len(req.Items) == 0 {
+		return MealSlotsResponse{}, apperr.Invalid("at least one meal slot required")
+	}
+	if len(req.Items) > maxMealSlots {
+		return MealSlotsResponse{}, apperr.Invalid("too many meal slots")
+	}
+
+	existing, err := s.mealSlots(ctx, userID)
+	if err != nil {
+		return MealSlotsResponse{}, err
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		taken[r.Key] = true
+	}
+
+	slots := make([]MealSlot, 0, len(req.Items))
+	seen := make(map[Meal]bool, len(req.Items))
+	for _, it := range req.Items {
+		label := strings.TrimSpace(it.Label)
+		if label == "" || len([]rune(label)) > 40 {
+			return MealSlotsResponse{}, apperr.Invalid("invalid meal label")
+		}
+
+		var key Meal
+		if it.Key != nil && *it.Key != "" {
+			key = *it.Key
+			if !taken[string(key)] {
+				return MealSlotsResponse{}, apperr.Invalid("unknown meal key")
+			}
+		} else {
+			key = Meal(uniqueSlotKey(label, taken))
+			taken[string(key)] = true
+		}
+		if seen[key] {
+			return MealSlotsResponse{}, apperr.Invalid("duplicate meal key")
+		}
+		seen[key] = true
+		slots = append(slots, MealSlot{Key: key, Label: label})
+	}
+
+	if err := s.repo.ReplaceMealSlots(ctx, userID, slots); err != nil {
+		return MealSlotsResponse{}, apperr.Internal("failed to save meal slots")
+	}
+	return s.MealSlots(ctx, userID)
+}
+
+// validMeal reports whether meal is one of the user's active slots.
+func (s *Service) validMeal(ctx context.Context, userID string, meal Meal) (bool, error) {
+	rows, err := s.mealSlots(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rows {
+		if r.Key == string(meal) && !r.Archived {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uniqueSlotKey slugs a label ("Pre-workout" -> "pre_workout") and suffixes
+// it until it doesn't collide with a key the user already has (archived included).
+func uniqueSlotKey(label string, taken map[string]bool) string {
+	var b strings.Builder
+	lastUnderscore := true
+	for _, r := range strings.ToLower(label) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			lastUnderscore = false
+		case !lastUnderscore:
+			b.WriteByte('_')
+			lastUnderscore = true
+		}
+	}
+	base := strings.Trim(b.String(), "_")
+	if base == "" {
+		base = "meal"
+	}
+	if len(base) > 32 {
+		base = base[:32]
+	}
+
+	key := base
+	for i := 2; taken[key]; i++ {
+		key = base + "_" + strconv.Itoa(i)
+	}
+	return key
+}
@@ -1,7 +1,15 @@
 package logs
 
-import "github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+import (
+	"time"
 
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/goals"
+)
+
+// Meal is a meal slot key. Users configure their own slots; these four are
+// what every account starts with.
 type Meal string
 
 const (
@@ -19,8 +27,10 @@ type MacroTotals struct {
 }
 
 type TodaySummary struct {
-	CalorieGoal      int `json:"calorieGoal"`
-	CaloriesConsumed int `json:"caloriesConsumed"`
+	// Name of the goal profile that applied that day; nil means base goals.
+	GoalProfile      *string `json:"goalProfile,omitempty"`
+	CalorieGoal      int     `json:"calorieGoal"`
+	CaloriesConsumed int     `json:"caloriesConsumed"`
 	MacrosGoal       struct {
 		ProteinG int `json:"protein_g"`
 		CarbsG   int `json:"carbs_g"`
@@ -51,6 +61,7 @@ type TodayEntry struct {
 
 type TodayMeal struct {
 	Meal    Meal         `json:"meal"`
+	Label   string       `json:"label"`
 	Totals  MacroTotals  `json:"totals"`
 	Entries []TodayEntry `json:"entries"`
 }
@@ -80,14 +91,282 @@ type TodayResponse struct {
 	RecentFoods []RecentFood `json:"recentFoods"`
 }
 
+type DaySummary struct {
+	Date    string       `json:"date"`
+	Summary TodaySummary `json:"summary"`
+}
+
+type RangeSummaryResponse struct {
+	From string       `json:"from"`
+	To   string       `json:"to"`
+	Days []DaySummary `json:"days"`
+}
+
 type CreateEntryRequest struct {
-	Meal      Meal             `json:"meal" binding:"required"`
-	Source    foods.FoodSource `json:"source" binding:"required"`
+	Meal      Meal             `json:"meal"`
+	Source    foods.FoodSource `json:"source"`
 	FoodID    *string          `json:"foodId,omitempty"`
 	Barcode   *string          `json:"barcode,omitempty"`
-	QuantityG int              `json:"quantity_g" binding:"required"`
+	QuantityG int              `json:"quantity_g"` // required unless source is "quick"
+
+	// Quick entries only: what to call it and the values the user typed in.
+	Label    *string  `json:"label,omitempty"`
+	Calories *int     `json:"calories,omitempty"`
+	ProteinG *float64 `json:"protein_g,omitempty"`
+	CarbsG   *float64 `json:"carbs_g,omitempty"`
+	FatG     *float64 `json:"fat_g,omitempty"`
 }
 
 type CreateEntryResponse struct {
 	ID string `json:"id"`
 }
+
+// DayIntake is the logged total for one calendar day (user's timezone).
+type DayIntake struct {
+	Date     string  `json:"date"`
+	Calories int     `json:"calories"`
+	ProteinG float64 `json:"protein_g"`
+	CarbsG   float64 `json:"carbs_g"`
+	FatG     float64 `json:"fat_g"`
+}
+
+type MealSlot struct {
+	Key   Meal   `json:"key"`
+	Label string `json:"label"`
+}
+
+type MealSlotsResponse struct {
+	Items []MealSlot `json:"items"`
+}
+
+// UpdateMealSlotsRequest replaces the user's slot list; order is display order.
+// Items without a key are new slots (key derived from the label). Existing
+// slots left out are archived, not deleted, so logged entries keep their meal.
+type UpdateMealSlotsRequest struct {
+	Items []struct {
+		Key   *Meal  `json:"key,omitempty"`
+		Label string `json:"label"`
+	} `json:"items" binding:"required"`
+}
+
+type SavedMealItemInput struct {
+	Source    foods.FoodSource `json:"source" binding:"required"`
+	FoodID    *string          `json:"foodId,omitempty"`
+	Barcode   *string          `json:"barcode,omitempty"`
+	QuantityG int              `json:"quantity_g"` // required unless source is "quick"
+
+	// Quick items only, as on CreateEntryRequest.
+	Label    *string  `json:"label,omitempty"`
+	Calories *int     `json:"calories,omitempty"`
+	ProteinG *float64 `json:"protein_g,omitempty"`
+	CarbsG   *float64 `json:"carbs_g,omitempty"`
+	FatG     *float64 `json:"fat_g,omitempty"`
+}
+
+type CreateSavedMealRequest struct {
+	Name  string               `json:"name" binding:"required"`
+	Items []SavedMealItemInput `json:"items" binding:"required"`
+}
+
+// SaveMealFromDayRequest turns one meal of an existing day into a template.
+type SaveMealFromDayRequest struct {
+	Name string `json:"name" binding:"required"`
+	Date string `json:"date" binding:"required"`
+	Meal Meal   `json:"meal" binding:"required"`
+}
+
+type SavedMealItem struct {
+	Source    foods.FoodSource `json:"source"`
+	FoodID    *string          `json:"foodId,omitempty"`
+	Barcode   *string          `json:"barcode,omitempty"`
+	Name      string           `json:"name"`
+	Brand     *string          `json:"brand,omitempty"`
+	QuantityG int              `json:"quantity_g"`
+
+	// Set only for quick items, which have no food to re-resolve.
+	Calories *int     `json:"calories,omitempty"`
+	ProteinG *float64 `json:"protein_g,omitempty"`
+	CarbsG   *float64 `json:"carbs_g,omitempty"`
+	FatG     *float64 `json:"fat_g,omitempty"`
+}
+
+type SavedMeal struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Items []SavedMealItem `json:"items"`
+}
+
+type SavedMealListResponse struct {
+	Items []SavedMeal `json:"items"`
+}
+
+// LogSavedMealRequest logs every item of a saved meal; Date defaults to today.
+type LogSavedMealRequest struct {
+	Date *string `json:"date,omitempty"`
+	Meal Meal    `json:"meal" binding:"required"`
+}
+
+type CreateEntriesResponse struct {
+	IDs []string `json:"ids"`
+}
+
+// CopyEntriesRequest copies a whole day, one meal (FromMeal), or specific
+// entries (EntryIDs) onto ToDate. ToMeal moves everything into one slot;
+// otherwise entries keep their meal.
+type CopyEntriesRequest struct {
+	FromDate *string  `json:"fromDate,omitempty"`
+	FromMeal *Meal    `json:"fromMeal,omitempty"`
+	EntryIDs []string `json:"entryIds,omitempty"`
+
+	ToDate string `json:"toDate" binding:"required"`
+	ToMeal *Meal  `json:"toMeal,omitempty"`
+
+	// Re-resolve against current food data instead of copying the snapshot.
+	Reresolve bool `json:"reresolve,omitempty"`
+}
+
+// FavoriteRequest identifies a food to star: barcode for OFF, foodId for custom/recipe.
+type FavoriteRequest struct {
+	Source  foods.FoodSource `json:"source" binding:"required"`
+	FoodID  *string          `json:"foodId,omitempty"`
+	Barcode *string          `json:"barcode,omitempty"`
+}
+
+type FavoritesResponse struct {
+	Items []foods.FoodDTO `json:"items"`
+}
+
+type FrequentFood struct {
+	RecentFood
+	LogCount     int     `json:"logCount"`
+	Score        float64 `json:"score"`
+	LastLoggedAt string  `json:"lastLoggedAt"`
+	Favorite     bool    `json:"favorite"`
+}
+
+type FrequentFoodsResponse struct {
+	Items      []FrequentFood `json:"items"`
+	NextCursor *string        `json:"next_cursor,omitempty"`
+}
+
+// FrequentFoodsQuery narrows the ranking to entries logged in Meal and/or
+// around Hour (0-23, user's timezone, +/- 2h).
+type FrequentFoodsQuery struct {
+	Meal   *Meal
+	Hour   *int
+	Limit  int
+	Cursor string
+}
+
+// SyncEntry is an entry as of Version. Deleted entries are tombstones: only
+// ID, Version, Deleted and UpdatedAt are set.
+type SyncEntry struct {
+	ID        string          `json:"id"`
+	Version   int64           `json:"version"`
+	Deleted   bool            `json:"deleted,omitempty"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	Date      string          `json:"date,omitempty"`
+	Meal      Meal            `json:"meal,omitempty"`
+	LoggedAt  *time.Time      `json:"loggedAt,omitempty"`
+	Food      *TodayEntryFood `json:"food,omitempty"`
+	QuantityG int             `json:"quantity_g,omitempty"`
+	Computed  *MacroTotals    `json:"computed,omitempty"`
+}
+
+type SyncCustomFood struct {
+	Version int64         `json:"version"`
+	Food    foods.FoodDTO `json:"food"`
+}
+
+// SyncSettings is sent whole whenever settings or goals changed since the token.
+type SyncSettings struct {
+	Version  int64                   `json:"version"`
+	Settings auth.MeSettingsResponse `json:"settings"`
+	Goals    []auth.Goals            `json:"goals"`
+}
+
+// SyncGoalPlan is sent whole on the first pull and whenever a goal profile,
+// the schedule or an override changed since the token.
+type SyncGoalPlan struct {
+	Version int64      `json:"version"`
+	Plan    goals.Plan `json:"plan"`
+}
+
+// SyncResponse is one page of changes. Pass Token back as `since`; keep
+// pulling while HasMore is true.
+type SyncResponse struct {
+	Token       string           `json:"token"`
+	HasMore     bool             `json:"hasMore"`
+	Entries     []SyncEntry      `json:"entries"`
+	CustomFoods []SyncCustomFood `json:"customFoods"`
+	Settings    *SyncSettings    `json:"settings,omitempty"`
+	GoalPlan    *SyncGoalPlan    `json:"goalPlan,omitempty"`
+}
+
+type SyncOp string
+
+const (
+	SyncOpUpsert SyncOp = "upsert"
+	SyncOpDelete SyncOp = "delete"
+)
+
+// SyncEntryInput is the full state of an entry edited offline.
+type SyncEntryInput struct {
+	CreateEntryRequest
+	Date     string     `json:"date"`
+	LoggedAt *time.Time `json:"loggedAt,omitempty"`
+}
+
+// SyncEntryChange is one offline edit. ID is client-generated for new
+// entries. BaseVersion is the server version the edit was made against
+// (0 for entries created offline); if the server has moved on, the server
+// copy wins and the change comes back as a conflict.
+type SyncEntryChange struct {
+	ID          string          `json:"id"`
+	Op          SyncOp          `json:"op"`
+	BaseVersion int64           `json:"baseVersion"`
+	Entry       *SyncEntryInput `json:"entry,omitempty"`
+}
+
+// SyncCustomFoodChange creates a custom food under a client-generated id.
+type SyncCustomFoodChange struct {
+	ID   string                  `json:"id"`
+	Food foods.CreateFoodRequest `json:"food"`
+}
+
+type SyncSettingsChange struct {
+	BaseVersion int64                      `json:"baseVersion"`
+	Patch       auth.UpdateSettingsRequest `json:"patch"`
+}
+
+// SyncPushRequest uploads a batch of offline changes. Since is the client's
+// last token; the response carries everything that changed after it,
+// including the client's own applied changes.
+type SyncPushRequest struct {
+	Since       string                 `json:"since"`
+	Entries     []SyncEntryChange      `json:"entries"`
+	CustomFoods []SyncCustomFoodChange `json:"customFoods"`
+	Settings    *SyncSettingsChange    `json:"settings,omitempty"`
+}
+
+type SyncStatus string
+
+const (
+	SyncApplied  SyncStatus = "applied"
+	SyncConflict SyncStatus = "conflict"
+	SyncRejected SyncStatus = "rejected"
+)
+
+type SyncResult struct {
+	Kind   string     `json:"kind"` // "entry" | "customFood" | "settings"
+	ID     string     `json:"id,omitempty"`
+	Status SyncStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	// Per-field messages when Error is a validation failure.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+type SyncPushResponse struct {
+	Results []SyncResult `json:"results"`
+	SyncResponse
+}
@@ -50,7 +50,7 @@ func (r *RepoPostgres) InsertEntry(
 		insert into food_log_entries
 			(user_id, date, meal, source, food_id, barcode, food_name, brand, quantity_g, calories, protein_g, carbs_g, fat_g)
 		values
-			($1, $2::date, $3, $4, nullif($5,'')::uuid, $6, $7, $8, $9, $10, $11, $12, $13)
+			($1, $2::date, $3, $4, nullif($5,'')::uuid, $6, $7, $8, nullif($9, 0), $10, $11, $12, $13)
 		returning id::text
 	`,
 		userID,
@@ -81,13 +81,13 @@ func (r *RepoPostgres) ListEntriesForDate(ctx context.Context, userID string, da
 			barcode,
 			food_name,
 			brand,
-			quantity_g,
+			coalesce(quantity_g, 0),
 			calories,
 			protein_g::float8,
 			carbs_g::float8,
 			fat_g::float8
 		from food_log_entries
-		where user_id = $1 and date = $2::date
+		where user_id = $1 and date = $2::date and deleted_at is null
 		order by created_at asc
 	`, userID, date.Format("2006-01-02"))
 	if err != nil {
@@ -120,9 +120,9 @@ func (r *RepoPostgres) ListEntriesForDate(ctx context.Context, userID string, da
 	return out, rows.Err()
 }
 
-func (r *RepoPostgres) ListRecentFoods(ctx context.Context, userID string, limit int) ([]entryRow, error) {
+func (r *RepoPostgres) ListEntriesByIDs(ctx context.Context, userID string, ids []string) ([]entryRow, error) {
 	rows, err := r.db.Query(ctx, `
-		select distinct on (coalesce(barcode, food_id::text))
+		select
 			id::text,
 			created_at,
 			meal,
@@ -131,14 +131,68 @@ func (r *RepoPostgres) ListRecentFoods(ctx context.Context, userID string, limit
 			barcode,
 			food_name,
 			brand,
-			quantity_g,
+			coalesce(quantity_g, 0),
 			calories,
 			protein_g::float8,
 			carbs_g::float8,
 			fat_g::float8
 		from food_log_entries
-		where user_id = $1
-		order by coalesce(barcode, food_id::text), created_at desc
+		where user_id = $1 and id = any($2::uuid[]) and deleted_at is null
+		order by created_at asc
+	`, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []entryRow
+	for rows.Next() {
+		var e entryRow
+		if err := rows.Scan(
+			&e.ID,
+			&e.CreatedAt,
+			&e.Meal,
+			&e.Source,
+			&e.FoodID,
+			&e.Barcode,
+			&e.FoodName,
+			&e.Brand,
+			&e.QuantityG,
+			&e.Calories,
+			&e.ProteinG,
+			&e.CarbsG,
+			&e.FatG,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *RepoPostgres) ListRecentFoods(ctx context.Context, userID string, limit int) ([]entryRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select * from (
+			select distinct on (coalesce(barcode, food_id::text))
+				id::text,
+				created_at,
+				meal,
+				source,
+				food_id::text,
+				barcode,
+				food_name,
+				brand,
+				coalesce(quantity_g, 0),
+				calories,
+				protein_g::float8,
+				carbs_g::float8,
+				fat_g::float8
+			from food_log_entries
+			where user_id = $1 and source <> 'quick' and deleted_at is null
+			order by coalesce(barcode, food_id::text), created_at desc
+		) latest
+		-- distinct on forces ordering by key; re-sort so the newest foods come first
+		order by created_at desc
 		limit $2
 	`, userID, limit)
 	if err != nil {
@@ -171,6 +225,113 @@ func (r *RepoPostgres) ListRecentFoods(ctx context.Context, userID string, limit
 	return out, rows.Err()
 }
 
+func (r *RepoPostgres) DailyTotals(ctx context.Context, userID string, from, to time.Time) ([]DayIntake, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			to_char(date, 'YYYY-MM-DD'),
+			sum(calories)::int,
+			sum(protein_g)::float8,
+			sum(carbs_g)::float8,
+			sum(fat_g)::float8
+		from food_log_entries
+		where user_id = $1 and date between $2::date and $3::date and deleted_at is null
+		group by date
+		order by date asc
+	`, userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DayIntake
+	for rows.Next() {
+		var d DayIntake
+		if err := rows.Scan(&d.Date, &d.Calories, &d.ProteinG, &d.CarbsG, &d.FatG); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+type mealSlotRow struct {
+	Key      string
+	Label    string
+	Archived bool
+}
+
+func (r *RepoPostgres) ListMealSlots(ctx context.Context, userID string) ([]mealSlotRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select key, label, archived_at is not null
+		from meal_slots
+		where user_id = $1
+		order by archived_at is not null, position asc, created_at asc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []mealSlotRow
+	for rows.Next() {
+		var m mealSlotRow
+		if err := rows.Scan(&m.Key, &m.Label, &m.Archived); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (r *RepoPostgres) SeedMealSlots(ctx context.Context, userID string, slots []MealSlot) error {
+	for i, m := range slots {
+		_, err := r.db.Exec(ctx, `
+			insert into meal_slots (user_id, key, label, position)
+			values ($1, $2, $3, $4)
+			on conflict (user_id, key) do nothing
+		`, userID, string(m.Key), m.Label, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceMealSlots makes `slots` the active, ordered list. Slots not in the
+// list are archived; previously archived slots that reappear are restored.
+func (r *RepoPostgres) ReplaceMealSlots(ctx context.Context, userID string, slots []MealSlot) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	keys := make([]string, 0, len(slots))
+	for i, m := range slots {
+		keys = append(keys, string(m.Key))
+		_, err := tx.Exec(ctx, `
+			insert into meal_slots (user_id, key, label, position)
+			values ($1, $2, $3, $4)
+			on conflict (user_id, key)
+			do update set label = excluded.label, position = excluded.position, archived_at = null
+		`, userID, string(m.Key), m.Label, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		update meal_slots
+		set archived_at = now()
+		where user_id = $1 and archived_at is null and not (key = any($2))
+	`, userID, keys)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
 func derefStr(p *string) string {
 	if p == nil {
 		return ""
@@ -0,0 +1,206 @@
+package logs
+
+import (
+	"context"
+	"time"
+)
+
+type favoriteRow struct {
+	Source string
+	Ref    string // barcode for OFF, UUID for custom/recipe
+}
+
+type historyRow struct {
+	Source string
+	Ref    string
+	Score  float64
+}
+
+type frequentRow struct {
+	entryRow
+	LogCount   int
+	Score      float64
+	LastLogged time.Time
+	Favorite   bool
+}
+
+func (r *RepoPostgres) AddFavorite(ctx context.Context, userID, source, ref string) error {
+	_, err := r.db.Exec(ctx, `
+		insert into food_favorites (user_id, source, ref)
+		values ($1, $2, $3)
+		on conflict (user_id, source, ref) do nothing
+	`, userID, source, ref)
+	return err
+}
+
+func (r *RepoPostgres) RemoveFavorite(ctx context.Context, userID, source, ref string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		delete from food_favorites
+		where user_id = $1 and source = $2 and ref = $3
+	`, userID, source, ref)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *RepoPostgres) ListFavorites(ctx context.Context, userID string) ([]favoriteRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select source, ref
+		from food_favorites
+		where user_id = $1
+		order by created_at desc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []favoriteRow
+	for rows.Next() {
+		var f favoriteRow
+		if err := rows.Scan(&f.Source, &f.Ref); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ListFrequentFoods ranks foods by a time-decayed log count: each entry is
+// worth 0.5^(age/halfLife), so a food eaten daily last month still loses to
+// one eaten daily this week. The latest entry supplies the display snapshot.
+func (r *RepoPostgres) ListFrequentFoods(
+	ctx context.Context,
+	userID string,
+	tz string,
+	meal *string,
+	hour *int,
+	halfLifeDays float64,
+	limit, offset int,
+) ([]frequentRow, error) {
+	rows, err := r.db.Query(ctx, `
+		with e as (
+			select
+				coalesce(barcode, food_id::text) as ref,
+				id, created_at, meal, source, food_id, barcode, food_name, brand,
+				quantity_g, calories, protein_g, carbs_g, fat_g
+			from food_log_entries
+			where user_id = $1
+			  and deleted_at is null
+			  and source <> 'quick'
+			  and ($3::text is null or meal = $3)
+			  and ($4::int is null or (
+				select least(d, 24 - d)
+				from (select abs(extract(hour from created_at at time zone $2)::int - $4) as d) h
+			  ) <= 2)
+		),
+		ranked as (
+			select
+				ref,
+				count(*)::int as n,
+				sum(power(0.5, extract(epoch from (now() - created_at)) / 86400.0 / $5))::float8 as score,
+				max(created_at) as last_at
+			from e
+			group by ref
+		),
+		latest as (
+			select distinct on (ref) *
+			from e
+			order by ref, created_at desc
+		)
+		select
+			l.id::text,
+			l.created_at,
+			l.meal,
+			l.source,
+			l.food_id::text,
+			l.barcode,
+			l.food_name,
+			l.brand,
+			coalesce(l.quantity_g, 0),
+			l.calories,
+			l.protein_g::float8,
+			l.carbs_g::float8,
+			l.fat_g::float8,
+			r.n,
+			r.score,
+			r.last_at,
+			exists (
+				select 1 from food_favorites f
+				where f.user_id = $1 and f.source = l.source and f.ref = r.ref
+			)
+		from ranked r
+		join latest l on l.ref = r.ref
+		order by r.score desc, r.last_at desc, r.ref
+		limit $6 offset $7
+	`, userID, tz, meal, hour, halfLifeDays, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []frequentRow
+	for rows.Next() {
+		var f frequentRow
+		if err := rows.Scan(
+			&f.ID,
+			&f.CreatedAt,
+			&f.Meal,
+			&f.Source,
+			&f.FoodID,
+			&f.Barcode,
+			&f.FoodName,
+			&f.Brand,
+			&f.QuantityG,
+			&f.Calories,
+			&f.ProteinG,
+			&f.CarbsG,
+			&f.FatG,
+			&f.LogCount,
+			&f.Score,
+			&f.LastLogged,
+			&f.Favorite,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// HistoryMatches finds logged foods whose name+brand contains every token,
+// scored with the same time decay as ListFrequentFoods.
+func (r *RepoPostgres) HistoryMatches(ctx context.Context, userID string, tokens []string, halfLifeDays float64, limit int) ([]historyRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			source,
+			coalesce(barcode, food_id::text) as ref,
+			sum(power(0.5, extract(epoch from (now() - created_at)) / 86400.0 / $3))::float8 as score
+		from food_log_entries
+		where user_id = $1
+		  and deleted_at is null
+		  and source in ('off', 'custom', 'recipe')
+		  and (
+			select bool_and(lower(food_name || ' ' || coalesce(brand, '')) like '%' || t || '%')
+			from unnest($2::text[]) as t
+		  )
+		group by source, ref
+		order by score desc
+		limit $4
+	`, userID, tokens, halfLifeDays, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []historyRow
+	for rows.Next() {
+		var h historyRow
+		if err := rows.Scan(&h.Source, &h.Ref, &h.Score); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,165 @@
+package logs
+
+import (
+	"context"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+)
+
+var errSavedMealNotFound = apperr.NotFound("saved meal not found")
+
+// InsertEntries writes a batch of resolved entries for one date atomically.
+func (r *RepoPostgres) InsertEntries(ctx context.Context, userID string, date time.Time, entries []entryRow) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		var id string
+		err := tx.QueryRow(ctx, `
+			insert into food_log_entries
+				(user_id, date, meal, source, food_id, barcode, food_name, brand, quantity_g, calories, protein_g, carbs_g, fat_g)
+			values
+				($1, $2::date, $3, $4, nullif($5,'')::uuid, $6, $7, $8, nullif($9, 0), $10, $11, $12, $13)
+			returning id::text
+		`,
+			userID,
+			date.Format("2006-01-02"),
+			e.Meal,
+			e.Source,
+			derefStr(e.FoodID),
+			e.Barcode,
+			e.FoodName,
+			e.Brand,
+			e.QuantityG,
+			e.Calories,
+			e.ProteinG,
+			e.CarbsG,
+			e.FatG,
+		).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *RepoPostgres) CreateSavedMeal(ctx context.Context, userID, name string, items []SavedMealItem) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		insert into saved_meals (user_id, name)
+		values ($1, $2)
+		returning id::text
+	`, userID, name).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	for i, it := range items {
+		_, err := tx.Exec(ctx, `
+			insert into saved_meal_items
+				(saved_meal_id, position, source, food_id, barcode, food_name, brand, quantity_g,
+				 calories, protein_g, carbs_g, fat_g)
+			values
+				($1::uuid, $2, $3, nullif($4,'')::uuid, $5, $6, $7, nullif($8, 0),
+				 $9, $10, $11, $12)
+		`, id, i, string(it.Source), derefStr(it.FoodID), it.Barcode, it.Name, it.Brand, it.QuantityG,
+			it.Calories, it.ProteinG, it.CarbsG, it.FatG)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (r *RepoPostgres) DeleteSavedMeal(ctx context.Context, userID, id string) error {
+	tag, err := r.db.Exec(ctx, `
+		delete from saved_meals
+		where id = $1::uuid and user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errSavedMealNotFound
+	}
+	return nil
+}
+
+// ListSavedMeals returns the user's saved meals with items; pass id to fetch one.
+func (r *RepoPostgres) ListSavedMeals(ctx context.Context, userID string, id *string) ([]SavedMeal, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			m.id::text,
+			m.name,
+			i.source,
+			i.food_id::text,
+			i.barcode,
+			i.food_name,
+			i.brand,
+			coalesce(i.quantity_g, 0),
+			i.calories,
+			i.protein_g::float8,
+			i.carbs_g::float8,
+			i.fat_g::float8
+		from saved_meals m
+		join saved_meal_items i on i.saved_meal_id = m.id
+		where m.user_id = $1 and ($2::uuid is null or m.id = $2::uuid)
+		order by lower(m.name), m.id, i.position
+	`, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SavedMeal
+	for rows.Next() {
+		var mealID, name, source string
+		var it SavedMealItem
+		if err := rows.Scan(&mealID, &name, &source, &it.FoodID, &it.Barcode, &it.Name, &it.Brand, &it.QuantityG,
+			&it.Calories, &it.ProteinG, &it.CarbsG, &it.FatG); err != nil {
+			return nil, err
+		}
+		it.Source = foods.FoodSource(source)
+
+		if n := len(out); n == 0 || out[n-1].ID != mealID {
+			out = append(out, SavedMeal{ID: mealID, Name: name})
+		}
+		out[len(out)-1].Items = append(out[len(out)-1].Items, it)
+	}
+	return out, rows.Err()
+}
+
+func (r *RepoPostgres) ListEntriesForMeal(ctx context.Context, userID string, date time.Time, meal string) ([]entryRow, error) {
+	all, err := r.ListEntriesForDate(ctx, userID, date)
+	if err != nil {
+		return nil, err
+	}
+	var out []entryRow
+	for _, e := range all {
+		if e.Meal == meal {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,202 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type syncEntryRow struct {
+	entryRow
+	Date      string
+	Version   int64
+	UpdatedAt time.Time
+	Deleted   bool
+}
+
+// EntriesChangedSince lists entries with version > since, tombstones
+// included, oldest change first. since < 0 is an initial sync: live rows only.
+func (r *RepoPostgres) EntriesChangedSince(ctx context.Context, userID string, since int64, limit int) ([]syncEntryRow, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			id::text,
+			created_at,
+			meal,
+			source,
+			food_id::text,
+			barcode,
+			food_name,
+			brand,
+			coalesce(quantity_g, 0),
+			calories,
+			protein_g::float8,
+			carbs_g::float8,
+			fat_g::float8,
+			to_char(date, 'YYYY-MM-DD'),
+			version,
+			updated_at,
+			deleted_at is not null
+		from food_log_entries
+		where user_id = $1
+		  and version > $2
+		  and ($2 >= 0 or deleted_at is null)
+		order by version asc
+		limit $3
+	`, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []syncEntryRow
+	for rows.Next() {
+		var e syncEntryRow
+		if err := rows.Scan(
+			&e.ID,
+			&e.CreatedAt,
+			&e.Meal,
+			&e.Source,
+			&e.FoodID,
+			&e.Barcode,
+			&e.FoodName,
+			&e.Brand,
+			&e.QuantityG,
+			&e.Calories,
+			&e.ProteinG,
+			&e.CarbsG,
+			&e.FatG,
+			&e.Date,
+			&e.Version,
+			&e.UpdatedAt,
+			&e.Deleted,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+type entryState struct {
+	Found   bool
+	UserID  string
+	Version int64
+	Deleted bool
+	Date    string
+}
+
+// EntryState looks an entry up by id regardless of owner, so sync can tell a
+// new client id from one that's already taken.
+func (r *RepoPostgres) EntryState(ctx context.Context, id string) (entryState, error) {
+	var st entryState
+	err := r.db.QueryRow(ctx, `
+		select user_id::text, version, deleted_at is not null, to_char(date, 'YYYY-MM-DD')
+		from food_log_entries
+		where id = $1::uuid
+	`, id).Scan(&st.UserID, &st.Version, &st.Deleted, &st.Date)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entryState{}, nil
+	}
+	if err != nil {
+		return entryState{}, err
+	}
+	st.Found = true
+	return st, nil
+}
+
+// InsertEntryWithID creates an entry under a client-generated id. It reports
+// false when the id already exists.
+func (r *RepoPostgres) InsertEntryWithID(ctx context.Context, userID, id string, date, createdAt time.Time, e entryRow) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		insert into food_log_entries
+			(id, user_id, date, meal, source, food_id, barcode, food_name, brand, quantity_g,
+			 calories, protein_g, carbs_g, fat_g, created_at)
+		values
+			($1::uuid, $2, $3::date, $4, $5, nullif($6,'')::uuid, $7, $8, $9, nullif($10, 0),
+			 $11, $12, $13, $14, $15)
+		on conflict (id) do nothing
+	`,
+		id,
+		userID,
+		date.Format("2006-01-02"),
+		e.Meal,
+		e.Source,
+		derefStr(e.FoodID),
+		e.Barcode,
+		e.FoodName,
+		e.Brand,
+		e.QuantityG,
+		e.Calories,
+		e.ProteinG,
+		e.CarbsG,
+		e.FatG,
+		createdAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateEntry replaces a live entry's contents if it is still at baseVersion.
+func (r *RepoPostgres) UpdateEntry(ctx context.Context, userID, id string, baseVersion int64, date time.Time, e entryRow) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		update food_log_entries
+		set
+			date       = $4::date,
+			meal       = $5,
+			source     = $6,
+			food_id    = nullif($7,'')::uuid,
+			barcode    = $8,
+			food_name  = $9,
+			brand      = $10,
+			quantity_g = nullif($11, 0),
+			calories   = $12,
+			protein_g  = $13,
+			carbs_g    = $14,
+			fat_g      = $15
+		where id = $1::uuid and user_id = $2 and version = $3 and deleted_at is null
+	`,
+		id,
+		userID,
+		baseVersion,
+		date.Format("2006-01-02"),
+		e.Meal,
+		e.Source,
+		derefStr(e.FoodID),
+		e.Barcode,
+		e.FoodName,
+		e.Brand,
+		e.QuantityG,
+		e.Calories,
+		e.ProteinG,
+		e.CarbsG,
+		e.FatG,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SoftDeleteEntry tombstones a live entry and returns its date.
+// baseVersion < 0 skips the version check.
+func (r *RepoPostgres) SoftDeleteEntry(ctx context.Context, userID, id string, baseVersion int64) (string, bool, error) {
+	var date string
+	err := r.db.QueryRow(ctx, `
+		update food_log_entries
+		set deleted_at = now()
+		where id = $1::uuid and user_id = $2 and deleted_at is null
+		  and ($3::bigint < 0 or version = $3)
+		returning to_char(date, 'YYYY-MM-DD')
+	`, id, userID, baseVersion).Scan(&date)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return date, true, nil
+}
@@ -0,0 +1,237 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
+)
+
+const maxSavedMealItems = 50
+
+func (s *Service) ListSavedMeals(ctx context.Context, userID string) (SavedMealListResponse, error) {
+	if userID == "" {
+		return SavedMealListResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	items, err := s.repo.ListSavedMeals(ctx, userID, nil)
+	if err != nil {
+		return SavedMealListResponse{}, apperr.Internal("failed to load saved meals")
+	}
+	if items == nil {
+		items = []SavedMeal{}
+	}
+	return SavedMealListResponse{Items: items}, nil
+}
+
+func (s *Service) SavedMeal(ctx context.Context, userID, id string) (SavedMeal, error) {
+	if userID == "" {
+		return SavedMeal{}, apperr.Unauthorized("unauthorized")
+	}
+	items, err := s.repo.ListSavedMeals(ctx, userID, &id)
+	if err != nil || len(items) == 0 {
+		return SavedMeal{}, errSavedMealNotFound
+	}
+	return items[0], nil
+}
+
+// CreateSavedMeal resolves each item once up front so bad foods are rejected
+// at save time and the template carries display names. Quick items are stored
+// as typed, like the quick entries SaveMealFromDay copies.
+func (s *Service) CreateSavedMeal(ctx context.Context, userID string, req CreateSavedMealRequest) (SavedMeal, error) {
+	if userID == "" {
+		return SavedMeal{}, apperr.Unauthorized("unauthorized")
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxSavedMealItems {
+		return SavedMeal{}, apperr.Invalid("items required")
+	}
+
+	var v validate.Errors
+	for i, in := range req.Items {
+		var item validate.Errors
+		checkEntry(&item, in.entryRequest())
+		v.Merge(fmt.Sprintf("items[%d].", i), &item)
+	}
+	if err := v.Err(); err != nil {
+		return SavedMeal{}, err
+	}
+
+	items := make([]SavedMealItem, 0, len(req.Items))
+	for _, in := range req.Items {
+		if in.Source == foods.FoodSourceQuick {
+			items = append(items, savedItemFromEntry(quickEntry(in.entryRequest())))
+			continue
+		}
+		e, err := s.resolveEntry(ctx, userID, in.Source, in.FoodID, in.Barcode, in.QuantityG)
+		if err != nil {
+			return SavedMeal{}, err
+		}
+		items = append(items, savedItemFromEntry(e))
+	}
+	return s.createSavedMeal(ctx, userID, req.Name, items)
+}
+
+func (in SavedMealItemInput) entryRequest() CreateEntryRequest {
+	return CreateEntryRequest{
+		Source:    in.Source,
+		FoodID:    in.FoodID,
+		Barcode:   in.Barcode,
+		QuantityG: in.QuantityG,
+		Label:     in.Label,
+		Calories:  in.Calories,
+		ProteinG:  in.ProteinG,
+		CarbsG:    in.CarbsG,
+		FatG:      in.FatG,
+	}
+}
+
+// SaveMealFromDay creates a template from the entries of one meal on one day.
+func (s *Service) SaveMealFromDay(ctx context.Context, userID string, req SaveMealFromDayRequest) (SavedMeal, error) {
+	if userID == "" {
+		return SavedMeal{}, apperr.Unauthorized("unauthorized")
+	}
+	day, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return SavedMeal{}, apperr.InvalidField("date", "invalid date")
+	}
+
+	rows, err := s.repo.ListEntriesForMeal(ctx, userID, day, string(req.Meal))
+	if err != nil {
+		return SavedMeal{}, apperr.Internal("failed to load entries")
+	}
+	if len(rows) == 0 {
+		return SavedMeal{}, apperr.Invalid("meal has no entries")
+	}
+	if len(rows) > maxSavedMealItems {
+		return SavedMeal{}, apperr.Invalid("too many entries")
+	}
+
+	items := make([]SavedMealItem, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, savedItemFromEntry(r))
+	}
+	return s.createSavedMeal(ctx, userID, req.Name, items)
+}
+
+func (s *Service) DeleteSavedMeal(ctx context.Context, userID, id string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	if err := s.repo.DeleteSavedMeal(ctx, userID, id); err != nil {
+		if errors.Is(err, errSavedMealNotFound) {
+			return err
+		}
+		return apperr.Internal("failed to delete saved meal")
+	}
+	return nil
+}
+
+// LogSavedMeal creates one entry per template item in the given meal slot and
+// date. Foods are re-resolved now, so the snapshots reflect current food data.
+func (s *Service) LogSavedMeal(ctx context.Context, userID, id string, req LogSavedMealRequest) ([]string, error) {
+	if userID == "" {
+		return nil, apperr.Unauthorized("unauthorized")
+	}
+	if ok, err := s.validMeal(ctx, userID, req.Meal); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, apperr.InvalidField("meal", "invalid meal")
+	}
+
+	day, err := s.parseDayOrToday(userID, req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := s.SavedMeal(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entryRow, 0, len(tpl.Items))
+	for _, it := range tpl.Items {
+		if it.Source == foods.FoodSourceQuick {
+			entries = append(entries, entryRow{
+				Meal:     string(req.Meal),
+				Source:   string(it.Source),
+				FoodName: it.Name,
+				Calories: derefInt(it.Calories),
+				ProteinG: safeNum(it.ProteinG),
+				CarbsG:   safeNum(it.CarbsG),
+				FatG:     safeNum(it.FatG),
+			})
+			continue
+		}
+
+		e, err := s.resolveEntry(ctx, userID, it.Source, it.FoodID, it.Barcode, it.QuantityG)
+		if err != nil {
+			return nil, apperr.NotFound("food not found: " + it.Name)
+		}
+		e.Meal = string(req.Meal)
+		entries = append(entries, e)
+	}
+
+	ids, err := s.repo.InsertEntries(ctx, userID, day, entries)
+	if err != nil {
+		return nil, apperr.Internal("failed to create entries")
+	}
+
+	date := day.Format("2006-01-02")
+	s.publishEntries(ctx, userID, events.EntryCreated, date, entryEvents(ids, entries, date))
+	return ids, nil
+}
+
+func (s *Service) createSavedMeal(ctx context.Context, userID, name string, items []SavedMealItem) (SavedMeal, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 200 {
+		return SavedMeal{}, apperr.InvalidField("name", "invalid name")
+	}
+	id, err := s.repo.CreateSavedMeal(ctx, userID, name, items)
+	if err != nil {
+		return SavedMeal{}, apperr.Internal("failed to create saved meal")
+	}
+	return s.SavedMeal(ctx, userID, id)
+}
+
+// parseDayOrToday parses an optional YYYY-MM-DD, defaulting to today in the
+// user's timezone.
+func (s *Service) parseDayOrToday(userID string, date *string) (time.Time, error) {
+	loc := s.location(userID)
+	if date == nil || strings.TrimSpace(*date) == "" {
+		now := time.Now().In(loc)
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc), nil
+	}
+	d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(*date), loc)
+	if err != nil {
+		return time.Time{}, apperr.InvalidField("date", "invalid date")
+	}
+	return d, nil
+}
+
+func savedItemFromEntry(e entryRow) SavedMealItem {
+	it := SavedMealItem{
+		Source:    foods.FoodSource(e.Source),
+		FoodID:    e.FoodID,
+		Barcode:   e.Barcode,
+		Name:      e.FoodName,
+		Brand:     e.Brand,
+		QuantityG: e.QuantityG,
+	}
+	if it.Source == foods.FoodSourceQuick {
+		cal, p, c, f := e.Calories, e.ProteinG, e.CarbsG, e.FatG
+		it.Calories, it.ProteinG, it.CarbsG, it.FatG = &cal, &p, &c, &f
+	}
+	return it
+}
+
+func derefInt(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -2,82 +2,139 @@ package logs
 
 import (
 	"context"
-	"errors"
 	"math"
+	"strings"
 	"time"
 
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
 	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/goals"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
 )
 
+// Range summaries are one row per day; a year is plenty for any chart.
+const maxRangeDays = 366
+
 type Service struct {
-	repo    *RepoPostgres
-	foods   *foods.Service
-	authSvc *auth.Service
+	repo     *RepoPostgres
+	foods    *foods.Service
+	authSvc  *auth.Service
+	goalsSvc *goals.Service
+	events   *events.Bus
 }
 
-func NewService(repo *RepoPostgres, foodsSvc *foods.Service, authSvc *auth.Service) *Service {
-	return &Service{repo: repo, foods: foodsSvc, authSvc: authSvc}
+func NewService(repo *RepoPostgres, foodsSvc *foods.Service, authSvc *auth.Service, goalsSvc *goals.Service, bus *events.Bus) *Service {
+	return &Service{repo: repo, foods: foodsSvc, authSvc: authSvc, goalsSvc: goalsSvc, events: bus}
 }
 
 func (s *Service) Today(ctx context.Context, userID string) (TodayResponse, error) {
 	if userID == "" {
-		return TodayResponse{}, errors.New("unauthorized")
+		return TodayResponse{}, apperr.Unauthorized("unauthorized")
 	}
 
-	// Defaults (privacy-first baseline)
-	tz := "UTC"
-	calGoal := 2000
-	pGoal := 150
-	cGoal := 200
-	fGoal := 70
+	loc := s.location(userID)
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
 
-	// Try to load settings. If it fails for any reason, we still render Today.
-	if s.authSvc != nil {
-		if settings, err := s.authSvc.GetSettings(userID); err == nil {
-			if settings.Timezone != "" {
-				tz = settings.Timezone
-			}
-			if settings.CalorieGoal > 0 {
-				calGoal = settings.CalorieGoal
-			}
-			if settings.ProteinGoalG > 0 {
-				pGoal = settings.ProteinGoalG
-			}
-			if settings.CarbsGoalG > 0 {
-				cGoal = settings.CarbsGoalG
-			}
-			if settings.FatGoalG > 0 {
-				fGoal = settings.FatGoalG
-			}
-		}
+	return s.dayView(ctx, userID, day, loc)
+}
+
+// Day renders the same view as Today for an arbitrary date (YYYY-MM-DD),
+// judged against the goals that were in effect on that date.
+func (s *Service) Day(ctx context.Context, userID string, date string) (TodayResponse, error) {
+	if userID == "" {
+		return TodayResponse{}, apperr.Unauthorized("unauthorized")
 	}
 
-	loc, err := time.LoadLocation(tz)
+	loc := s.location(userID)
+	d, err := time.ParseInLocation("2006-01-02", date, loc)
 	if err != nil {
-		loc = time.UTC
+		return TodayResponse{}, apperr.InvalidField("date", "invalid date")
 	}
 
-	now := time.Now().In(loc)
-	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	return s.dayView(ctx, userID, d, loc)
+}
+
+// Summary returns per-day totals and goals for every date in [from, to],
+// including days with nothing logged.
+func (s *Service) Summary(ctx context.Context, userID string, from, to string) (RangeSummaryResponse, error) {
+	if userID == "" {
+		return RangeSummaryResponse{}, apperr.Unauthorized("unauthorized")
+	}
+
+	fromDay, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return RangeSummaryResponse{}, apperr.InvalidField("from", "invalid from")
+	}
+	toDay, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return RangeSummaryResponse{}, apperr.InvalidField("to", "invalid to")
+	}
+	if toDay.Before(fromDay) {
+		return RangeSummaryResponse{}, apperr.Invalid("to before from")
+	}
+	if toDay.Sub(fromDay) > maxRangeDays*24*time.Hour {
+		return RangeSummaryResponse{}, apperr.Invalid("range too large")
+	}
+
+	totals, err := s.repo.DailyTotals(ctx, userID, fromDay, toDay)
+	if err != nil {
+		return RangeSummaryResponse{}, apperr.Internal("failed to load entries")
+	}
+	byDate := make(map[string]DayIntake, len(totals))
+	for _, t := range totals {
+		byDate[t.Date] = t
+	}
+
+	resolver, err := s.goalResolver(ctx, userID, fromDay, toDay)
+	if err != nil {
+		return RangeSummaryResponse{}, err
+	}
 
+	resp := RangeSummaryResponse{From: from, To: to}
+	for d := fromDay; !d.After(toDay); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		t := byDate[key]
+		resp.Days = append(resp.Days, DaySummary{
+			Date: key,
+			Summary: newSummary(goalsAt(resolver, key), MacroTotals{
+				Calories: t.Calories,
+				ProteinG: t.ProteinG,
+				CarbsG:   t.CarbsG,
+				FatG:     t.FatG,
+			}),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Service) dayView(ctx context.Context, userID string, day time.Time, loc *time.Location) (TodayResponse, error) {
 	rows, err := s.repo.ListEntriesForDate(ctx, userID, day)
 	if err != nil {
-		return TodayResponse{}, errors.New("failed to load entries")
+		return TodayResponse{}, apperr.Internal("failed to load entries")
 	}
 
-	meals := []TodayMeal{
-		{Meal: MealBreakfast},
-		{Meal: MealLunch},
-		{Meal: MealDinner},
-		{Meal: MealSnacks},
+	slots, err := s.mealSlots(ctx, userID)
+	if err != nil {
+		return TodayResponse{}, err
 	}
 
-	mealIndex := map[Meal]int{
-		MealBreakfast: 0,
-		MealLunch:     1,
-		MealDinner:    2,
-		MealSnacks:    3,
+	// Archived slots only show up on days that still have entries in them.
+	hasEntries := make(map[string]bool)
+	for _, r := range rows {
+		hasEntries[r.Meal] = true
+	}
+
+	meals := make([]TodayMeal, 0, len(slots))
+	mealIndex := make(map[Meal]int, len(slots))
+	for _, sl := range slots {
+		if sl.Archived && !hasEntries[sl.Key] {
+			continue
+		}
+		mealIndex[Meal(sl.Key)] = len(meals)
+		meals = append(meals, TodayMeal{Meal: Meal(sl.Key), Label: sl.Label})
 	}
 
 	var total MacroTotals
@@ -129,150 +186,305 @@ func (s *Service) Today(ctx context.Context, userID string) (TodayResponse, erro
 	recentRows, _ := s.repo.ListRecentFoods(ctx, userID, 12)
 	recent := make([]RecentFood, 0, len(recentRows))
 	for _, r := range recentRows {
-		item := RecentFood{
-			Source: foods.FoodSource(r.Source),
-			FoodID: r.FoodID,
-			Barcode: func() *string {
-				if r.Barcode == nil {
-					return nil
-				}
-				b := *r.Barcode
-				return &b
-			}(),
-			Name:  r.FoodName,
-			Brand: r.Brand,
-		}
-		item.Per100g.Calories = per100Int(r.Calories, r.QuantityG)
-		item.Per100g.ProteinG = per100Float(r.ProteinG, r.QuantityG)
-		item.Per100g.CarbsG = per100Float(r.CarbsG, r.QuantityG)
-		item.Per100g.FatG = per100Float(r.FatG, r.QuantityG)
-		recent = append(recent, item)
+		recent = append(recent, recentFoodFromRow(r))
 	}
 
+	resolver, err := s.goalResolver(ctx, userID, day, day)
+	if err != nil {
+		return TodayResponse{}, err
+	}
+
+	date := day.Format("2006-01-02")
 	resp := TodayResponse{
-		Date:        day.Format("2006-01-02"),
+		Date:        date,
+		Summary:     newSummary(goalsAt(resolver, date), total),
 		Meals:       meals,
 		RecentFoods: recent,
 	}
 
-	resp.Summary.CalorieGoal = calGoal
-	resp.Summary.CaloriesConsumed = total.Calories
-	resp.Summary.MacrosGoal.ProteinG = pGoal
-	resp.Summary.MacrosGoal.CarbsG = cGoal
-	resp.Summary.MacrosGoal.FatG = fGoal
-	resp.Summary.MacrosConsumed.ProteinG = total.ProteinG
-	resp.Summary.MacrosConsumed.CarbsG = total.CarbsG
-	resp.Summary.MacrosConsumed.FatG = total.FatG
-
 	return resp, nil
 }
 
 func (s *Service) CreateEntry(ctx context.Context, userID string, req CreateEntryRequest) (string, error) {
 	if userID == "" {
-		return "", errors.New("unauthorized")
+		return "", apperr.Unauthorized("unauthorized")
 	}
-	if req.QuantityG <= 0 || req.QuantityG > 5000 {
-		return "", errors.New("quantity out of range")
+	var v validate.Errors
+	if ok, err := s.validMeal(ctx, userID, req.Meal); err != nil {
+		return "", err
+	} else if !ok {
+		v.Add("meal", "invalid meal")
 	}
-	if req.Meal != MealBreakfast && req.Meal != MealLunch && req.Meal != MealDinner && req.Meal != MealSnacks {
-		return "", errors.New("invalid meal")
+	checkEntry(&v, req)
+	if err := v.Err(); err != nil {
+		return "", err
 	}
 
-	// Same default timezone logic as Today()
-	tz := "UTC"
-	if s.authSvc != nil {
-		if settings, err := s.authSvc.GetSettings(userID); err == nil && settings.Timezone != "" {
-			tz = settings.Timezone
+	loc := s.location(userID)
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	var e entryRow
+	if req.Source == foods.FoodSourceQuick {
+		e = quickEntry(req)
+	} else {
+		var err error
+		if e, err = s.resolveEntry(ctx, userID, req.Source, req.FoodID, req.Barcode, req.QuantityG); err != nil {
+			return "", err
 		}
 	}
-	loc, err := time.LoadLocation(tz)
+	e.Meal = string(req.Meal)
+
+	id, err := s.repo.InsertEntry(
+		ctx,
+		userID,
+		day,
+		e.Meal,
+		e.Source,
+		e.FoodID,
+		e.Barcode,
+		e.FoodName,
+		e.Brand,
+		e.QuantityG,
+		e.Calories,
+		e.ProteinG,
+		e.CarbsG,
+		e.FatG,
+	)
 	if err != nil {
-		loc = time.UTC
+		return "", apperr.Internal("failed to create entry")
 	}
-	now := time.Now().In(loc)
-	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
 
+	date := day.Format("2006-01-02")
+	s.publishEntries(ctx, userID, events.EntryCreated, date, []EntryEvent{{ID: id, Date: date, Meal: req.Meal}})
+	return id, nil
+}
+
+// checkEntry validates what CreateEntry can check without a lookup, so the
+// client sees every bad field at once. Whether the food exists comes later.
+func checkEntry(v *validate.Errors, req CreateEntryRequest) {
+	switch req.Source {
+	case foods.FoodSourceQuick:
+		if req.Label == nil {
+			v.Add("label", "label is required for quick entries")
+		} else {
+			v.Required("label", *req.Label)
+			v.MaxLen("label", strings.TrimSpace(*req.Label), 200)
+		}
+		if req.Calories == nil {
+			v.Add("calories", "calories is required for quick entries")
+		}
+		validate.RangePtr(v, "calories", req.Calories, 0, 10000)
+		validate.RangePtr(v, "protein_g", req.ProteinG, 0, 1000)
+		validate.RangePtr(v, "carbs_g", req.CarbsG, 0, 1000)
+		validate.RangePtr(v, "fat_g", req.FatG, 0, 1000)
+		return
+
+	case foods.FoodSourceOFF:
+		code := strings.TrimSpace(derefStr(req.Barcode))
+		if code == "" {
+			code = strings.TrimSpace(derefStr(req.FoodID))
+		}
+		if code == "" {
+			v.Add("barcode", "barcode is required for off entries")
+		} else if !validate.IsBarcodeLookup(code) {
+			v.Add("barcode", "barcode must be 4-14 digits")
+		}
+
+	case foods.FoodSourceCustom, foods.FoodSourceRecipe:
+		if id := strings.TrimSpace(derefStr(req.FoodID)); id == "" {
+			v.Add("foodId", "foodId is required for "+string(req.Source)+" entries")
+		} else if !uuidRe.MatchString(id) {
+			v.Add("foodId", "foodId must be a UUID")
+		}
+
+	default:
+		v.Add("source", "source must be off, custom, recipe or quick")
+		return
+	}
+	v.Range("quantity_g", float64(req.QuantityG), 1, 5000)
+}
+
+// quickEntry builds a snapshot straight from user-entered values.
+// req must have passed checkEntry.
+func quickEntry(req CreateEntryRequest) entryRow {
+	return entryRow{
+		Source:   string(foods.FoodSourceQuick),
+		FoodName: strings.TrimSpace(derefStr(req.Label)),
+		Calories: derefInt(req.Calories),
+		ProteinG: safeNum(req.ProteinG),
+		CarbsG:   safeNum(req.CarbsG),
+		FatG:     safeNum(req.FatG),
+	}
+}
+
+// foodLookupErr reports a missing food as such and passes anything else
+// (a failed query, say) through unchanged.
+func foodLookupErr(err error) error {
+	if foods.IsNotFound(err) {
+		return apperr.NotFound("food not found")
+	}
+	return err
+}
+
+// resolveEntry looks the food up and computes the snapshot values for qtyG grams.
+// Meal is left for the caller to fill in. User input must have passed
+// checkEntry; stored rows are trusted.
+func (s *Service) resolveEntry(ctx context.Context, userID string, source foods.FoodSource, foodID, barcode *string, qtyG int) (entryRow, error) {
 	// Resolve food
 	var dto *foods.FoodDTO
-	switch req.Source {
+	switch source {
 	case foods.FoodSourceOFF:
 		// Accept barcode explicitly, but also allow foodId to act as barcode
 		// so name-search selection works without the barcode field.
-		var code string
-		if req.Barcode != nil && *req.Barcode != "" {
-			code = *req.Barcode
-		} else if req.FoodID != nil && *req.FoodID != "" {
-			code = *req.FoodID
-		} else {
-			return "", errors.New("barcode required for off")
+		code := derefStr(barcode)
+		if code == "" {
+			code = derefStr(foodID)
 		}
 
 		// IMPORTANT: persist identifier in `barcode` column.
 		// food_id column is UUID and must remain null for OFF entries.
-		req.Barcode = &code
-		req.FoodID = nil
+		barcode = &code
+		foodID = nil
 
-		dto, err = s.foods.ByBarcode(ctx, code)
-		if err != nil || dto == nil {
-			return "", errors.New("food not found")
+		d, err := s.foods.ByBarcode(ctx, code)
+		if err != nil || d == nil {
+			return entryRow{}, apperr.NotFound("food not found")
 		}
+		dto = d
 
 	case foods.FoodSourceCustom:
-		if req.FoodID == nil || *req.FoodID == "" {
-			return "", errors.New("foodId required for custom")
+		d, err := s.foods.ByCustomID(ctx, derefStr(foodID))
+		if err != nil {
+			return entryRow{}, foodLookupErr(err)
 		}
-		d, err2 := s.foods.ByCustomID(ctx, *req.FoodID)
-		if err2 != nil {
-			return "", errors.New("food not found")
+		dto = &d
+		barcode = nil
+
+	case foods.FoodSourceRecipe:
+		d, err := s.foods.ByRecipeID(ctx, userID, derefStr(foodID))
+		if err != nil {
+			return entryRow{}, foodLookupErr(err)
 		}
 		dto = &d
+		barcode = nil
+
 	default:
-		return "", errors.New("invalid source")
+		return entryRow{}, apperr.InvalidField("source", "invalid source")
 	}
 
 	// Compute snapshot (per-100g -> quantity)
-	kcal100 := safeNum(dto.KcalPer100g)
-	p100 := safeNum(dto.ProteinPer100g)
-	c100 := safeNum(dto.CarbsPer100g)
-	f100 := safeNum(dto.FatPer100g)
-
-	mult := float64(req.QuantityG) / 100.0
-	cal := int(math.Round(kcal100 * mult))
-	p := p100 * mult
-	ca := c100 * mult
-	fa := f100 * mult
-
-	foodName := dto.Name
-	brand := dto.Brand
-	var foodID *string
-	var barcode *string
-
-	if req.Source == foods.FoodSourceCustom {
-		foodID = req.FoodID
-	} else {
-		barcode = req.Barcode
+	mult := float64(qtyG) / 100.0
+	return entryRow{
+		Source:    string(source),
+		FoodID:    foodID,
+		Barcode:   barcode,
+		FoodName:  dto.Name,
+		Brand:     dto.Brand,
+		QuantityG: qtyG,
+		Calories:  int(math.Round(safeNum(dto.KcalPer100g) * mult)),
+		ProteinG:  safeNum(dto.ProteinPer100g) * mult,
+		CarbsG:    safeNum(dto.CarbsPer100g) * mult,
+		FatG:      safeNum(dto.FatPer100g) * mult,
+	}, nil
+}
+
+// DailyIntake returns per-day totals for days in [from, to] that have at least one entry.
+func (s *Service) DailyIntake(ctx context.Context, userID string, from, to time.Time) ([]DayIntake, error) {
+	if userID == "" {
+		return nil, apperr.Unauthorized("unauthorized")
+	}
+	out, err := s.repo.DailyTotals(ctx, userID, from, to)
+	if err != nil {
+		return nil, apperr.Internal("failed to load intake")
 	}
+	return out, nil
+}
 
-	id, err := s.repo.InsertEntry(
-		ctx,
-		userID,
-		day,
-		string(req.Meal),
-		string(req.Source),
-		foodID,
-		barcode,
-		foodName,
-		brand,
-		req.QuantityG,
-		cal,
-		p,
-		ca,
-		fa,
-	)
+// location is the user's configured timezone, falling back to UTC.
+func (s *Service) location(userID string) *time.Location {
+	tz := "UTC"
+	if s.authSvc != nil {
+		if settings, err := s.authSvc.GetSettings(userID); err == nil && settings.Timezone != "" {
+			tz = settings.Timezone
+		}
+	}
+	loc, err := time.LoadLocation(tz)
 	if err != nil {
-		return "", errors.New("failed to create entry")
+		return time.UTC
 	}
-	return id, nil
+	return loc
+}
+
+// goalResolver loads the user's goals for [from, to]. Without a goals
+// service every date resolves to the defaults; a failed load is an error,
+// not a silent fall back to them.
+func (s *Service) goalResolver(ctx context.Context, userID string, from, to time.Time) (goals.Resolver, error) {
+	if s.goalsSvc == nil {
+		return goals.Resolver{}, nil
+	}
+	return s.goalsSvc.Resolver(ctx, userID, from, to)
+}
+
+// goalsAt resolves the goals for date, with the privacy-first defaults for
+// anything missing or unset.
+func goalsAt(r goals.Resolver, date string) goals.Resolved {
+	g := goals.Resolved{CalorieGoal: 2000, ProteinGoalG: 150, CarbsGoalG: 200, FatGoalG: 70}
+	v, ok := r.At(date)
+	if !ok {
+		return g
+	}
+	g.ProfileID = v.ProfileID
+	g.ProfileName = v.ProfileName
+	if v.CalorieGoal > 0 {
+		g.CalorieGoal = v.CalorieGoal
+	}
+	if v.ProteinGoalG > 0 {
+		g.ProteinGoalG = v.ProteinGoalG
+	}
+	if v.CarbsGoalG > 0 {
+		g.CarbsGoalG = v.CarbsGoalG
+	}
+	if v.FatGoalG > 0 {
+		g.FatGoalG = v.FatGoalG
+	}
+	return g
+}
+
+func newSummary(g goals.Resolved, total MacroTotals) TodaySummary {
+	var sum TodaySummary
+	sum.GoalProfile = g.ProfileName
+	sum.CalorieGoal = g.CalorieGoal
+	sum.CaloriesConsumed = total.Calories
+	sum.MacrosGoal.ProteinG = g.ProteinGoalG
+	sum.MacrosGoal.CarbsG = g.CarbsGoalG
+	sum.MacrosGoal.FatG = g.FatGoalG
+	sum.MacrosConsumed.ProteinG = total.ProteinG
+	sum.MacrosConsumed.CarbsG = total.CarbsG
+	sum.MacrosConsumed.FatG = total.FatG
+	return sum
+}
+
+// recentFoodFromRow derives a per-100g view from an entry snapshot.
+func recentFoodFromRow(r entryRow) RecentFood {
+	item := RecentFood{
+		Source: foods.FoodSource(r.Source),
+		FoodID: r.FoodID,
+		Barcode: func() *string {
+			if r.Barcode == nil {
+				return nil
+			}
+			b := *r.Barcode
+			return &b
+		}(),
+		Name:  r.FoodName,
+		Brand: r.Brand,
+	}
+	item.Per100g.Calories = per100Int(r.Calories, r.QuantityG)
+	item.Per100g.ProteinG = per100Float(r.ProteinG, r.QuantityG)
+	item.Per100g.CarbsG = per100Float(r.CarbsG, r.QuantityG)
+	item.Per100g.FatG = per100Float(r.FatG, r.QuantityG)
+	return item
 }
 
 func safeNum(p *float64) float64 {
@@ -0,0 +1,389 @@
+package logs
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/foods"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/validate"
+)
+
+const (
+	// Changes per pull page, entries and custom foods combined.
+	syncPageSize = 500
+	// Changes accepted per push.
+	maxSyncPush = 500
+
+	syncTokenPrefix = "v1:"
+)
+
+var errEntryNotFound = apperr.NotFound("entry not found")
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// SyncPull returns changes after token (empty token = full initial sync).
+func (s *Service) SyncPull(ctx context.Context, userID, token string) (SyncResponse, error) {
+	if userID == "" {
+		return SyncResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	since, err := parseSyncToken(token)
+	if err != nil {
+		return SyncResponse{}, err
+	}
+	return s.changesSince(ctx, userID, since)
+}
+
+// SyncPush applies offline changes in order (custom foods first, so entries
+// in the same batch can use them), then returns changes since req.Since.
+// Each change is reported individually; one bad change doesn't fail the batch.
+func (s *Service) SyncPush(ctx context.Context, userID string, req SyncPushRequest) (SyncPushResponse, error) {
+	if userID == "" {
+		return SyncPushResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	since, err := parseSyncToken(req.Since)
+	if err != nil {
+		return SyncPushResponse{}, err
+	}
+	if len(req.Entries)+len(req.CustomFoods) > maxSyncPush {
+		return SyncPushResponse{}, apperr.Invalid("too many changes")
+	}
+
+	results := make([]SyncResult, 0, len(req.Entries)+len(req.CustomFoods)+1)
+	for _, ch := range req.CustomFoods {
+		results = append(results, s.applyCustomFood(ctx, userID, ch))
+	}
+	for _, ch := range req.Entries {
+		results = append(results, s.applyEntry(ctx, userID, ch))
+	}
+	if req.Settings != nil {
+		results = append(results, s.applySettings(userID, *req.Settings))
+	}
+
+	changes, err := s.changesSince(ctx, userID, since)
+	if err != nil {
+		return SyncPushResponse{}, err
+	}
+	return SyncPushResponse{Results: results, SyncResponse: changes}, nil
+}
+
+// DeleteEntry soft-deletes an entry; sync clients see it as a tombstone.
+func (s *Service) DeleteEntry(ctx context.Context, userID, id string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return errEntryNotFound
+	}
+	date, ok, err := s.repo.SoftDeleteEntry(ctx, userID, id, -1)
+	if err != nil {
+		return apperr.Internal("failed to delete entry")
+	}
+	if !ok {
+		return errEntryNotFound
+	}
+
+	s.publishEntries(ctx, userID, events.EntryDeleted, date, []EntryEvent{{ID: id, Date: date}})
+	return nil
+}
+
+func (s *Service) changesSince(ctx context.Context, userID string, since int64) (SyncResponse, error) {
+	// Read the high-water mark first: anything at or below it has committed,
+	// so it's safe to hand out as the token once the pages below are drained.
+	head, settingsVersion, err := s.authSvc.SyncVersions(userID)
+	if err != nil {
+		return SyncResponse{}, err
+	}
+
+	entries, err := s.repo.EntriesChangedSince(ctx, userID, since, syncPageSize+1)
+	if err != nil {
+		return SyncResponse{}, apperr.Internal("failed to load changes")
+	}
+	custom, err := s.foods.CustomFoodsChangedSince(ctx, userID, since, syncPageSize+1)
+	if err != nil {
+		return SyncResponse{}, apperr.Internal("failed to load changes")
+	}
+
+	resp := SyncResponse{Entries: []SyncEntry{}, CustomFoods: []SyncCustomFood{}}
+	last := since
+	i, j := 0, 0
+	for n := 0; n < syncPageSize && (i < len(entries) || j < len(custom)); n++ {
+		if j >= len(custom) || (i < len(entries) && entries[i].Version < custom[j].Version) {
+			resp.Entries = append(resp.Entries, syncEntryFromRow(entries[i]))
+			last = entries[i].Version
+			i++
+		} else {
+			resp.CustomFoods = append(resp.CustomFoods, SyncCustomFood{Version: custom[j].Version, Food: custom[j].Food})
+			last = custom[j].Version
+			j++
+		}
+	}
+	resp.HasMore = i < len(entries) || j < len(custom)
+	if !resp.HasMore && head > last {
+		last = head
+	}
+	if last < 0 {
+		last = 0
+	}
+	resp.Token = formatSyncToken(last)
+
+	if settingsVersion > since {
+		settings, err := s.authSvc.GetSettings(userID)
+		if err != nil {
+			return SyncResponse{}, apperr.Internal("failed to load settings")
+		}
+		history, err := s.authSvc.GoalHistory(userID)
+		if err != nil {
+			return SyncResponse{}, err
+		}
+		resp.Settings = &SyncSettings{Version: settingsVersion, Settings: settings, Goals: history.Items}
+	}
+
+	if s.goalsSvc != nil {
+		planVersion, err := s.goalsSvc.PlanVersion(ctx, userID)
+		if err != nil {
+			return SyncResponse{}, err
+		}
+		if since == 0 || planVersion > since {
+			plan, err := s.goalsSvc.Plan(ctx, userID)
+			if err != nil {
+				return SyncResponse{}, err
+			}
+			resp.GoalPlan = &SyncGoalPlan{Version: planVersion, Plan: plan}
+		}
+	}
+	return resp, nil
+}
+
+func (s *Service) applyEntry(ctx context.Context, userID string, ch SyncEntryChange) SyncResult {
+	res := SyncResult{Kind: "entry", ID: ch.ID}
+	if !uuidRe.MatchString(ch.ID) {
+		return rejected(res, "invalid id")
+	}
+
+	cur, err := s.repo.EntryState(ctx, ch.ID)
+	if err != nil {
+		return rejected(res, "failed to apply")
+	}
+	if cur.Found && cur.UserID != userID {
+		return rejected(res, "invalid id")
+	}
+
+	switch ch.Op {
+	case SyncOpDelete:
+		// Never synced (created and deleted offline) or already gone: nothing to do.
+		if !cur.Found || cur.Deleted {
+			res.Status = SyncApplied
+			return res
+		}
+		if ch.BaseVersion != cur.Version {
+			res.Status = SyncConflict
+			return res
+		}
+		date, ok, err := s.repo.SoftDeleteEntry(ctx, userID, ch.ID, ch.BaseVersion)
+		if err != nil {
+			return rejected(res, "failed to apply")
+		}
+		if !ok {
+			res.Status = SyncConflict
+			return res
+		}
+		s.publishEntries(ctx, userID, events.EntryDeleted, date, []EntryEvent{{ID: ch.ID, Date: date}})
+
+	case SyncOpUpsert:
+		if ch.Entry == nil {
+			return rejected(res, "entry required")
+		}
+		// A create we've already applied (the client missed our response).
+		if cur.Found && ch.BaseVersion == 0 {
+			res.Status = SyncApplied
+			return res
+		}
+		if cur.Found && (cur.Deleted || ch.BaseVersion != cur.Version) {
+			res.Status = SyncConflict
+			return res
+		}
+
+		loc := s.location(userID)
+		day, err := time.ParseInLocation("2006-01-02", ch.Entry.Date, loc)
+		if err != nil {
+			return rejected(res, "invalid date")
+		}
+		if ok, err := s.validMeal(ctx, userID, ch.Entry.Meal); err != nil {
+			return rejected(res, err.Error())
+		} else if !ok {
+			return rejected(res, "invalid meal")
+		}
+
+		var v validate.Errors
+		checkEntry(&v, ch.Entry.CreateEntryRequest)
+		if err := v.Err(); err != nil {
+			return rejectedErr(res, err)
+		}
+
+		var e entryRow
+		if ch.Entry.Source == foods.FoodSourceQuick {
+			e = quickEntry(ch.Entry.CreateEntryRequest)
+		} else if e, err = s.resolveEntry(ctx, userID, ch.Entry.Source, ch.Entry.FoodID, ch.Entry.Barcode, ch.Entry.QuantityG); err != nil {
+			return rejectedErr(res, err)
+		}
+		e.Meal = string(ch.Entry.Meal)
+
+		var ok bool
+		if cur.Found {
+			ok, err = s.repo.UpdateEntry(ctx, userID, ch.ID, ch.BaseVersion, day, e)
+		} else {
+			// Keep the device's timestamp so the entry sorts where it was logged.
+			loggedAt := time.Now()
+			if ch.Entry.LoggedAt != nil && ch.Entry.LoggedAt.Before(loggedAt) {
+				loggedAt = *ch.Entry.LoggedAt
+			}
+			ok, err = s.repo.InsertEntryWithID(ctx, userID, ch.ID, day, loggedAt, e)
+		}
+		if err != nil {
+			return rejected(res, "failed to apply")
+		}
+		if !ok {
+			res.Status = SyncConflict
+			return res
+		}
+
+		date := day.Format("2006-01-02")
+		ev := []EntryEvent{{ID: ch.ID, Date: date, Meal: ch.Entry.Meal}}
+		if !cur.Found {
+			s.publishEntries(ctx, userID, events.EntryCreated, date, ev)
+		} else {
+			s.publishEntries(ctx, userID, events.EntryUpdated, date, ev)
+			// Moved to another day: that day's totals changed too.
+			if cur.Date != date {
+				s.publishDaySummary(ctx, userID, cur.Date)
+			}
+		}
+
+	default:
+		return rejected(res, "invalid op")
+	}
+
+	res.Status = SyncApplied
+	return res
+}
+
+func (s *Service) applyCustomFood(ctx context.Context, userID string, ch SyncCustomFoodChange) SyncResult {
+	res := SyncResult{Kind: "customFood", ID: ch.ID}
+	if !uuidRe.MatchString(ch.ID) {
+		return rejected(res, "invalid id")
+	}
+
+	exists, owned, err := s.foods.CustomFoodOwnedBy(ctx, ch.ID, userID)
+	if err != nil {
+		return rejected(res, "failed to apply")
+	}
+	if exists {
+		if !owned {
+			return rejected(res, "invalid id")
+		}
+		// Already created by an earlier push.
+		res.Status = SyncApplied
+		return res
+	}
+
+	req := ch.Food
+	req.ID = &ch.ID
+	if _, err := s.foods.CreateCustom(ctx, userID, req); err != nil {
+		return rejectedErr(res, err)
+	}
+	res.Status = SyncApplied
+	return res
+}
+
+// applySettings is last-writer-wins only if the client saw the latest
+// settings; otherwise the server copy stands and the client must rebase.
+func (s *Service) applySettings(userID string, ch SyncSettingsChange) SyncResult {
+	res := SyncResult{Kind: "settings"}
+
+	if _, err := s.authSvc.UpdateSettingsAt(userID, ch.Patch, ch.BaseVersion); err != nil {
+		if errors.Is(err, auth.ErrSettingsChanged) {
+			res.Status = SyncConflict
+			return res
+		}
+		return rejectedErr(res, err)
+	}
+	res.Status = SyncApplied
+	return res
+}
+
+func rejected(res SyncResult, msg string) SyncResult {
+	res.Status = SyncRejected
+	res.Error = msg
+	return res
+}
+
+// rejectedErr reports a service error, keeping its per-field messages.
+func rejectedErr(res SyncResult, err error) SyncResult {
+	res = rejected(res, err.Error())
+	if ae, ok := apperr.As(err); ok {
+		res.Fields = ae.Fields
+	}
+	return res
+}
+
+func syncEntryFromRow(r syncEntryRow) SyncEntry {
+	out := SyncEntry{
+		ID:        r.ID,
+		Version:   r.Version,
+		Deleted:   r.Deleted,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if r.Deleted {
+		return out
+	}
+
+	loggedAt := r.CreatedAt
+	out.Date = r.Date
+	out.Meal = Meal(r.Meal)
+	out.LoggedAt = &loggedAt
+	out.QuantityG = r.QuantityG
+	out.Food = &TodayEntryFood{
+		Name:    r.FoodName,
+		Brand:   r.Brand,
+		Source:  foods.FoodSource(r.Source),
+		FoodID:  r.FoodID,
+		Barcode: r.Barcode,
+	}
+	out.Computed = &MacroTotals{
+		Calories: r.Calories,
+		ProteinG: r.ProteinG,
+		CarbsG:   r.CarbsG,
+		FatG:     r.FatG,
+	}
+	return out
+}
+
+// Tokens are opaque to clients; internally they're the last version seen.
+func formatSyncToken(version int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatInt(version, 10)))
+}
+
+// parseSyncToken returns -1 for an empty token (initial sync).
+func parseSyncToken(token string) (int64, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return -1, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(raw), syncTokenPrefix) {
+		return 0, apperr.InvalidField("since", "invalid sync token")
+	}
+	v, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncTokenPrefix), 10, 64)
+	if err != nil || v < 0 {
+		return 0, apperr.InvalidField("since", "invalid sync token")
+	}
+	return v, nil
+}
@@ -0,0 +1,314 @@
+// Package metrics is a small Prometheus-compatible registry: counters,
+// gauges and histograms with labels, written in the text exposition format.
+// Metrics register themselves with Default when created.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets suits request latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// Default is what the New* functions register with and Handler serves.
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w *bufio.Writer) {
+	r.mu.Lock()
+	ms := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Handler serves Default.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		Default.WriteTo(bw)
+		_ = bw.Flush()
+	})
+}
+
+// value is a float64 updated atomically.
+type value struct{ bits atomic.Uint64 }
+
+func (v *value) add(d float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+func (v *value) set(x float64) { v.bits.Store(math.Float64bits(x)) }
+func (v *value) get() float64  { return math.Float64frombits(v.bits.Load()) }
+
+// family is the shared part of a labelled metric: one child per label
+// combination, created on first use.
+type family[T any] struct {
+	name, help, typ string
+	labels          []string
+	newChild        func() *T
+
+	mu       sync.RWMutex
+	children map[string]*T
+}
+
+func (f *family[T]) with(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	c, ok := f.children[key]
+	f.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok = f.children[key]; !ok {
+		c = f.newChild()
+		f.children[key] = c
+	}
+	return c
+}
+
+// each visits children sorted by label values so output is stable.
+func (f *family[T]) each(fn func(labels string, c *T)) {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	children := make(map[string]*T, len(f.children))
+	for k, c := range f.children {
+		children[k] = c
+	}
+	f.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		var values []string
+		if len(f.labels) > 0 {
+			values = strings.Split(k, "\xff")
+		}
+		fn(labelString(f.labels, values), children[k])
+	}
+}
+
+func (f *family[T]) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+}
+
+func newFamily[T any](name, help, typ string, labels []string, newChild func() *T) *family[T] {
+	return &family[T]{name: name, help: help, typ: typ, labels: labels, newChild: newChild, children: map[string]*T{}}
+}
+
+// Counter only goes up.
+type Counter struct{ v value }
+
+func (c *Counter) Inc()          { c.v.add(1) }
+func (c *Counter) Add(d float64) { c.v.add(d) }
+
+type CounterVec struct{ f *family[Counter] }
+
+// NewCounter registers a counter; pass label names to get one series per
+// combination of values.
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{f: newFamily(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	Default.register(name, cv)
+	return cv
+}
+
+func (cv *CounterVec) With(values ...string) *Counter { return cv.f.with(values) }
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	cv.f.header(w)
+	cv.f.each(func(labels string, c *Counter) {
+		fmt.Fprintf(w, "%s%s %s\n", cv.f.name, labels, formatFloat(c.v.get()))
+	})
+}
+
+// Gauge goes up and down.
+type Gauge struct{ v value }
+
+func (g *Gauge) Set(x float64) { g.v.set(x) }
+func (g *Gauge) Add(d float64) { g.v.add(d) }
+
+type GaugeVec struct{ f *family[Gauge] }
+
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	gv := &GaugeVec{f: newFamily(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	Default.register(name, gv)
+	return gv
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge { return gv.f.with(values) }
+
+func (gv *GaugeVec) write(w *bufio.Writer) {
+	gv.f.header(w)
+	gv.f.each(func(labels string, g *Gauge) {
+		fmt.Fprintf(w, "%s%s %s\n", gv.f.name, labels, formatFloat(g.v.get()))
+	})
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    value
+}
+
+func (h *Histogram) Observe(x float64) {
+	i := sort.SearchFloat64s(h.upper, x)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sum.add(x)
+}
+
+type HistogramVec struct {
+	f       *family[Histogram]
+	buckets []float64
+}
+
+// NewHistogram registers a histogram; nil buckets means DefBuckets.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	hv := &HistogramVec{buckets: buckets}
+	hv.f = newFamily(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{upper: buckets, counts: make([]atomic.Uint64, len(buckets))}
+	})
+	Default.register(name, hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram { return hv.f.with(values) }
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	hv.f.header(w)
+	hv.f.each(func(labels string, h *Histogram) {
+		// Bucket lines need "le" added to the series' own labels.
+		inner := strings.TrimSuffix(strings.TrimPrefix(labels, "{"), "}")
+		if inner != "" {
+			inner += ","
+		}
+		var cum uint64
+		for i, le := range hv.buckets {
+			cum += h.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", hv.f.name, inner, formatFloat(le), cum)
+		}
+		count := h.count.Load()
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", hv.f.name, inner, count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.f.name, labels, formatFloat(h.sum.get()))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.f.name, labels, count)
+	})
+}
+
+// funcMetric reads its value when scraped, for stats kept elsewhere
+// (connection pools and the like).
+type funcMetric struct {
+	name, help, typ string
+	fn              func() float64
+}
+
+// NewGaugeFunc registers a gauge read from fn on every scrape.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(name, &funcMetric{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter read from fn on every scrape; fn must
+// never go down.
+func NewCounterFunc(name, help string, fn func() float64) {
+	Default.register(name, &funcMetric{name: name, help: help, typ: "counter", fn: fn})
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, escapeHelp(m.help), m.name, m.typ, m.name, formatFloat(m.fn()))
+}
+
+func labelString(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(x float64) string {
+	switch {
+	case math.IsInf(x, 1):
+		return "+Inf"
+	case math.IsInf(x, -1):
+		return "-Inf"
+	case math.IsNaN(x):
+		return "NaN"
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
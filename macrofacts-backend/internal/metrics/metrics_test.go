@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func render(m metric) string {
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	m.write(w)
+	_ = w.Flush()
+	return b.String()
+}
+
+func TestHistogramExposition(t *testing.T) {
+	// Buckets are given out of order on purpose; they come out sorted.
+	hv := NewHistogram("test_hist_seconds", "Test histogram.", []float64{2, 0.5, 1}, "route")
+	h := hv.With("/a")
+	for _, x := range []float64{0.5, 1.5, 3} { // 0.5 sits on a bound, 3 past the last
+		h.Observe(x)
+	}
+
+	want := `# HELP test_hist_seconds Test histogram.
+# TYPE test_hist_seconds histogram
+test_hist_seconds_bucket{route="/a",le="0.5"} 1
+test_hist_seconds_bucket{route="/a",le="1"} 1
+test_hist_seconds_bucket{route="/a",le="2"} 2
+test_hist_seconds_bucket{route="/a",le="+Inf"} 3
+test_hist_seconds_sum{route="/a"} 5
+test_hist_seconds_count{route="/a"} 3
+`
+	if got := render(hv); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	hv := NewHistogram("test_hist_nolabels", "h", []float64{1})
+	hv.With().Observe(0.25)
+
+	got := render(hv)
+	for _, line := range []string{
+		`test_hist_nolabels_bucket{le="1"} 1`,
+		`test_hist_nolabels_bucket{le="+Inf"} 1`,
+		`test_hist_nolabels_sum 0.25`,
+		`test_hist_nolabels_count 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, got)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	cv := NewCounter("test_escaped_total", "Help with \\ and\nnewline.", "path")
+	cv.With("a\"b\\c\nd").Inc()
+	cv.With("plain").Add(2.5)
+
+	// Series come out sorted by label value.
+	want := `# HELP test_escaped_total Help with \\ and\nnewline.
+# TYPE test_escaped_total counter
+test_escaped_total{path="a\"b\\c\nd"} 1
+test_escaped_total{path="plain"} 2.5
+`
+	if got := render(cv); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	n := 3.0
+	NewGaugeFunc("test_gauge_func", "g", func() float64 { return n })
+	n = 7
+
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	Default.WriteTo(w)
+	_ = w.Flush()
+	if !strings.Contains(b.String(), "\ntest_gauge_func 7\n") {
+		t.Fatalf("gauge func not read at scrape time:\n%s", b.String())
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	NewCounter("test_dup_total", "first")
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "test_dup_total") {
+			t.Fatalf("recover() = %v, want duplicate metric panic", r)
+		}
+	}()
+	NewGauge("test_dup_total", "second")
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	cv := NewCounter("test_labels_total", "c", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic for missing label value")
+		}
+	}()
+	cv.With("only-one")
+}
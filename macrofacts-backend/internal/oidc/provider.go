@@ -0,0 +1,317 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery,
+// authorization code + PKCE, and ID token verification against the
+// provider's JWKS. Only what login needs; no userinfo, no refresh tokens.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+}
+
+// IDToken is the verified subset of ID token claims we use.
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// AuthRequest is one login attempt. Verifier and Nonce stay server-side
+// until the callback; only State and the challenge go to the browser.
+type AuthRequest struct {
+	URL      string
+	State    string
+	Verifier string
+	Nonce    string
+}
+
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	// Clock for token expiry checks.
+	now func() time.Time
+
+	mu        sync.Mutex
+	meta      *metadata
+	keys      map[string]any
+	keysAt    time.Time
+	refreshed time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+const (
+	// Re-fetch keys at most this often when a token names an unknown kid.
+	keyRefreshMinInterval = time.Minute
+	keysMaxAge            = 24 * time.Hour
+)
+
+// NewProvider doesn't contact the issuer; discovery happens on first use so
+// the API can start while the IdP is unreachable.
+func NewProvider(cfg Config) *Provider {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (p *Provider) Issuer() string { return p.cfg.Issuer }
+
+// AuthCodeURL starts a login: fresh state, nonce and PKCE verifier (S256).
+func (p *Provider) AuthCodeURL(ctx context.Context) (AuthRequest, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return AuthRequest{}, err
+	}
+	req := AuthRequest{State: randomString(24), Nonce: randomString(24), Verifier: randomString(48)}
+	sum := sha256.Sum256([]byte(req.Verifier))
+
+	scopes := []string{"openid"}
+	for _, s := range p.cfg.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", req.State)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	req.URL = meta.AuthorizationEndpoint + sep + q.Encode()
+	return req, nil
+}
+
+// Exchange redeems code at the token endpoint and verifies the ID token it
+// returns, including that its nonce matches the one sent with the request.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (IDToken, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return IDToken{}, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.IDToken == "" {
+		return IDToken{}, errors.New("token response has no id_token")
+	}
+	return p.Verify(ctx, tok.IDToken, nonce)
+}
+
+type idClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (IDToken, error) {
+	var claims idClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(p.now),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("invalid id token: %w", err)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return IDToken{}, errors.New("invalid id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return IDToken{}, errors.New("invalid id token: no subject")
+	}
+	return IDToken{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var m metadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(m.Issuer, "/") != p.cfg.Issuer {
+		return nil, errors.New("oidc discovery: issuer mismatch")
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing endpoints")
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// key finds the verification key for kid, re-fetching the JWKS when the
+// provider may have rotated keys.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.lookup(kid); ok && p.now().Sub(p.keysAt) < keysMaxAge {
+		return k, nil
+	}
+	if !p.refreshed.IsZero() && p.now().Sub(p.refreshed) < keyRefreshMinInterval {
+		if k, ok := p.lookup(kid); ok {
+			return k, nil
+		}
+		return nil, errors.New("unknown signing key")
+	}
+
+	p.refreshed = p.now()
+	keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.keysAt = keys, p.now()
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// lookup matches by kid; a token without one is accepted only when the set has a single key.
+func (p *Provider) lookup(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, uri string) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, uri, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue // skip key types we don't support
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, uri string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", uri, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,227 @@
+// Package openapi builds an OpenAPI 3.1 document from the API's Go request
+// and response types, so the schema can't drift from what handlers encode.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+// Auth says what credentials an operation takes.
+type Auth int
+
+const (
+	AuthNone Auth = iota
+	// AuthOptional routes work anonymously but use a token when sent.
+	AuthOptional
+	// AuthSession routes take session JWTs only.
+	AuthSession
+	// AuthScoped routes take session JWTs or access tokens with Op.Scopes.
+	AuthScoped
+)
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Type        string // JSON Schema type; "string" if empty
+	Required    bool
+	Description string
+}
+
+// Op documents one route. Body and Response are zero values of the Go
+// types the handler binds and encodes; nil means no body.
+type Op struct {
+	Method   string
+	Path     string // gin syntax, e.g. /logs/entries/:id
+	Summary  string
+	Auth     Auth
+	Scopes   []string
+	Query    []Param
+	Body     any
+	Response any
+	// Status of the success response; 200 if zero.
+	Status int
+	// ContentType of the success response if not application/json.
+	ContentType string
+}
+
+type Document struct {
+	title, version, prefix string
+
+	ops     []Op
+	schemas map[string]Schema
+	names   map[reflect.Type]string
+	byName  map[string]reflect.Type
+}
+
+// New starts a document for routes mounted under prefix (e.g. "/api").
+func New(title, version, prefix string) *Document {
+	return &Document{
+		title:   title,
+		version: version,
+		prefix:  prefix,
+		schemas: map[string]Schema{},
+		names:   map[reflect.Type]string{},
+		byName:  map[string]reflect.Type{},
+	}
+}
+
+func (d *Document) Add(ops ...Op) {
+	d.ops = append(d.ops, ops...)
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// CheckRoutes compares the documented operations with the routes registered
+// under the document's prefix and describes any difference in either
+// direction. Routes outside the prefix (metrics and the like) are ignored.
+func (d *Document) CheckRoutes(registered gin.RoutesInfo) error {
+	documented := map[string]bool{}
+	for _, op := range d.ops {
+		documented[op.Method+" "+d.prefix+op.Path] = true
+	}
+
+	var missing, extra []string
+	seen := map[string]bool{}
+	for _, r := range registered {
+		if !strings.HasPrefix(r.Path, d.prefix+"/") {
+			continue
+		}
+		key := r.Method + " " + r.Path
+		seen[key] = true
+		if !documented[key] {
+			missing = append(missing, key)
+		}
+	}
+	for key := range documented {
+		if !seen[key] {
+			extra = append(extra, key)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return fmt.Errorf("openapi spec out of date: undocumented routes %v, documented but not registered %v", missing, extra)
+}
+
+// JSON renders the document.
+func (d *Document) JSON() ([]byte, error) {
+	errRef := d.schemaFor(reflect.TypeOf(httpapi.ErrorEnvelope{}))
+
+	paths := map[string]map[string]any{}
+	for _, op := range d.ops {
+		path := d.prefix + ginParam.ReplaceAllString(op.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(op.Method)] = d.operation(op, errRef)
+	}
+
+	doc := map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]any{"title": d.title, "version": d.version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": d.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Session JWT from /auth/login, or a personal access token (mfpat_...).",
+				},
+			},
+		},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func (d *Document) operation(op Op, errRef Schema) map[string]any {
+	out := map[string]any{
+		"operationId": operationID(op),
+		"tags":        []string{tag(op.Path)},
+	}
+	if op.Summary != "" {
+		out["summary"] = op.Summary
+	}
+
+	var params []any
+	for _, m := range ginParam.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true, "schema": Schema{"type": "string"},
+		})
+	}
+	for _, q := range op.Query {
+		typ := q.Type
+		if typ == "" {
+			typ = "string"
+		}
+		p := map[string]any{"name": q.Name, "in": "query", "required": q.Required, "schema": Schema{"type": typ}}
+		if q.Description != "" {
+			p["description"] = q.Description
+		}
+		params = append(params, p)
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.Body != nil {
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": d.schemaFor(reflect.TypeOf(op.Body))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case op.ContentType != "":
+		ok["content"] = map[string]any{op.ContentType: map[string]any{"schema": Schema{"type": "string"}}}
+	case op.Response != nil:
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": d.schemaFor(reflect.TypeOf(op.Response))}}
+	}
+	out["responses"] = map[string]any{
+		fmt.Sprint(status): ok,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": errRef}},
+		},
+	}
+
+	scopes := op.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	switch op.Auth {
+	case AuthOptional:
+		out["security"] = []any{map[string]any{}, map[string]any{"bearerAuth": scopes}}
+	case AuthSession, AuthScoped:
+		out["security"] = []any{map[string]any{"bearerAuth": scopes}}
+	}
+	return out
+}
+
+// operationID is e.g. "delete_logs_entries_id".
+func operationID(op Op) string {
+	p := ginParam.ReplaceAllString(op.Path, "$1")
+	p = strings.NewReplacer("/", "_", "-", "_").Replace(strings.Trim(p, "/"))
+	return strings.ToLower(op.Method) + "_" + p
+}
+
+func tag(path string) string {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return seg
+}
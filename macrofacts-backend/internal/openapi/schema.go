@@ -0,0 +1,133 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is a JSON Schema (2020-12, as used by OpenAPI 3.1) object.
+type Schema map[string]any
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schemaFor describes t, registering named structs as components and
+// returning a $ref to them. It follows encoding/json: json tags, omitempty,
+// "-", and embedded structs flattened into their parent.
+func (d *Document) schemaFor(t reflect.Type) Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s Schema
+	switch {
+	case t == timeType:
+		s = Schema{"type": "string", "format": "date-time"}
+	case t == rawType, t.Kind() == reflect.Interface:
+		s = Schema{}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		s = Schema{"$ref": "#/components/schemas/" + d.component(t)}
+	case t.Kind() == reflect.Struct:
+		s = d.structSchema(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		s = Schema{"type": "string", "contentEncoding": "base64"}
+	case t.Kind() == reflect.Slice, t.Kind() == reflect.Array:
+		s = Schema{"type": "array", "items": d.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		s = Schema{"type": "object", "additionalProperties": d.schemaFor(t.Elem())}
+	case t.Kind() == reflect.String:
+		s = Schema{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		s = Schema{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int32, t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint32:
+		s = Schema{"type": "integer", "format": "int32"}
+	case t.Kind() == reflect.Int64, t.Kind() == reflect.Uint64:
+		s = Schema{"type": "integer", "format": "int64"}
+	case t.Kind() == reflect.Float32, t.Kind() == reflect.Float64:
+		s = Schema{"type": "number"}
+	default:
+		s = Schema{}
+	}
+
+	if !nullable || len(s) == 0 {
+		return s
+	}
+	if ref, ok := s["$ref"]; ok {
+		return Schema{"oneOf": []any{Schema{"$ref": ref}, Schema{"type": "null"}}}
+	}
+	if typ, ok := s["type"].(string); ok {
+		s["type"] = []string{typ, "null"}
+	}
+	return s
+}
+
+// component registers t under components/schemas and returns its name.
+// Types from different packages that share a name get the package as a prefix.
+func (d *Document) component(t reflect.Type) string {
+	if name, ok := d.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if other, taken := d.byName[name]; taken && other != t {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = string(unicode.ToUpper(rune(pkg[0]))) + pkg[1:] + name
+	}
+	d.names[t] = name
+	d.byName[name] = t
+	// Placeholder first so self-referencing types terminate.
+	d.schemas[name] = Schema{}
+	d.schemas[name] = d.structSchema(t)
+	return name
+}
+
+func (d *Document) structSchema(t reflect.Type) Schema {
+	props := map[string]any{}
+	var required []string
+	d.addFields(t, props, &required)
+
+	s := Schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (d *Document) addFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			et := f.Type
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				d.addFields(et, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		props[name] = d.schemaFor(f.Type)
+		if f.Type.Kind() != reflect.Pointer && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package validate collects field-level request errors so a handler can
+// report every problem at once instead of the first one it trips over.
+package validate
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+// Errors accumulates messages keyed by JSON field name. The first message
+// recorded for a field wins. The zero value is ready to use.
+type Errors struct {
+	fields map[string]string
+}
+
+func (v *Errors) Add(field, msg string) {
+	if v.fields == nil {
+		v.fields = map[string]string{}
+	}
+	if _, ok := v.fields[field]; !ok {
+		v.fields[field] = msg
+	}
+}
+
+// Has reports whether field already has an error, so dependent checks can
+// be skipped.
+func (v *Errors) Has(field string) bool {
+	_, ok := v.fields[field]
+	return ok
+}
+
+// Merge copies other's errors with prefix added to each field, for checking
+// list items with the same rules as single values (prefix "items[2].").
+func (v *Errors) Merge(prefix string, other *Errors) {
+	for field, msg := range other.fields {
+		v.Add(prefix+field, msg)
+	}
+}
+
+// Err returns a validation *apperr.Error carrying every field, or nil.
+func (v *Errors) Err() error {
+	return apperr.InvalidFields(v.fields)
+}
+
+// Required flags a blank string.
+func (v *Errors) Required(field, s string) {
+	if strings.TrimSpace(s) == "" {
+		v.Add(field, field+" is required")
+	}
+}
+
+// MaxLen flags strings longer than n characters.
+func (v *Errors) MaxLen(field, s string, n int) {
+	if utf8.RuneCountInString(s) > n {
+		v.Add(field, fmt.Sprintf("%s must be at most %d characters", field, n))
+	}
+}
+
+// Range flags x outside [min, max].
+func (v *Errors) Range(field string, x, min, max float64) {
+	if x < min || x > max {
+		v.Add(field, fmt.Sprintf("%s must be between %s and %s", field, num(min), num(max)))
+	}
+}
+
+// RangePtr is Range for optional values; nil passes.
+func RangePtr[T int | float64](v *Errors, field string, x *T, min, max float64) {
+	if x != nil {
+		v.Range(field, float64(*x), min, max)
+	}
+}
+
+// Timezone flags anything that isn't an IANA zone name.
+func (v *Errors) Timezone(field, tz string) {
+	if !IsTimezone(tz) {
+		v.Add(field, field+" must be an IANA timezone such as Europe/Berlin")
+	}
+}
+
+// Barcode flags values that aren't a GTIN-8, UPC-A, EAN-13 or GTIN-14 with a
+// correct check digit.
+func (v *Errors) Barcode(field, code string) {
+	if !IsGTIN(code) {
+		v.Add(field, field+" must be an 8, 12, 13 or 14 digit GTIN with a valid check digit")
+	}
+}
+
+// IsTimezone accepts names from the IANA database, including "UTC".
+// "Local" is rejected since it means whatever zone the server runs in.
+func IsTimezone(tz string) bool {
+	if tz == "" || tz == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
+
+// IsGTIN checks length and the mod-10 check digit shared by EAN/UPC codes.
+func IsGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		// Weights alternate 1,3,1,3... from the rightmost (check) digit.
+		if (len(code)-1-i)%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// IsBarcodeLookup is the looser shape accepted for lookups: OFF also holds
+// store-internal and short codes that aren't valid GTINs.
+func IsBarcodeLookup(code string) bool {
+	if len(code) < 4 || len(code) > 14 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Energy per gram used for the macro consistency check.
+const (
+	kcalPerGProtein = 4
+	kcalPerGCarbs   = 4
+	kcalPerGFat     = 9
+)
+
+// Macros checks per-100g values against each other: the macros can't weigh
+// more than 100g, and the stated energy can't be well below what the macros
+// alone provide. More energy than that is fine (alcohol, polyols). The weight
+// error is reported under "macros", the energy one under kcalField.
+func (v *Errors) Macros(kcalField string, kcal, protein, carbs, fat float64) {
+	if protein+carbs+fat > 100.5 {
+		v.Add("macros", "protein, carbs and fat add up to more than 100g per 100g")
+	}
+	fromMacros := protein*kcalPerGProtein + carbs*kcalPerGCarbs + fat*kcalPerGFat
+	// 20% and 10 kcal of slack for label rounding and fibre.
+	if kcal < fromMacros*0.8-10 {
+		v.Add(kcalField, fmt.Sprintf("%s is lower than the macros imply (about %s kcal)", kcalField, num(fromMacros)))
+	}
+}
+
+func num(x float64) string {
+	return strconv.FormatFloat(math.Round(x*100)/100, 'f', -1, 64)
+}
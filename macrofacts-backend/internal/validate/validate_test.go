@@ -0,0 +1,164 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+func fields(t *testing.T, v *Errors) map[string]string {
+	t.Helper()
+	err := v.Err()
+	if err == nil {
+		return nil
+	}
+	ae, ok := apperr.As(err)
+	if !ok {
+		t.Fatalf("Err() = %T, want *apperr.Error", err)
+	}
+	if ae.Kind != apperr.KindValidation {
+		t.Fatalf("kind = %v, want validation", ae.Kind)
+	}
+	return ae.Fields
+}
+
+func TestCollectsEveryField(t *testing.T) {
+	var v Errors
+	v.Required("name", "  ")
+	v.MaxLen("brand", "ÄÖÜäöü", 5)
+	v.Range("kcal", -1, 0, 900)
+	qty := 0
+	RangePtr(&v, "quantity_g", &qty, 1, 5000)
+	v.Timezone("timezone", "Mars/Olympus")
+	v.Barcode("barcode", "4006381333932")
+	v.Macros("kcal", 10, 30, 30, 30)
+
+	want := map[string]string{
+		"name":       "name is required",
+		"brand":      "brand must be at most 5 characters",
+		"kcal":       "kcal must be between 0 and 900",
+		"quantity_g": "quantity_g must be between 1 and 5000",
+		"timezone":   "timezone must be an IANA timezone such as Europe/Berlin",
+		"barcode":    "barcode must be an 8, 12, 13 or 14 digit GTIN with a valid check digit",
+	}
+	if got := fields(t, &v); !reflect.DeepEqual(got, want) {
+		t.Fatalf("fields =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestFirstMessageWins(t *testing.T) {
+	var v Errors
+	v.Range("kcal", -1, 0, 900)
+	v.Add("kcal", "second")
+	if !v.Has("kcal") || v.Has("fat") {
+		t.Fatal("Has disagrees with what was added")
+	}
+	if got := fields(t, &v)["kcal"]; got != "kcal must be between 0 and 900" {
+		t.Fatalf("kcal = %q", got)
+	}
+}
+
+func TestNoErrorsIsNil(t *testing.T) {
+	var v Errors
+	v.Required("name", "Oats")
+	v.MaxLen("name", "Oats", 5)
+	v.Range("kcal", 389, 0, 900)
+	RangePtr[float64](&v, "fat", nil, 0, 100)
+	v.Timezone("timezone", "Europe/Berlin")
+	v.Barcode("barcode", "4006381333931")
+	v.Macros("kcal", 389, 16.9, 66.3, 6.9)
+	if err := v.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var item, v Errors
+	item.Required("foodId", "")
+	item.Range("quantity_g", 0, 1, 5000)
+	v.Add("name", "name is required")
+	v.Merge("items[1].", &item)
+
+	want := map[string]string{
+		"name":                "name is required",
+		"items[1].foodId":     "foodId is required",
+		"items[1].quantity_g": "quantity_g must be between 1 and 5000",
+	}
+	if got := fields(t, &v); !reflect.DeepEqual(got, want) {
+		t.Fatalf("fields = %v, want %v", got, want)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		name                     string
+		kcal, protein, carb, fat float64
+		want                     []string
+	}{
+		{"consistent", 389, 16.9, 66.3, 6.9, nil},
+		{"alcohol adds energy", 250, 0, 5, 0, nil},
+		{"within rounding slack", 70, 10, 10, 0, nil},
+		{"too little energy", 50, 10, 10, 10, []string{"kcal"}},
+		{"over 100g", 900, 40, 40, 30, []string{"macros"}},
+		{"both", 10, 40, 40, 30, []string{"kcal", "macros"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Errors
+			v.Macros("kcal", tt.kcal, tt.protein, tt.carb, tt.fat)
+			for _, f := range []string{"kcal", "macros"} {
+				want := false
+				for _, w := range tt.want {
+					want = want || w == f
+				}
+				if v.Has(f) != want {
+					t.Errorf("Has(%q) = %v, want %v", f, v.Has(f), want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsGTIN(t *testing.T) {
+	valid := []string{"96385074", "036000291452", "4006381333931", "10012345678902"}
+	invalid := []string{"", "1234567", "4006381333932", "400638133393a", "123456789012345", "40063813339311"}
+	for _, c := range valid {
+		if !IsGTIN(c) {
+			t.Errorf("IsGTIN(%q) = false", c)
+		}
+	}
+	for _, c := range invalid {
+		if IsGTIN(c) {
+			t.Errorf("IsGTIN(%q) = true", c)
+		}
+	}
+}
+
+func TestIsBarcodeLookup(t *testing.T) {
+	for c, want := range map[string]bool{
+		"1234":            true,
+		"20123456":        true,
+		"123":             false,
+		"123456789012345": false,
+		"12a4":            false,
+	} {
+		if got := IsBarcodeLookup(c); got != want {
+			t.Errorf("IsBarcodeLookup(%q) = %v, want %v", c, got, want)
+		}
+	}
+}
+
+func TestIsTimezone(t *testing.T) {
+	for tz, want := range map[string]bool{
+		"UTC":           true,
+		"Europe/Berlin": true,
+		"":              false,
+		"Local":         false,
+		"Mars/Olympus":  false,
+	} {
+		if got := IsTimezone(tz); got != want {
+			t.Errorf("IsTimezone(%q) = %v, want %v", tz, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Macrofacts-Signature"
+	HeaderEvent     = "X-Macrofacts-Event"
+	HeaderDelivery  = "X-Macrofacts-Delivery"
+
+	// After this many failed attempts (~4h of backoff) an event is marked failed.
+	maxAttempts = 10
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+
+	claimBatch   = 20
+	claimLease   = 2 * time.Minute
+	sendTimeout  = 10 * time.Second
+	maxErrorText = 500
+)
+
+// outbox is the part of RepoPostgres the dispatcher needs.
+type outbox interface {
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]outboxRow, error)
+	RecordAttempt(ctx context.Context, o outboxRow, res attemptResult, delivered bool, retryAt *time.Time) error
+}
+
+// Dispatcher delivers queued events. Run one per replica; leases keep
+// replicas from double-sending.
+type Dispatcher struct {
+	repo   outbox
+	client *http.Client
+}
+
+func NewDispatcher(repo *RepoPostgres) *Dispatcher {
+	return &Dispatcher{repo: repo, client: newDeliveryClient(sendTimeout)}
+}
+
+// Run polls the outbox every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.drain(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := d.repo.ClaimDue(ctx, claimBatch, claimLease)
+		if err != nil {
+			slog.Warn("webhook claim failed", "err", err)
+			return
+		}
+		for _, o := range batch {
+			d.deliver(ctx, o)
+		}
+		if len(batch) < claimBatch {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, o outboxRow) {
+	res := d.send(ctx, o)
+	delivered := res.Error == nil
+
+	var retryAt *time.Time
+	if !delivered && o.Attempts+1 < maxAttempts {
+		t := time.Now().Add(backoff(o.Attempts + 1))
+		retryAt = &t
+	}
+	if err := d.repo.RecordAttempt(ctx, o, res, delivered, retryAt); err != nil {
+		slog.Warn("webhook record failed", "event_id", o.ID, "err", err)
+	}
+}
+
+// send POSTs the signed payload; any 2xx counts as delivered.
+func (d *Dispatcher) send(ctx context.Context, o outboxRow) attemptResult {
+	body, err := json.Marshal(payload{ID: o.ID, Type: o.EventType, CreatedAt: o.CreatedAt, Data: o.Payload})
+	if err != nil {
+		return failure(nil, err.Error(), 0)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return failure(nil, err.Error(), 0)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "macrofacts-webhooks/1")
+	req.Header.Set(HeaderEvent, o.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(o.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(o.Secret, time.Now(), body))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		return failure(nil, err.Error(), elapsed)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	code := resp.StatusCode
+	if code < 200 || code > 299 {
+		return failure(&code, fmt.Sprintf("unexpected status %d", code), elapsed)
+	}
+	return attemptResult{StatusCode: &code, Duration: elapsed}
+}
+
+// Sign returns the signature header value: "t=<unix>,v1=<hex>", where v1 is
+// HMAC-SHA256(secret, "<unix>.<body>"). Receivers should recompute it and
+// reject stale timestamps.
+func Sign(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles from baseBackoff per attempt up to maxBackoff, with ±20% jitter.
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(d) * jitter)
+}
+
+func failure(code *int, msg string, elapsed time.Duration) attemptResult {
+	if len(msg) > maxErrorText {
+		msg = msg[:maxErrorText]
+	}
+	return attemptResult{StatusCode: code, Error: &msg, Duration: elapsed}
+}
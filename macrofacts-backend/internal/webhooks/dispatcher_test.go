@@ -0,0 +1,186 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedAttempt struct {
+	row       outboxRow
+	res       attemptResult
+	delivered bool
+	retryAt   *time.Time
+}
+
+// fakeOutbox hands out one batch and records what the dispatcher reports.
+type fakeOutbox struct {
+	mu       sync.Mutex
+	batch    []outboxRow
+	attempts []recordedAttempt
+}
+
+func (f *fakeOutbox) ClaimDue(context.Context, int, time.Duration) ([]outboxRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := f.batch
+	f.batch = nil
+	return b, nil
+}
+
+func (f *fakeOutbox) RecordAttempt(_ context.Context, o outboxRow, res attemptResult, delivered bool, retryAt *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, recordedAttempt{o, res, delivered, retryAt})
+	return nil
+}
+
+func newTestDispatcher(t *testing.T, rows ...outboxRow) (*Dispatcher, *fakeOutbox) {
+	t.Helper()
+	allowLoopback(t)
+	fake := &fakeOutbox{batch: rows}
+	return &Dispatcher{repo: fake, client: newDeliveryClient(5 * time.Second)}, fake
+}
+
+func row(url string, attempts int) outboxRow {
+	return outboxRow{
+		ID:        42,
+		WebhookID: "hook-1",
+		URL:       url,
+		Secret:    "s3cret",
+		EventType: "entry.created",
+		Payload:   json.RawMessage(`{"id":"e1"}`),
+		Attempts:  attempts,
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	var (
+		gotSig, gotEvent, gotDelivery string
+		gotBody                       []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get(HeaderSignature)
+		gotEvent = r.Header.Get(HeaderEvent)
+		gotDelivery = r.Header.Get(HeaderDelivery)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d, fake := newTestDispatcher(t, row(srv.URL, 0))
+	d.drain(context.Background())
+
+	if len(fake.attempts) != 1 {
+		t.Fatalf("recorded %d attempts, want 1", len(fake.attempts))
+	}
+	a := fake.attempts[0]
+	if !a.delivered || a.retryAt != nil || a.res.Error != nil {
+		t.Fatalf("attempt = %+v, want delivered", a)
+	}
+
+	// A receiver recomputes the HMAC from the timestamp and raw body.
+	ts, _, ok := strings.Cut(strings.TrimPrefix(gotSig, "t="), ",")
+	if !ok {
+		t.Fatalf("malformed signature %q", gotSig)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	if want := Sign("s3cret", time.Unix(unix, 0), gotBody); gotSig != want {
+		t.Errorf("signature = %q, want %q", gotSig, want)
+	}
+	if Sign("wrong", time.Unix(unix, 0), gotBody) == gotSig {
+		t.Error("signature verifies with the wrong secret")
+	}
+
+	if gotEvent != "entry.created" || gotDelivery != "42" {
+		t.Errorf("headers event=%q delivery=%q", gotEvent, gotDelivery)
+	}
+	var p payload
+	if err := json.Unmarshal(gotBody, &p); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if p.ID != 42 || p.Type != "entry.created" || string(p.Data) != `{"id":"e1"}` {
+		t.Errorf("payload = %+v", p)
+	}
+}
+
+func TestDeliverSchedulesRetryWithBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	// Third attempt: base << 2, with ±20% jitter.
+	d, fake := newTestDispatcher(t, row(srv.URL, 2))
+	before := time.Now()
+	d.drain(context.Background())
+
+	a := fake.attempts[0]
+	if a.delivered {
+		t.Fatal("5xx counted as delivered")
+	}
+	if a.res.StatusCode == nil || *a.res.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %v, want 502", a.res.StatusCode)
+	}
+	if a.retryAt == nil {
+		t.Fatal("no retry scheduled")
+	}
+	wait := a.retryAt.Sub(before)
+	base := baseBackoff << 2
+	if lo, hi := time.Duration(float64(base)*0.8), time.Duration(float64(base)*1.2)+time.Second; wait < lo || wait > hi {
+		t.Errorf("retry in %v, want between %v and %v", wait, lo, hi)
+	}
+}
+
+func TestDeliverDeadLettersAfterMaxAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	d, fake := newTestDispatcher(t, row(srv.URL, maxAttempts-1))
+	d.drain(context.Background())
+
+	a := fake.attempts[0]
+	if a.delivered || a.retryAt != nil {
+		t.Fatalf("attempt = %+v, want failed with no retry", a)
+	}
+}
+
+func TestDeliverRecordsConnectionErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	d, fake := newTestDispatcher(t, row(url, 0))
+	d.drain(context.Background())
+
+	a := fake.attempts[0]
+	if a.delivered || a.res.Error == nil || a.res.StatusCode != nil || a.retryAt == nil {
+		t.Fatalf("attempt = %+v, want retryable error without status", a)
+	}
+}
+
+func TestBackoffGrowsAndCaps(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		d := backoff(attempt)
+		want := baseBackoff << (attempt - 1)
+		if want <= 0 || want > maxBackoff {
+			want = maxBackoff
+		}
+		if d < time.Duration(float64(want)*0.8) || d > time.Duration(float64(want)*1.2) {
+			t.Errorf("backoff(%d) = %v, want %v ±20%%", attempt, d, want)
+		}
+	}
+}
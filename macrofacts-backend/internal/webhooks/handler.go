@@ -0,0 +1,86 @@
+package webhooks
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) List(c *gin.Context) {
+	uid := c.GetString("userId")
+	resp, err := h.svc.List(c.Request.Context(), uid)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	w, err := h.svc.Create(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, w)
+}
+
+func (h *Handler) Update(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	w, err := h.svc.Update(c.Request.Context(), uid, id, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *Handler) Delete(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+
+	if err := h.svc.Delete(c.Request.Context(), uid, id); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) Deliveries(c *gin.Context) {
+	uid := c.GetString("userId")
+	id := c.Param("id")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	resp, err := h.svc.Deliveries(c.Request.Context(), uid, id, limit)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types a webhook can subscribe to.
+const (
+	EventEntryCreated   = "entry.created"
+	EventEntryDeleted   = "entry.deleted"
+	EventDayGoalReached = "day.goal_reached"
+	EventWeightLogged   = "weight.logged"
+)
+
+var knownEvents = map[string]bool{
+	EventEntryCreated:   true,
+	EventEntryDeleted:   true,
+	EventDayGoalReached: true,
+	EventWeightLogged:   true,
+}
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreatedWebhook is returned once, on create; the secret isn't shown again.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookListResponse struct {
+	Items []Webhook `json:"items"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+}
+
+type UpdateWebhookRequest struct {
+	URL    *string  `json:"url,omitempty"`
+	Events []string `json:"events,omitempty"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// Delivery is one attempt to deliver one event.
+type Delivery struct {
+	ID         int64     `json:"id"`
+	EventID    int64     `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"statusCode,omitempty"`
+	Error      *string   `json:"error,omitempty"`
+	DurationMs int       `json:"durationMs"`
+	At         time.Time `json:"at"`
+	// Where the event stands now: pending (will retry), delivered or failed.
+	EventStatus string `json:"eventStatus"`
+}
+
+type DeliveryListResponse struct {
+	Items []Delivery `json:"items"`
+}
+
+// payload is the JSON body POSTed to the receiver.
+type payload struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
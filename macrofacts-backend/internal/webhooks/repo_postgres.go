@@ -0,0 +1,250 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+var errWebhookNotFound = apperr.NotFound("webhook not found")
+
+type RepoPostgres struct {
+	db *pgxpool.Pool
+}
+
+func NewRepoPostgres(db *pgxpool.Pool) *RepoPostgres {
+	return &RepoPostgres{db: db}
+}
+
+func (r *RepoPostgres) Create(ctx context.Context, userID, url, secret string, events []string) (Webhook, error) {
+	w := Webhook{URL: url, Events: events, Active: true}
+	err := r.db.QueryRow(ctx, `
+		insert into webhooks (user_id, url, secret, events)
+		values ($1, $2, $3, $4)
+		returning id::text, created_at
+	`, userID, url, secret, events).Scan(&w.ID, &w.CreatedAt)
+	return w, err
+}
+
+func (r *RepoPostgres) List(ctx context.Context, userID string) ([]Webhook, error) {
+	rows, err := r.db.Query(ctx, `
+		select id::text, url, events, active, created_at
+		from webhooks
+		where user_id = $1
+		order by created_at asc
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.URL, &w.Events, &w.Active, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (r *RepoPostgres) Count(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `select count(*) from webhooks where user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+func (r *RepoPostgres) Update(ctx context.Context, userID, id string, req UpdateWebhookRequest) (Webhook, error) {
+	var w Webhook
+	err := r.db.QueryRow(ctx, `
+		update webhooks
+		set
+			url        = coalesce($3, url),
+			events     = coalesce($4, events),
+			active     = coalesce($5, active),
+			updated_at = now()
+		where id = $1::uuid and user_id = $2
+		returning id::text, url, events, active, created_at
+	`, id, userID, req.URL, req.Events, req.Active).Scan(&w.ID, &w.URL, &w.Events, &w.Active, &w.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Webhook{}, errWebhookNotFound
+	}
+	return w, err
+}
+
+func (r *RepoPostgres) Delete(ctx context.Context, userID, id string) error {
+	tag, err := r.db.Exec(ctx, `
+		delete from webhooks where id = $1::uuid and user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
+
+func (r *RepoPostgres) Owns(ctx context.Context, userID, id string) (bool, error) {
+	var ok bool
+	err := r.db.QueryRow(ctx, `
+		select exists (select 1 from webhooks where id = $1::uuid and user_id = $2)
+	`, id, userID).Scan(&ok)
+	return ok, err
+}
+
+// Enqueue adds one outbox row per active webhook of userID subscribed to
+// eventType. A non-empty dedupeKey makes the event fire at most once per webhook.
+func (r *RepoPostgres) Enqueue(ctx context.Context, userID, eventType string, data json.RawMessage, dedupeKey string) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		insert into webhook_outbox (webhook_id, event_type, payload, dedupe_key)
+		select id, $2, $3::jsonb, nullif($4, '')
+		from webhooks
+		where user_id = $1 and active and $2 = any(events)
+		on conflict (webhook_id, dedupe_key) where dedupe_key is not null do nothing
+	`, userID, eventType, string(data), dedupeKey)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Subscribed reports whether the user has an active webhook for eventType.
+func (r *RepoPostgres) Subscribed(ctx context.Context, userID, eventType string) (bool, error) {
+	var ok bool
+	err := r.db.QueryRow(ctx, `
+		select exists (
+			select 1 from webhooks
+			where user_id = $1 and active and $2 = any(events)
+		)
+	`, userID, eventType).Scan(&ok)
+	return ok, err
+}
+
+type outboxRow struct {
+	ID        int64
+	WebhookID string
+	URL       string
+	Secret    string
+	EventType string
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// ClaimDue leases up to limit due events for lease, so concurrent workers
+// (or replicas) don't send the same event twice. An event whose worker dies
+// mid-delivery becomes due again when the lease runs out.
+func (r *RepoPostgres) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]outboxRow, error) {
+	rows, err := r.db.Query(ctx, `
+		with due as (
+			select o.id
+			from webhook_outbox o
+			where o.status = 'pending' and o.next_attempt_at <= now()
+			order by o.next_attempt_at asc
+			limit $1
+			for update skip locked
+		)
+		update webhook_outbox o
+		set next_attempt_at = now() + make_interval(secs => $2)
+		from due, webhooks w
+		where o.id = due.id and w.id = o.webhook_id
+		returning o.id, o.webhook_id::text, w.url, w.secret, o.event_type, o.payload, o.attempts, o.created_at
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []outboxRow
+	for rows.Next() {
+		var o outboxRow
+		if err := rows.Scan(&o.ID, &o.WebhookID, &o.URL, &o.Secret, &o.EventType, &o.Payload, &o.Attempts, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+type attemptResult struct {
+	StatusCode *int
+	Error      *string
+	Duration   time.Duration
+}
+
+// RecordAttempt logs the attempt and moves the event on: delivered, retried
+// at retryAt, or failed for good when retryAt is nil.
+func (r *RepoPostgres) RecordAttempt(ctx context.Context, o outboxRow, res attemptResult, delivered bool, retryAt *time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	attempt := o.Attempts + 1
+	_, err = tx.Exec(ctx, `
+		insert into webhook_deliveries (outbox_id, webhook_id, attempt, status_code, error, duration_ms)
+		values ($1, $2::uuid, $3, $4, $5, $6)
+	`, o.ID, o.WebhookID, attempt, res.StatusCode, res.Error, int(res.Duration.Milliseconds()))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case delivered:
+		_, err = tx.Exec(ctx, `
+			update webhook_outbox
+			set status = 'delivered', attempts = $2, delivered_at = now(), last_error = null
+			where id = $1
+		`, o.ID, attempt)
+	case retryAt != nil:
+		_, err = tx.Exec(ctx, `
+			update webhook_outbox
+			set attempts = $2, next_attempt_at = $3, last_error = $4
+			where id = $1
+		`, o.ID, attempt, *retryAt, res.Error)
+	default:
+		_, err = tx.Exec(ctx, `
+			update webhook_outbox
+			set status = 'failed', attempts = $2, last_error = $3
+			where id = $1
+		`, o.ID, attempt, res.Error)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *RepoPostgres) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]Delivery, error) {
+	rows, err := r.db.Query(ctx, `
+		select d.id, d.outbox_id, o.event_type, d.attempt, d.status_code, d.error, d.duration_ms, d.created_at, o.status
+		from webhook_deliveries d
+		join webhook_outbox o on o.id = d.outbox_id
+		where d.webhook_id = $1::uuid
+		order by d.created_at desc, d.id desc
+		limit $2
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Delivery
+	for rows.Next() {
+		var d Delivery
+		if err := rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.DurationMs, &d.At, &d.EventStatus); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,241 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
+)
+
+const (
+	maxWebhooksPerUser = 10
+	maxDeliveryList    = 200
+)
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type Service struct {
+	repo *RepoPostgres
+}
+
+func NewService(repo *RepoPostgres) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) List(ctx context.Context, userID string) (WebhookListResponse, error) {
+	if userID == "" {
+		return WebhookListResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	items, err := s.repo.List(ctx, userID)
+	if err != nil {
+		return WebhookListResponse{}, apperr.Internal("failed to load webhooks")
+	}
+	if items == nil {
+		items = []Webhook{}
+	}
+	return WebhookListResponse{Items: items}, nil
+}
+
+func (s *Service) Create(ctx context.Context, userID string, req CreateWebhookRequest) (CreatedWebhook, error) {
+	if userID == "" {
+		return CreatedWebhook{}, apperr.Unauthorized("unauthorized")
+	}
+	u, err := validateURL(ctx, req.URL)
+	if err != nil {
+		return CreatedWebhook{}, err
+	}
+	evs, err := validateEvents(req.Events)
+	if err != nil {
+		return CreatedWebhook{}, err
+	}
+
+	n, err := s.repo.Count(ctx, userID)
+	if err != nil {
+		return CreatedWebhook{}, apperr.Internal("failed to create webhook")
+	}
+	if n >= maxWebhooksPerUser {
+		return CreatedWebhook{}, apperr.Conflict("LIMIT_REACHED", "too many webhooks")
+	}
+
+	secret := newSecret()
+	w, err := s.repo.Create(ctx, userID, u, secret, evs)
+	if err != nil {
+		return CreatedWebhook{}, apperr.Internal("failed to create webhook")
+	}
+	return CreatedWebhook{Webhook: w, Secret: secret}, nil
+}
+
+func (s *Service) Update(ctx context.Context, userID, id string, req UpdateWebhookRequest) (Webhook, error) {
+	if userID == "" {
+		return Webhook{}, apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return Webhook{}, errWebhookNotFound
+	}
+	if req.URL != nil {
+		u, err := validateURL(ctx, *req.URL)
+		if err != nil {
+			return Webhook{}, err
+		}
+		req.URL = &u
+	}
+	if req.Events != nil {
+		evs, err := validateEvents(req.Events)
+		if err != nil {
+			return Webhook{}, err
+		}
+		req.Events = evs
+	}
+
+	w, err := s.repo.Update(ctx, userID, id, req)
+	if errors.Is(err, errWebhookNotFound) {
+		return Webhook{}, err
+	}
+	if err != nil {
+		return Webhook{}, apperr.Internal("failed to update webhook")
+	}
+	return w, nil
+}
+
+func (s *Service) Delete(ctx context.Context, userID, id string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	if !uuidRe.MatchString(id) {
+		return errWebhookNotFound
+	}
+	err := s.repo.Delete(ctx, userID, id)
+	if errors.Is(err, errWebhookNotFound) {
+		return err
+	}
+	if err != nil {
+		return apperr.Internal("failed to delete webhook")
+	}
+	return nil
+}
+
+// Deliveries is the attempt log for one webhook, newest first.
+func (s *Service) Deliveries(ctx context.Context, userID, id string, limit int) (DeliveryListResponse, error) {
+	if userID == "" {
+		return DeliveryListResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	if limit <= 0 || limit > maxDeliveryList {
+		limit = 50
+	}
+	if !uuidRe.MatchString(id) {
+		return DeliveryListResponse{}, errWebhookNotFound
+	}
+	ok, err := s.repo.Owns(ctx, userID, id)
+	if err != nil {
+		return DeliveryListResponse{}, apperr.Internal("failed to load webhook")
+	}
+	if !ok {
+		return DeliveryListResponse{}, errWebhookNotFound
+	}
+	items, err := s.repo.ListDeliveries(ctx, id, limit)
+	if err != nil {
+		return DeliveryListResponse{}, apperr.Internal("failed to load deliveries")
+	}
+	if items == nil {
+		items = []Delivery{}
+	}
+	return DeliveryListResponse{Items: items}, nil
+}
+
+// WantsEvent is HandleEvent's events.Interest: true when some webhook of the
+// user would get an event of bus type typ. A failed lookup says yes, so
+// events aren't lost to a database hiccup.
+func (s *Service) WantsEvent(ctx context.Context, userID, typ string) bool {
+	switch typ {
+	case events.EntryCreated, events.EntryDeleted, events.WeightLogged:
+	case events.DaySummary:
+		typ = EventDayGoalReached
+	default:
+		return false
+	}
+	ok, err := s.repo.Subscribed(ctx, userID, typ)
+	return ok || err != nil
+}
+
+// HandleEvent is an events.Bus hook: it queues matching events for every
+// subscribed webhook. day.goal_reached is derived from day summaries and
+// fires at most once per webhook per date.
+func (s *Service) HandleEvent(ctx context.Context, ev events.Event) {
+	typ := ev.Type
+	data := ev.Data
+	dedupe := ""
+
+	switch ev.Type {
+	case events.EntryCreated, events.EntryDeleted, events.WeightLogged:
+	case events.DaySummary:
+		var day struct {
+			Date    string `json:"date"`
+			Summary struct {
+				CalorieGoal      int `json:"calorieGoal"`
+				CaloriesConsumed int `json:"caloriesConsumed"`
+			} `json:"summary"`
+		}
+		if err := json.Unmarshal(ev.Data, &day); err != nil {
+			return
+		}
+		if day.Summary.CalorieGoal <= 0 || day.Summary.CaloriesConsumed < day.Summary.CalorieGoal {
+			return
+		}
+		typ = EventDayGoalReached
+		dedupe = EventDayGoalReached + ":" + day.Date
+	default:
+		return
+	}
+
+	if _, err := s.repo.Enqueue(ctx, ev.UserID, typ, data, dedupe); err != nil {
+		slog.Warn("webhook enqueue failed", "type", typ, "err", err)
+	}
+}
+
+func validateURL(ctx context.Context, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" || len(raw) > 2000 {
+		return "", apperr.InvalidField("url", "invalid url")
+	}
+	if err := checkHost(ctx, u.Hostname()); err != nil {
+		if errors.Is(err, errBlockedAddress) {
+			return "", apperr.InvalidField("url", "url must point to a public address")
+		}
+		return "", apperr.InvalidField("url", "url host does not resolve")
+	}
+	return raw, nil
+}
+
+func validateEvents(in []string) ([]string, error) {
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+	for _, e := range in {
+		e = strings.TrimSpace(e)
+		if !knownEvents[e] {
+			return nil, apperr.Invalid("unknown event: " + e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		return nil, apperr.Invalid("events required")
+	}
+	return out, nil
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,84 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// Webhook URLs are user-supplied, so the server must not become a way to
+// reach its own network. Hosts are checked when a webhook is saved and every
+// connection is checked again at dial time, after DNS, so a name that later
+// rebinds to an internal address is still refused.
+
+var errBlockedAddress = errors.New("webhook target address is not allowed")
+
+// allowPrivateTargets lets tests deliver to httptest servers on loopback.
+// Never set outside tests.
+var allowPrivateTargets = false
+
+// Shared address space (RFC 6598) isn't covered by netip's IsPrivate.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// blockedAddr reports whether addr is somewhere webhooks must not be sent:
+// loopback, private, link-local (including cloud metadata at 169.254.169.254),
+// unspecified or multicast.
+func blockedAddr(addr netip.Addr) bool {
+	if allowPrivateTargets {
+		return false
+	}
+	addr = addr.Unmap()
+	return !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		cgnat.Contains(addr)
+}
+
+// checkHost resolves host and fails if any of its addresses is blocked.
+func checkHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if blockedAddr(addr) {
+			return errBlockedAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if blockedAddr(a) {
+			return errBlockedAddress
+		}
+	}
+	return nil
+}
+
+// dialControl runs on the resolved address right before connecting.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil || blockedAddr(ap.Addr()) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// newDeliveryClient returns an HTTP client that can only connect to public
+// addresses. Environment proxies are ignored: the proxy's address would be
+// checked instead of the target's.
+func newDeliveryClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: tr}
+}
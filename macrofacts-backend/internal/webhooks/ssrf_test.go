@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+)
+
+// allowLoopback lets the test deliver to httptest servers.
+func allowLoopback(t *testing.T) {
+	t.Helper()
+	allowPrivateTargets = true
+	t.Cleanup(func() { allowPrivateTargets = false })
+}
+
+func TestValidateURLRejectsInternalTargets(t *testing.T) {
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://172.16.3.4/hook",
+		"https://192.168.1.1/hook",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		_, err := validateURL(context.Background(), raw)
+		if apperr.KindOf(err) != apperr.KindValidation {
+			t.Errorf("validateURL(%q) = %v, want validation error", raw, err)
+		}
+	}
+}
+
+func TestValidateURLAcceptsPublicAddress(t *testing.T) {
+	got, err := validateURL(context.Background(), " https://93.184.215.14/hook ")
+	if err != nil {
+		t.Fatalf("validateURL: %v", err)
+	}
+	if got != "https://93.184.215.14/hook" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestValidateURLRejectsBadShape(t *testing.T) {
+	for _, raw := range []string{"", "ftp://93.184.215.14/", "http://", "not a url"} {
+		if _, err := validateURL(context.Background(), raw); err == nil {
+			t.Errorf("validateURL(%q) succeeded", raw)
+		}
+	}
+}
+
+// The dial-time check is what stops DNS rebinding: whatever a name resolves
+// to when the request is made, a blocked address is never connected to.
+func TestDeliveryClientRefusesLoopbackAtDial(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { hit = true }))
+	defer srv.Close()
+
+	_, err := newDeliveryClient(time.Second).Get(srv.URL)
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("err = %v, want errBlockedAddress", err)
+	}
+	if hit {
+		t.Fatal("request reached the loopback server")
+	}
+}
@@ -0,0 +1,100 @@
+package weight
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/httpapi"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) List(c *gin.Context) {
+	uid := c.GetString("userId")
+	days, _ := strconv.Atoi(c.Query("days"))
+
+	resp, err := h.svc.List(c.Request.Context(), uid, days)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) Log(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req LogWeightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.BadRequest(c, "invalid json", nil)
+		return
+	}
+
+	entry, err := h.svc.Log(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (h *Handler) Delete(c *gin.Context) {
+	uid := c.GetString("userId")
+	date := c.Param("date")
+
+	if err := h.svc.Delete(c.Request.Context(), uid, date); err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) EnergyExpenditure(c *gin.Context) {
+	uid := c.GetString("userId")
+	days, _ := strconv.Atoi(c.Query("days"))
+
+	var rate float64
+	if v := c.Query("rateKgPerWeek"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			httpapi.Error(c, apperr.InvalidField("rateKgPerWeek", "invalid rateKgPerWeek"))
+			return
+		}
+		rate = f
+	}
+
+	resp, err := h.svc.EnergyExpenditure(c.Request.Context(), uid, days, rate)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) ApplySuggestion(c *gin.Context) {
+	uid := c.GetString("userId")
+
+	var req ApplySuggestionRequest
+	// Body is optional; an empty POST applies the default window at maintenance.
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			httpapi.BadRequest(c, "invalid json", nil)
+			return
+		}
+	}
+
+	s, err := h.svc.ApplySuggestion(c.Request.Context(), uid, req)
+	if err != nil {
+		httpapi.Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
@@ -0,0 +1,52 @@
+package weight
+
+type LogWeightRequest struct {
+	// Date is YYYY-MM-DD in the user's timezone; defaults to today.
+	Date     *string `json:"date,omitempty"`
+	WeightKg float64 `json:"weightKg" binding:"required"`
+}
+
+type WeightEntry struct {
+	Date     string  `json:"date"`
+	WeightKg float64 `json:"weightKg"`
+}
+
+type WeightListResponse struct {
+	Items []WeightEntry `json:"items"`
+}
+
+type GoalSuggestion struct {
+	CalorieGoal  int `json:"calorieGoal"`
+	ProteinGoalG int `json:"proteinGoalG"`
+	CarbsGoalG   int `json:"carbsGoalG"`
+	FatGoalG     int `json:"fatGoalG"`
+}
+
+type EnergyExpenditureResponse struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	WindowDays int    `json:"windowDays"`
+
+	// Nil when there isn't enough data to say anything useful.
+	TDEE *int `json:"tdee,omitempty"`
+	// +/- kcal/day derived from the spread of weigh-ins around the trend line.
+	TDEEUncertainty *int `json:"tdeeUncertainty,omitempty"`
+
+	AvgIntake      int      `json:"avgIntake"`
+	IntakeDays     int      `json:"intakeDays"`
+	WeighIns       int      `json:"weighIns"`
+	TrendStartKg   *float64 `json:"trendStartKg,omitempty"`
+	TrendEndKg     *float64 `json:"trendEndKg,omitempty"`
+	WeeklyChangeKg *float64 `json:"weeklyChangeKg,omitempty"`
+
+	// Confidence is 0..1; ConfidenceLabel is "none" | "low" | "medium" | "high".
+	Confidence      float64 `json:"confidence"`
+	ConfidenceLabel string  `json:"confidenceLabel"`
+
+	Suggestion *GoalSuggestion `json:"suggestion,omitempty"`
+}
+
+type ApplySuggestionRequest struct {
+	Days          *int     `json:"days,omitempty"`
+	RateKgPerWeek *float64 `json:"rateKgPerWeek,omitempty"`
+}
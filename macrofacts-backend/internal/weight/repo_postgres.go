@@ -0,0 +1,63 @@
+package weight
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RepoPostgres struct {
+	db *pgxpool.Pool
+}
+
+func NewRepoPostgres(db *pgxpool.Pool) *RepoPostgres {
+	return &RepoPostgres{db: db}
+}
+
+// Upsert keeps one weigh-in per user per day; logging again overwrites.
+func (r *RepoPostgres) Upsert(ctx context.Context, userID string, date time.Time, weightKg float64) error {
+	_, err := r.db.Exec(ctx, `
+		insert into weight_entries (user_id, date, weight_kg)
+		values ($1, $2::date, $3)
+		on conflict (user_id, date)
+		do update set weight_kg = excluded.weight_kg, created_at = now()
+	`, userID, date.Format("2006-01-02"), weightKg)
+	return err
+}
+
+func (r *RepoPostgres) Delete(ctx context.Context, userID string, date time.Time) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		delete from weight_entries
+		where user_id = $1 and date = $2::date
+	`, userID, date.Format("2006-01-02"))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *RepoPostgres) List(ctx context.Context, userID string, from, to time.Time) ([]WeightEntry, error) {
+	rows, err := r.db.Query(ctx, `
+		select
+			to_char(date, 'YYYY-MM-DD'),
+			weight_kg::float8
+		from weight_entries
+		where user_id = $1 and date between $2::date and $3::date
+		order by date asc
+	`, userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WeightEntry
+	for rows.Next() {
+		var e WeightEntry
+		if err := rows.Scan(&e.Date, &e.WeightKg); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,236 @@
+package weight
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/apperr"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/auth"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/events"
+	"github.com/leogan-dev/macrofacts/macrofacts-backend/internal/logs"
+)
+
+const (
+	defaultWindowDays = 28
+	maxWindowDays     = 120
+)
+
+// Accepted weigh-ins, in kg. weight_entries_kg_chk enforces the same range.
+const (
+	minWeightKg = 20
+	maxWeightKg = 500
+)
+
+type Service struct {
+	repo    *RepoPostgres
+	logs    *logs.Service
+	authSvc *auth.Service
+	events  *events.Bus
+}
+
+func NewService(repo *RepoPostgres, logsSvc *logs.Service, authSvc *auth.Service, bus *events.Bus) *Service {
+	return &Service{repo: repo, logs: logsSvc, authSvc: authSvc, events: bus}
+}
+
+func (s *Service) Log(ctx context.Context, userID string, req LogWeightRequest) (WeightEntry, error) {
+	if userID == "" {
+		return WeightEntry{}, apperr.Unauthorized("unauthorized")
+	}
+	if req.WeightKg < minWeightKg || req.WeightKg > maxWeightKg {
+		return WeightEntry{}, apperr.InvalidField("weightKg", "weight out of range")
+	}
+
+	day, err := s.resolveDate(userID, req.Date)
+	if err != nil {
+		return WeightEntry{}, err
+	}
+
+	kg := round2(req.WeightKg)
+	if err := s.repo.Upsert(ctx, userID, day, kg); err != nil {
+		return WeightEntry{}, apperr.Internal("failed to log weight")
+	}
+
+	entry := WeightEntry{Date: day.Format("2006-01-02"), WeightKg: kg}
+	s.events.Publish(ctx, userID, events.WeightLogged, entry)
+	return entry, nil
+}
+
+func (s *Service) Delete(ctx context.Context, userID string, date string) error {
+	if userID == "" {
+		return apperr.Unauthorized("unauthorized")
+	}
+	day, err := s.resolveDate(userID, &date)
+	if err != nil {
+		return err
+	}
+	ok, err := s.repo.Delete(ctx, userID, day)
+	if err != nil {
+		return apperr.Internal("failed to delete weight")
+	}
+	if !ok {
+		return apperr.NotFound("not found")
+	}
+	return nil
+}
+
+func (s *Service) List(ctx context.Context, userID string, days int) (WeightListResponse, error) {
+	if userID == "" {
+		return WeightListResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	days = clampWindow(days)
+
+	today := s.today(userID)
+	items, err := s.repo.List(ctx, userID, today.AddDate(0, 0, -(days-1)), today)
+	if err != nil {
+		return WeightListResponse{}, apperr.Internal("failed to load weights")
+	}
+	if items == nil {
+		items = []WeightEntry{}
+	}
+	return WeightListResponse{Items: items}, nil
+}
+
+// EnergyExpenditure estimates TDEE over the trailing window ending today.
+// rateKgPerWeek is the desired weight change used to turn the estimate into goals
+// (negative to lose, 0 to maintain).
+func (s *Service) EnergyExpenditure(ctx context.Context, userID string, days int, rateKgPerWeek float64) (EnergyExpenditureResponse, error) {
+	if userID == "" {
+		return EnergyExpenditureResponse{}, apperr.Unauthorized("unauthorized")
+	}
+	if math.Abs(rateKgPerWeek) > 1.5 {
+		return EnergyExpenditureResponse{}, apperr.Invalid("rate out of range")
+	}
+	days = clampWindow(days)
+
+	// The current day is usually half-logged, so the window ends yesterday.
+	to := s.today(userID).AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, -(days - 1))
+
+	intakeRows, err := s.logs.DailyIntake(ctx, userID, from, to)
+	if err != nil {
+		return EnergyExpenditureResponse{}, err
+	}
+	intake := make(map[string]int, len(intakeRows))
+	for _, d := range intakeRows {
+		intake[d.Date] = d.Calories
+	}
+
+	weightRows, err := s.repo.List(ctx, userID, from, to)
+	if err != nil {
+		return EnergyExpenditureResponse{}, apperr.Internal("failed to load weights")
+	}
+	weights := make(map[string]float64, len(weightRows))
+	for _, w := range weightRows {
+		weights[w.Date] = w.WeightKg
+	}
+
+	est := estimateTDEE(from, to, intake, weights)
+
+	resp := EnergyExpenditureResponse{
+		From:            from.Format("2006-01-02"),
+		To:              to.Format("2006-01-02"),
+		WindowDays:      days,
+		TDEE:            est.tdee,
+		TDEEUncertainty: est.uncertainty,
+		AvgIntake:       est.avgIntake,
+		IntakeDays:      est.intakeDays,
+		WeighIns:        est.weighIns,
+		TrendStartKg:    est.trendStart,
+		TrendEndKg:      est.trendEnd,
+		WeeklyChangeKg:  est.weeklyChange,
+		Confidence:      est.confidence,
+		ConfidenceLabel: confidenceLabel(est.confidence, est.tdee != nil),
+	}
+
+	if est.tdee != nil {
+		settings, err := s.authSvc.GetSettings(userID)
+		if err == nil {
+			sug := suggestGoals(*est.tdee, rateKgPerWeek, GoalSuggestion{
+				CalorieGoal:  settings.CalorieGoal,
+				ProteinGoalG: settings.ProteinGoalG,
+				CarbsGoalG:   settings.CarbsGoalG,
+				FatGoalG:     settings.FatGoalG,
+			})
+			resp.Suggestion = &sug
+		}
+	}
+
+	return resp, nil
+}
+
+// ApplySuggestion recomputes the estimate and writes the suggested goals to the
+// user's settings. Low-confidence estimates are refused rather than applied.
+func (s *Service) ApplySuggestion(ctx context.Context, userID string, req ApplySuggestionRequest) (auth.MeSettingsResponse, error) {
+	days := defaultWindowDays
+	if req.Days != nil {
+		days = *req.Days
+	}
+	var rate float64
+	if req.RateKgPerWeek != nil {
+		rate = *req.RateKgPerWeek
+	}
+
+	est, err := s.EnergyExpenditure(ctx, userID, days, rate)
+	if err != nil {
+		return auth.MeSettingsResponse{}, err
+	}
+	if est.Suggestion == nil || est.Confidence < 0.4 {
+		return auth.MeSettingsResponse{}, apperr.Invalid("insufficient data")
+	}
+
+	sug := est.Suggestion
+	return s.authSvc.UpdateSettings(userID, auth.UpdateSettingsRequest{
+		CalorieGoal:  &sug.CalorieGoal,
+		ProteinGoalG: &sug.ProteinGoalG,
+		CarbsGoalG:   &sug.CarbsGoalG,
+		FatGoalG:     &sug.FatGoalG,
+	})
+}
+
+func (s *Service) location(userID string) *time.Location {
+	tz := "UTC"
+	if s.authSvc != nil {
+		if settings, err := s.authSvc.GetSettings(userID); err == nil && settings.Timezone != "" {
+			tz = settings.Timezone
+		}
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s *Service) today(userID string) time.Time {
+	now := time.Now().In(s.location(userID))
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (s *Service) resolveDate(userID string, date *string) (time.Time, error) {
+	if date == nil || strings.TrimSpace(*date) == "" {
+		return s.today(userID), nil
+	}
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(*date))
+	if err != nil {
+		return time.Time{}, apperr.InvalidField("date", "invalid date")
+	}
+	if d.After(s.today(userID)) {
+		return time.Time{}, apperr.Invalid("date in future")
+	}
+	return d, nil
+}
+
+func clampWindow(days int) int {
+	if days <= 0 {
+		return defaultWindowDays
+	}
+	if days < 7 {
+		return 7
+	}
+	if days > maxWindowDays {
+		return maxWindowDays
+	}
+	return days
+}
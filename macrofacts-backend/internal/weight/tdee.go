@@ -0,0 +1,194 @@
+package weight
+
+import (
+	"math"
+	"time"
+)
+
+// Energy density of body-mass change. The usual ~7700 kcal/kg figure is for
+// pure fat; it's close enough over multi-week windows where water noise averages out.
+const kcalPerKg = 7700.0
+
+// Below these the estimate is mostly noise, so we don't return a number at all.
+const (
+	minIntakeDays = 7
+	minWeighIns   = 3
+)
+
+type estimate struct {
+	tdee        *int
+	uncertainty *int
+
+	avgIntake  int
+	intakeDays int
+	weighIns   int
+
+	trendStart   *float64
+	trendEnd     *float64
+	weeklyChange *float64
+
+	confidence float64
+}
+
+// estimateTDEE works out expenditure from the energy balance over [from, to]:
+// average logged intake minus the energy stored (or released) by the weight trend.
+//
+// The weight trend is a least-squares line through the weigh-ins, which smooths
+// day-to-day water swings far better than first-vs-last. Days without any food
+// logged are treated as unknown rather than zero, so partial logging biases the
+// result less than it hurts confidence.
+func estimateTDEE(from, to time.Time, intake map[string]int, weights map[string]float64) estimate {
+	var est estimate
+
+	windowDays := int(to.Sub(from).Hours()/24) + 1
+	if windowDays <= 0 {
+		return est
+	}
+
+	var intakeSum int
+	var xs, ys []float64
+	for i := 0; i < windowDays; i++ {
+		key := from.AddDate(0, 0, i).Format("2006-01-02")
+		if kcal, ok := intake[key]; ok && kcal > 0 {
+			intakeSum += kcal
+			est.intakeDays++
+		}
+		if w, ok := weights[key]; ok && w > 0 {
+			xs = append(xs, float64(i))
+			ys = append(ys, w)
+		}
+	}
+	est.weighIns = len(xs)
+	if est.intakeDays > 0 {
+		est.avgIntake = int(math.Round(float64(intakeSum) / float64(est.intakeDays)))
+	}
+
+	if est.intakeDays < minIntakeDays || est.weighIns < minWeighIns {
+		return est
+	}
+
+	slope, intercept, slopeSE := linearFit(xs, ys)
+
+	start := round2(intercept + slope*xs[0])
+	end := round2(intercept + slope*float64(windowDays-1))
+	weekly := round2(slope * 7)
+	est.trendStart = &start
+	est.trendEnd = &end
+	est.weeklyChange = &weekly
+
+	tdee := int(math.Round(float64(est.avgIntake) - slope*kcalPerKg))
+	if tdee < 0 {
+		tdee = 0
+	}
+	est.tdee = &tdee
+
+	if !math.IsNaN(slopeSE) {
+		u := int(math.Round(slopeSE * kcalPerKg))
+		est.uncertainty = &u
+	}
+
+	est.confidence = confidence(windowDays, est.intakeDays, est.weighIns, xs[len(xs)-1]-xs[0], slopeSE)
+	return est
+}
+
+// confidence blends how complete the logs are with how tight the trend is.
+// Each factor is 0..1 and they multiply, so one bad dimension drags the score down.
+func confidence(windowDays, intakeDays, weighIns int, spanDays, slopeSE float64) float64 {
+	intakeCov := float64(intakeDays) / float64(windowDays)
+	// Weighing every other day is plenty for a linear trend.
+	weighCov := math.Min(1, float64(weighIns)/(float64(windowDays)/2))
+	// Two weeks of spread is the point where water fluctuations stop dominating.
+	spanFactor := math.Min(1, spanDays/14)
+
+	noise := 1.0
+	if !math.IsNaN(slopeSE) {
+		// Full marks under 100 kcal/day of uncertainty, zero at 600+.
+		u := slopeSE * kcalPerKg
+		noise = clamp01(1 - (u-100)/500)
+	}
+
+	return round2(clamp01(intakeCov * weighCov * spanFactor * noise))
+}
+
+func confidenceLabel(c float64, hasEstimate bool) string {
+	switch {
+	case !hasEstimate:
+		return "none"
+	case c >= 0.7:
+		return "high"
+	case c >= 0.4:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// linearFit returns slope, intercept and the standard error of the slope.
+// slopeSE is NaN when there are too few points to estimate residual variance.
+func linearFit(xs, ys []float64) (slope, intercept, slopeSE float64) {
+	n := float64(len(xs))
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+
+	var sxx, sxy float64
+	for i := range xs {
+		dx := xs[i] - mx
+		sxx += dx * dx
+		sxy += dx * (ys[i] - my)
+	}
+	if sxx == 0 {
+		return 0, my, math.NaN()
+	}
+	slope = sxy / sxx
+	intercept = my - slope*mx
+
+	if len(xs) < 3 {
+		return slope, intercept, math.NaN()
+	}
+	var sse float64
+	for i := range xs {
+		r := ys[i] - (intercept + slope*xs[i])
+		sse += r * r
+	}
+	slopeSE = math.Sqrt(sse / (n - 2) / sxx)
+	return slope, intercept, slopeSE
+}
+
+// suggestGoals keeps the protein target and rescales carbs/fat (in their current
+// ratio) so the macros add up to the new calorie goal.
+func suggestGoals(tdee int, rateKgPerWeek float64, current GoalSuggestion) GoalSuggestion {
+	cal := int(math.Round(float64(tdee) + rateKgPerWeek*kcalPerKg/7))
+	if cal < 1200 {
+		cal = 1200
+	}
+
+	out := GoalSuggestion{CalorieGoal: cal, ProteinGoalG: current.ProteinGoalG}
+
+	remaining := float64(cal - current.ProteinGoalG*4)
+	if remaining < 0 {
+		remaining = 0
+	}
+	carbKcal := float64(current.CarbsGoalG * 4)
+	fatKcal := float64(current.FatGoalG * 9)
+	if carbKcal+fatKcal <= 0 {
+		// No usable ratio to preserve; fall back to an even split.
+		carbKcal, fatKcal = 1, 1
+	}
+	carbShare := carbKcal / (carbKcal + fatKcal)
+
+	out.CarbsGoalG = int(math.Round(remaining * carbShare / 4))
+	out.FatGoalG = int(math.Round(remaining * (1 - carbShare) / 9))
+	return out
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
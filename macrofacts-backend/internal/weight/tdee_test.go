@@ -0,0 +1,182 @@
+package weight
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var day0 = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func dayKey(i int) string { return day0.AddDate(0, 0, i).Format("2006-01-02") }
+
+// series logs kcal on the given days and weighs in with w(i) on the others given.
+func series(intakeDays []int, kcal int, weighDays []int, w func(i int) float64) (map[string]int, map[string]float64) {
+	intake := map[string]int{}
+	for _, i := range intakeDays {
+		intake[dayKey(i)] = kcal
+	}
+	weights := map[string]float64{}
+	for _, i := range weighDays {
+		weights[dayKey(i)] = w(i)
+	}
+	return intake, weights
+}
+
+func days(from, to, step int) []int {
+	var out []int
+	for i := from; i <= to; i += step {
+		out = append(out, i)
+	}
+	return out
+}
+
+func TestEstimateTDEE(t *testing.T) {
+	// Four weeks at 2500 kcal/day, losing exactly 50 g/day: the deficit is
+	// 0.05 * 7700 = 385 kcal/day, so expenditure is 2885.
+	intake, weights := series(days(0, 27, 1), 2500, days(0, 27, 1), func(i int) float64 { return 80 - 0.05*float64(i) })
+	est := estimateTDEE(day0, day0.AddDate(0, 0, 27), intake, weights)
+
+	if est.tdee == nil || *est.tdee != 2885 {
+		t.Fatalf("tdee = %v, want 2885", ptrStr(est.tdee))
+	}
+	if est.avgIntake != 2500 || est.intakeDays != 28 || est.weighIns != 28 {
+		t.Errorf("avgIntake %d, intakeDays %d, weighIns %d", est.avgIntake, est.intakeDays, est.weighIns)
+	}
+	if *est.weeklyChange != -0.35 || *est.trendStart != 80 || *est.trendEnd != 78.65 {
+		t.Errorf("trend %v -> %v, weekly %v", *est.trendStart, *est.trendEnd, *est.weeklyChange)
+	}
+	if est.uncertainty == nil || *est.uncertainty != 0 {
+		t.Errorf("uncertainty = %v, want 0 for a perfect line", ptrStr(est.uncertainty))
+	}
+	if est.confidence != 1 {
+		t.Errorf("confidence = %v, want 1", est.confidence)
+	}
+}
+
+func TestEstimateTDEESparseData(t *testing.T) {
+	flat := func(int) float64 { return 70 }
+	to := day0.AddDate(0, 0, 27)
+
+	tests := []struct {
+		name           string
+		intake, weighs []int
+		wantEstimate   bool
+		wantConfidence float64
+		wantLabel      string
+	}{
+		{"too few intake days", days(0, 5, 1), days(0, 27, 1), false, 0, "none"},
+		{"too few weigh-ins", days(0, 27, 1), []int{0, 27}, false, 0, "none"},
+		// 7/28 logged, 3 weigh-ins over 6 days: 0.25 * 3/14 * 6/14.
+		{"bare minimum", days(0, 6, 1), []int{0, 3, 6}, true, 0.02, "low"},
+		// Every day logged, weighed every 4th day over 24 days: 1 * 7/14 * 1.
+		{"sparse weigh-ins", days(0, 27, 1), days(0, 27, 4), true, 0.5, "medium"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intake, weights := series(tt.intake, 2200, tt.weighs, flat)
+			est := estimateTDEE(day0, to, intake, weights)
+			if (est.tdee != nil) != tt.wantEstimate {
+				t.Fatalf("tdee = %v, want estimate: %v", ptrStr(est.tdee), tt.wantEstimate)
+			}
+			if est.avgIntake != 2200 {
+				t.Errorf("avgIntake = %d, want 2200 even without an estimate", est.avgIntake)
+			}
+			if est.confidence != tt.wantConfidence {
+				t.Errorf("confidence = %v, want %v", est.confidence, tt.wantConfidence)
+			}
+			if got := confidenceLabel(est.confidence, est.tdee != nil); got != tt.wantLabel {
+				t.Errorf("label = %q, want %q", got, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestEstimateTDEENoisyWeightsLowerConfidence(t *testing.T) {
+	// Same 50 g/day trend with ±1 kg of alternating water noise.
+	noisy := func(i int) float64 { return 80 - 0.05*float64(i) + float64(i%2*2-1) }
+	intake, weights := series(days(0, 27, 1), 2500, days(0, 27, 1), noisy)
+	est := estimateTDEE(day0, day0.AddDate(0, 0, 27), intake, weights)
+
+	if est.tdee == nil || math.Abs(float64(*est.tdee-2885)) > 150 {
+		t.Fatalf("tdee = %v, want about 2885", ptrStr(est.tdee))
+	}
+	if est.uncertainty == nil || *est.uncertainty <= 100 {
+		t.Fatalf("uncertainty = %v, want over 100", ptrStr(est.uncertainty))
+	}
+	if est.confidence >= 1 || est.confidence <= 0 {
+		t.Fatalf("confidence = %v, want between 0 and 1", est.confidence)
+	}
+}
+
+func TestEstimateTDEEEmptyWindow(t *testing.T) {
+	est := estimateTDEE(day0, day0.AddDate(0, 0, -1), nil, nil)
+	if est.tdee != nil || est.intakeDays != 0 {
+		t.Fatalf("got %+v for an empty window", est)
+	}
+}
+
+func TestLinearFit(t *testing.T) {
+	tests := []struct {
+		name                 string
+		xs, ys               []float64
+		slope, intercept, se float64
+	}{
+		{"exact line", []float64{0, 1, 2}, []float64{1, 3, 5}, 2, 1, 0},
+		// sxx = 5, sxy = 4.5, residuals .1 .2 -.7 .4 -> sse .7, se = sqrt(.7/2/5).
+		{"with residuals", []float64{0, 1, 2, 3}, []float64{1, 2, 2, 4}, 0.9, 0.9, math.Sqrt(0.07)},
+		{"two points", []float64{0, 4}, []float64{70, 71}, 0.25, 70, math.NaN()},
+		{"one day only", []float64{3, 3}, []float64{70, 72}, 0, 71, math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slope, intercept, se := linearFit(tt.xs, tt.ys)
+			if !near(slope, tt.slope) || !near(intercept, tt.intercept) || !near(se, tt.se) {
+				t.Fatalf("got %v, %v, %v; want %v, %v, %v", slope, intercept, se, tt.slope, tt.intercept, tt.se)
+			}
+		})
+	}
+}
+
+func TestSuggestGoals(t *testing.T) {
+	current := GoalSuggestion{CalorieGoal: 2200, ProteinGoalG: 150, CarbsGoalG: 200, FatGoalG: 70}
+
+	tests := []struct {
+		name    string
+		tdee    int
+		rate    float64
+		current GoalSuggestion
+		want    GoalSuggestion
+	}{
+		// 2500 - 0.5*7700/7 = 1950; 1350 kcal left split 800:630 like the current goals.
+		{"cut", 2500, -0.5, current, GoalSuggestion{1950, 150, 189, 66}},
+		{"maintain", 2500, 0, current, GoalSuggestion{2500, 150, 266, 93}},
+		// 1500 - 1100 = 400, clamped up to 1200.
+		{"calorie floor", 1500, -1, current, GoalSuggestion{1200, 150, 84, 29}},
+		// Protein alone is over the goal: nothing left for carbs and fat.
+		{"protein over goal", 1500, -1, GoalSuggestion{ProteinGoalG: 400, CarbsGoalG: 200, FatGoalG: 70}, GoalSuggestion{1200, 400, 0, 0}},
+		// No current carbs or fat to take a ratio from: even split by energy.
+		{"no ratio", 2000, 0, GoalSuggestion{ProteinGoalG: 100}, GoalSuggestion{2000, 100, 200, 89}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestGoals(tt.tdee, tt.rate, tt.current); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	if math.IsNaN(b) {
+		return math.IsNaN(a)
+	}
+	return math.Abs(a-b) < 1e-9
+}
+
+func ptrStr(p *int) any {
+	if p == nil {
+		return "nil"
+	}
+	return *p
+}
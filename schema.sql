@@ -78,7 +78,7 @@ create table if not exists food_log_entries (
     date date not null,
     meal text not null,
 
-    source text not null, -- 'off' | 'custom'
+    source text not null, -- 'off' | 'custom' | 'recipe'
     food_id uuid null,
     barcode text null,
 
@@ -94,7 +94,6 @@ create table if not exists food_log_entries (
 
     created_at timestamptz not null default now(),
 
-    constraint food_log_entries_meal_chk check (meal in ('breakfast','lunch','dinner','snacks')),
     constraint food_log_entries_source_chk check (source in ('off','custom')),
     constraint food_log_entries_qty_chk check (quantity_g > 0),
     constraint food_log_entries_cal_chk check (calories >= 0),
@@ -113,3 +112,620 @@ create index if not exists food_log_entries_user_date_meal_idx
 
 create index if not exists food_log_entries_user_created_at_idx
     on food_log_entries (user_id, created_at desc);
+
+-- =========================
+-- Weight log (one weigh-in per user per day)
+-- =========================
+create table if not exists weight_entries (
+    user_id uuid not null references users(id) on delete cascade,
+    date date not null,
+    weight_kg numeric not null,
+    created_at timestamptz not null default now(),
+
+    primary key (user_id, date),
+    constraint weight_entries_kg_chk check (weight_kg >= 20 and weight_kg <= 500)
+    );
+
+-- Same range the API accepts (minWeightKg/maxWeightKg); older installs had 0-700.
+do $$
+begin
+    if not exists (
+        select 1 from pg_constraint
+        where conname = 'weight_entries_kg_chk' and pg_get_constraintdef(oid) like '%500%'
+    ) then
+        alter table weight_entries drop constraint if exists weight_entries_kg_chk;
+        alter table weight_entries
+            add constraint weight_entries_kg_chk check (weight_kg >= 20 and weight_kg <= 500);
+    end if;
+end $$;
+
+-- =========================
+-- Goal history (versioned copy of the goal columns on users)
+-- =========================
+create table if not exists user_goals (
+    user_id uuid not null references users(id) on delete cascade,
+    effective_from date not null,
+
+    calorie_goal integer not null,
+    protein_goal_g integer not null,
+    carbs_goal_g integer not null,
+    fat_goal_g integer not null,
+
+    created_at timestamptz not null default now(),
+
+    primary key (user_id, effective_from)
+    );
+
+-- Backfill: existing users get their current goals as the version since sign-up.
+insert into user_goals (user_id, effective_from, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g)
+select id, created_at::date, calorie_goal, protein_goal_g, carbs_goal_g, fat_goal_g
+from users
+on conflict (user_id, effective_from) do nothing;
+
+-- =========================
+-- Goal profiles (e.g. training / rest day), per-weekday schedule and per-date overrides
+-- =========================
+create table if not exists goal_profiles (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    name text not null,
+    created_at timestamptz not null default now(),
+    archived_at timestamptz null,
+
+    constraint goal_profiles_name_len check (char_length(name) between 1 and 60)
+    );
+
+create unique index if not exists goal_profiles_user_name_uq
+    on goal_profiles (user_id, lower(name))
+    where archived_at is null;
+
+-- Profile values are versioned like user_goals so edits don't rewrite history.
+create table if not exists goal_profile_versions (
+    profile_id uuid not null references goal_profiles(id) on delete cascade,
+    effective_from date not null,
+
+    calorie_goal integer not null,
+    protein_goal_g integer not null,
+    carbs_goal_g integer not null,
+    fat_goal_g integer not null,
+
+    primary key (profile_id, effective_from)
+    );
+
+-- One row per weekday (0 = Sunday) per schedule version; null profile = base goals.
+create table if not exists goal_schedule (
+    user_id uuid not null references users(id) on delete cascade,
+    effective_from date not null,
+    weekday smallint not null,
+    profile_id uuid null references goal_profiles(id),
+
+    primary key (user_id, effective_from, weekday),
+    constraint goal_schedule_weekday_chk check (weekday between 0 and 6)
+    );
+
+create table if not exists goal_day_overrides (
+    user_id uuid not null references users(id) on delete cascade,
+    date date not null,
+    profile_id uuid not null references goal_profiles(id),
+
+    primary key (user_id, date)
+    );
+
+-- =========================
+-- Meal slots (per-user, ordered). food_log_entries.meal holds the slot key.
+-- =========================
+create table if not exists meal_slots (
+    user_id uuid not null references users(id) on delete cascade,
+    key text not null,
+    label text not null,
+    position integer not null,
+    created_at timestamptz not null default now(),
+    archived_at timestamptz null,
+
+    primary key (user_id, key),
+    constraint meal_slots_key_fmt check (key ~ '^[a-z0-9_]{1,40}$'),
+    constraint meal_slots_label_len check (char_length(label) between 1 and 40)
+    );
+
+-- Everyone starts from the four classic slots; existing entries all use these keys.
+insert into meal_slots (user_id, key, label, position)
+select u.id, d.key, d.label, d.position
+from users u
+cross join (values
+    ('breakfast', 'Breakfast', 0),
+    ('lunch', 'Lunch', 1),
+    ('dinner', 'Dinner', 2),
+    ('snacks', 'Snacks', 3)
+) as d(key, label, position)
+on conflict (user_id, key) do nothing;
+
+alter table food_log_entries drop constraint if exists food_log_entries_meal_chk;
+
+do $$
+begin
+    if not exists (select 1 from pg_constraint where conname = 'food_log_entries_meal_fk') then
+        alter table food_log_entries
+            add constraint food_log_entries_meal_fk
+            foreign key (user_id, meal) references meal_slots (user_id, key);
+    end if;
+end $$;
+
+-- =========================
+-- Recipes (user-private; nutrition is computed from ingredients on read)
+-- =========================
+create table if not exists recipes (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+
+    name text not null,
+    servings numeric not null,
+    cooked_weight_g numeric null, -- null = sum of ingredient weights
+
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+
+    constraint recipes_name_len check (char_length(name) between 1 and 200),
+    constraint recipes_servings_chk check (servings > 0),
+    constraint recipes_cooked_weight_chk check (cooked_weight_g is null or cooked_weight_g > 0)
+    );
+
+create index if not exists recipes_user_idx
+    on recipes (user_id);
+
+create table if not exists recipe_ingredients (
+    recipe_id uuid not null references recipes(id) on delete cascade,
+    position integer not null,
+
+    source text not null, -- 'off' | 'custom' | 'recipe'
+    food_id uuid null,
+    sub_recipe_id uuid null references recipes(id), -- restrict: can't delete a recipe still used elsewhere
+    barcode text null,
+
+    quantity_g numeric not null,
+
+    primary key (recipe_id, position),
+    constraint recipe_ingredients_qty_chk check (quantity_g > 0),
+    constraint recipe_ingredients_ident_chk check (
+(source = 'off' and barcode is not null and food_id is null and sub_recipe_id is null) or
+(source = 'custom' and food_id is not null and sub_recipe_id is null) or
+(source = 'recipe' and sub_recipe_id is not null and food_id is null)
+    )
+    );
+
+-- Log entries can snapshot a recipe (food_id holds the recipe ID).
+do $$
+begin
+    if not exists (
+        select 1 from pg_constraint
+        where conname = 'food_log_entries_source_chk' and pg_get_constraintdef(oid) like '%recipe%'
+    ) then
+        alter table food_log_entries drop constraint if exists food_log_entries_source_chk;
+        alter table food_log_entries drop constraint if exists food_log_entries_ident_chk;
+        alter table food_log_entries
+            add constraint food_log_entries_source_chk check (source in ('off','custom','recipe'));
+        alter table food_log_entries
+            add constraint food_log_entries_ident_chk check (
+                (source = 'off' and barcode is not null and food_id is null) or
+                (source in ('custom','recipe') and food_id is not null)
+            );
+    end if;
+end $$;
+
+-- =========================
+-- Saved meals (templates of foods + quantities, logged in one go)
+-- =========================
+create table if not exists saved_meals (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    name text not null,
+    created_at timestamptz not null default now(),
+
+    constraint saved_meals_name_len check (char_length(name) between 1 and 200)
+    );
+
+create index if not exists saved_meals_user_idx
+    on saved_meals (user_id);
+
+create table if not exists saved_meal_items (
+    saved_meal_id uuid not null references saved_meals(id) on delete cascade,
+    position integer not null,
+
+    source text not null,
+    food_id uuid null,
+    barcode text null,
+
+    -- Display name at save time; the food is re-resolved when the meal is logged.
+    food_name text not null,
+    brand text null,
+
+    quantity_g integer not null,
+
+    primary key (saved_meal_id, position),
+    constraint saved_meal_items_qty_chk check (quantity_g > 0)
+    );
+
+-- Quick-add entries: a label and user-entered values, no food or quantity behind them.
+alter table food_log_entries alter column quantity_g drop not null;
+
+do $$
+begin
+    if not exists (
+        select 1 from pg_constraint
+        where conname = 'food_log_entries_source_chk' and pg_get_constraintdef(oid) like '%quick%'
+    ) then
+        alter table food_log_entries drop constraint if exists food_log_entries_source_chk;
+        alter table food_log_entries drop constraint if exists food_log_entries_ident_chk;
+        alter table food_log_entries drop constraint if exists food_log_entries_qty_chk;
+        alter table food_log_entries
+            add constraint food_log_entries_source_chk check (source in ('off','custom','recipe','quick'));
+        alter table food_log_entries
+            add constraint food_log_entries_ident_chk check (
+                (source = 'off' and barcode is not null and food_id is null) or
+                (source in ('custom','recipe') and food_id is not null) or
+                (source = 'quick' and food_id is null and barcode is null)
+            );
+        alter table food_log_entries
+            add constraint food_log_entries_qty_chk check (
+                (source = 'quick' and quantity_g is null) or quantity_g > 0
+            );
+    end if;
+end $$;
+
+-- Saved meals can carry quick entries too; their values are stored, not re-resolved.
+alter table saved_meal_items alter column quantity_g drop not null;
+alter table saved_meal_items add column if not exists calories integer null;
+alter table saved_meal_items add column if not exists protein_g numeric null;
+alter table saved_meal_items add column if not exists carbs_g numeric null;
+alter table saved_meal_items add column if not exists fat_g numeric null;
+
+do $$
+begin
+    if not exists (
+        select 1 from pg_constraint
+        where conname = 'saved_meal_items_qty_chk' and pg_get_constraintdef(oid) like '%quick%'
+    ) then
+        alter table saved_meal_items drop constraint if exists saved_meal_items_qty_chk;
+        alter table saved_meal_items
+            add constraint saved_meal_items_qty_chk check (
+                (source = 'quick' and quantity_g is null and calories is not null) or quantity_g > 0
+            );
+    end if;
+end $$;
+
+-- =========================
+-- Favorite foods (ref = barcode for OFF, UUID text for custom/recipe)
+-- =========================
+create table if not exists food_favorites (
+    user_id uuid not null references users(id) on delete cascade,
+    source text not null,
+    ref text not null,
+    created_at timestamptz not null default now(),
+
+    primary key (user_id, source, ref),
+    constraint food_favorites_source_chk check (source in ('off','custom','recipe'))
+    );
+
+-- =========================
+-- Idempotency keys (replayed responses for retried mutating requests)
+-- =========================
+create table if not exists idempotency_keys (
+    user_id uuid not null references users(id) on delete cascade,
+    key text not null,
+    method text not null,
+    path text not null,
+    request_hash text not null,
+
+    -- null until the first request finishes
+    status_code integer null,
+    content_type text null,
+    response_body bytea null,
+
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+
+    primary key (user_id, key)
+    );
+
+create index if not exists idempotency_keys_expires_idx on idempotency_keys (expires_at);
+
+-- =========================
+-- Delta sync
+-- Every change to a user's entries, custom foods, settings or goal plan
+-- takes the next value of users.sync_version. The bump row-locks the user, so
+-- versions for one user commit in order and "version > token" never skips a
+-- change.
+-- =========================
+alter table users add column if not exists sync_version bigint not null default 0;
+alter table users add column if not exists settings_version bigint not null default 0;
+
+alter table food_log_entries add column if not exists updated_at timestamptz not null default now();
+alter table food_log_entries add column if not exists deleted_at timestamptz null;
+alter table food_log_entries add column if not exists version bigint not null default 0;
+
+alter table foods_custom add column if not exists updated_at timestamptz not null default now();
+alter table foods_custom add column if not exists version bigint not null default 0;
+
+create index if not exists food_log_entries_user_version_idx
+    on food_log_entries (user_id, version);
+
+create index if not exists foods_custom_user_version_idx
+    on foods_custom (created_by_user_id, version);
+
+create or replace function next_sync_version(uid uuid) returns bigint
+language sql as $$
+    update users set sync_version = sync_version + 1 where id = uid returning sync_version
+$$;
+
+create or replace function food_log_entries_sync_touch() returns trigger
+language plpgsql as $$
+begin
+    new.version := next_sync_version(new.user_id);
+    new.updated_at := now();
+    return new;
+end $$;
+
+drop trigger if exists food_log_entries_sync_touch on food_log_entries;
+create trigger food_log_entries_sync_touch
+    before insert or update on food_log_entries
+    for each row execute function food_log_entries_sync_touch();
+
+create or replace function foods_custom_sync_touch() returns trigger
+language plpgsql as $$
+begin
+    new.version := next_sync_version(new.created_by_user_id);
+    new.updated_at := now();
+    return new;
+end $$;
+
+drop trigger if exists foods_custom_sync_touch on foods_custom;
+create trigger foods_custom_sync_touch
+    before insert or update on foods_custom
+    for each row execute function foods_custom_sync_touch();
+
+create or replace function users_settings_sync_touch() returns trigger
+language plpgsql as $$
+begin
+    if (new.timezone, new.calorie_goal, new.protein_goal_g, new.carbs_goal_g, new.fat_goal_g)
+        is distinct from
+       (old.timezone, old.calorie_goal, old.protein_goal_g, old.carbs_goal_g, old.fat_goal_g) then
+        new.sync_version := new.sync_version + 1;
+        new.settings_version := new.sync_version;
+    end if;
+    return new;
+end $$;
+
+drop trigger if exists users_settings_sync_touch on users;
+create trigger users_settings_sync_touch
+    before update on users
+    for each row execute function users_settings_sync_touch();
+
+-- Rows from before sync existed get distinct versions (the triggers assign them).
+update food_log_entries set version = version where version = 0;
+update foods_custom set version = version where version = 0;
+
+-- Goal profiles, their versions, the weekday schedule and day overrides sync
+-- as one snapshot: any change bumps goal_plan_version, and a pull past that
+-- version carries the whole plan.
+alter table users add column if not exists goal_plan_version bigint not null default 0;
+
+create or replace function bump_goal_plan_version(uid uuid) returns void
+language sql as $$
+    update users set sync_version = sync_version + 1, goal_plan_version = sync_version + 1 where id = uid
+$$;
+
+create or replace function goal_plan_sync_touch() returns trigger
+language plpgsql as $$
+begin
+    if tg_op = 'DELETE' then
+        perform bump_goal_plan_version(old.user_id);
+    else
+        perform bump_goal_plan_version(new.user_id);
+    end if;
+    return null;
+end $$;
+
+-- Versions have no user_id; go through the profile.
+create or replace function goal_profile_versions_sync_touch() returns trigger
+language plpgsql as $$
+declare
+    uid uuid;
+begin
+    if tg_op = 'DELETE' then
+        select user_id into uid from goal_profiles where id = old.profile_id;
+    else
+        select user_id into uid from goal_profiles where id = new.profile_id;
+    end if;
+    perform bump_goal_plan_version(uid);
+    return null;
+end $$;
+
+drop trigger if exists goal_profiles_sync_touch on goal_profiles;
+create trigger goal_profiles_sync_touch
+    after insert or update or delete on goal_profiles
+    for each row execute function goal_plan_sync_touch();
+
+drop trigger if exists goal_schedule_sync_touch on goal_schedule;
+create trigger goal_schedule_sync_touch
+    after insert or update or delete on goal_schedule
+    for each row execute function goal_plan_sync_touch();
+
+drop trigger if exists goal_day_overrides_sync_touch on goal_day_overrides;
+create trigger goal_day_overrides_sync_touch
+    after insert or update or delete on goal_day_overrides
+    for each row execute function goal_plan_sync_touch();
+
+drop trigger if exists goal_profile_versions_sync_touch on goal_profile_versions;
+create trigger goal_profile_versions_sync_touch
+    after insert or update or delete on goal_profile_versions
+    for each row execute function goal_profile_versions_sync_touch();
+
+-- =========================
+-- Outgoing webhooks
+-- Events are written to webhook_outbox and delivered by a background worker
+-- with exponential backoff; every attempt is recorded in webhook_deliveries.
+-- =========================
+create table if not exists webhooks (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    url text not null,
+    secret text not null,
+    events text[] not null,
+    active boolean not null default true,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now()
+    );
+
+create index if not exists webhooks_user_idx on webhooks (user_id);
+
+create table if not exists webhook_outbox (
+    id bigserial primary key,
+    webhook_id uuid not null references webhooks(id) on delete cascade,
+    event_type text not null,
+    payload jsonb not null,
+    -- Events that must fire at most once (e.g. day.goal_reached per date)
+    dedupe_key text null,
+
+    status text not null default 'pending',
+    attempts integer not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    last_error text null,
+
+    created_at timestamptz not null default now(),
+    delivered_at timestamptz null,
+
+    constraint webhook_outbox_status_chk check (status in ('pending','delivered','failed'))
+    );
+
+create index if not exists webhook_outbox_due_idx
+    on webhook_outbox (next_attempt_at) where status = 'pending';
+
+create unique index if not exists webhook_outbox_dedupe_idx
+    on webhook_outbox (webhook_id, dedupe_key) where dedupe_key is not null;
+
+create table if not exists webhook_deliveries (
+    id bigserial primary key,
+    outbox_id bigint not null references webhook_outbox(id) on delete cascade,
+    webhook_id uuid not null references webhooks(id) on delete cascade,
+    attempt integer not null,
+    status_code integer null,
+    error text null,
+    duration_ms integer not null,
+    created_at timestamptz not null default now()
+    );
+
+create index if not exists webhook_deliveries_webhook_idx
+    on webhook_deliveries (webhook_id, created_at desc);
+
+-- =========================
+-- Rate limit buckets (shared across replicas; losing them on crash is harmless)
+-- =========================
+create unlogged table if not exists rate_limit_buckets (
+    key text primary key,
+    tokens double precision not null,
+    allowed boolean not null,
+    updated_at timestamptz not null default now()
+    );
+
+create index if not exists rate_limit_buckets_updated_idx on rate_limit_buckets (updated_at);
+
+-- =========================
+-- Login audit log (also the source of brute-force counters)
+-- username is the canonical name tried, whether or not the account exists.
+-- =========================
+create table if not exists login_events (
+    id bigserial primary key,
+    username text not null,
+    user_id uuid null references users(id) on delete set null,
+    ip text null,
+    outcome text not null,
+    created_at timestamptz not null default now(),
+
+    constraint login_events_outcome_chk check (outcome in ('success','failure','throttled','locked'))
+    );
+
+create index if not exists login_events_username_idx on login_events (username, created_at desc);
+create index if not exists login_events_ip_idx on login_events (ip, created_at desc);
+
+-- =========================
+-- TOTP two-factor auth
+-- A row with enabled_at null is an enrollment awaiting its first code.
+-- last_counter is the newest time step accepted, so codes can't be replayed.
+-- =========================
+create table if not exists user_totp (
+    user_id uuid primary key references users(id) on delete cascade,
+    secret text not null,
+    enabled_at timestamptz null,
+    last_counter bigint not null default 0,
+    created_at timestamptz not null default now()
+    );
+
+-- Recovery codes are stored as SHA-256 hex and burn on use.
+create table if not exists user_recovery_codes (
+    id bigserial primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    code_hash text not null,
+    used_at timestamptz null,
+    created_at timestamptz not null default now(),
+
+    constraint user_recovery_codes_uniq unique (user_id, code_hash)
+    );
+
+-- Password accepted, second factor pending.
+do $$
+begin
+    if not exists (
+        select 1 from pg_constraint
+        where conname = 'login_events_outcome_chk' and pg_get_constraintdef(oid) like '%challenged%'
+    ) then
+        alter table login_events drop constraint if exists login_events_outcome_chk;
+        alter table login_events add constraint login_events_outcome_chk
+            check (outcome in ('success','failure','throttled','locked','challenged'));
+    end if;
+end $$;
+
+-- =========================
+-- OIDC single sign-on
+-- An IdP identity (issuer + subject) maps to exactly one account.
+-- =========================
+create table if not exists user_identities (
+    issuer text not null,
+    subject text not null,
+    user_id uuid not null references users(id) on delete cascade,
+    email text null,
+    created_at timestamptz not null default now(),
+
+    primary key (issuer, subject)
+    );
+
+create index if not exists user_identities_user_idx on user_identities (user_id);
+
+-- Pending logins between /auth/oidc/start and the callback. The PKCE
+-- verifier and nonce never leave the server. link_user_id is set when a
+-- signed-in user is linking an identity rather than logging in.
+create table if not exists oidc_login_states (
+    state text primary key,
+    code_verifier text not null,
+    nonce text not null,
+    link_user_id uuid null references users(id) on delete cascade,
+    expires_at timestamptz not null
+    );
+
+-- =========================
+-- Personal access tokens
+-- Only a SHA-256 of the secret is kept; token_prefix is the first few
+-- characters, for telling tokens apart in listings.
+-- =========================
+create table if not exists personal_access_tokens (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    name text not null,
+    token_hash text not null unique,
+    token_prefix text not null,
+    scopes text[] not null,
+    created_at timestamptz not null default now(),
+    last_used_at timestamptz null,
+    expires_at timestamptz null,
+    revoked_at timestamptz null
+    );
+
+create index if not exists personal_access_tokens_user_idx on personal_access_tokens (user_id, created_at desc);